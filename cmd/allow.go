@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// allowedFile is the file, under the user config directory, that lists the repos
+// the shell hook may load variables in.
+const allowedFile = "glen/allowed.yaml"
+
+// errNotGitRepo is returned when allowing a directory that is not in a git repo.
+var errNotGitRepo = errors.New("not in a git repo")
+
+// allowedPath returns the path of the list of allowed repos.
+func allowedPath() string {
+	return filepath.Join(userConfigDir(), allowedFile)
+}
+
+// readAllowed returns the allowed repos, keyed by their root, with the hash of
+// their repo config when they were allowed.
+func readAllowed() (map[string]string, error) {
+	allowed := make(map[string]string)
+
+	data, err := os.ReadFile(allowedPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return allowed, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read allowed repos: %w", err)
+	}
+
+	err = yaml.Unmarshal(data, &allowed)
+	if err != nil {
+		return nil, fmt.Errorf("parse allowed repos: %w", err)
+	}
+
+	return allowed, nil
+}
+
+// writeAllowed replaces the allowed repos.
+func writeAllowed(allowed map[string]string) error {
+	data, err := yaml.Marshal(allowed)
+	if err != nil {
+		return fmt.Errorf("encode allowed repos: %w", err)
+	}
+
+	path := allowedPath()
+
+	err = os.MkdirAll(filepath.Dir(path), 0o700) //nolint:mnd
+	if err != nil {
+		return fmt.Errorf("create config directory: %w", err)
+	}
+
+	err = os.WriteFile(path, data, 0o600) //nolint:mnd
+	if err != nil {
+		return fmt.Errorf("write allowed repos: %w", err)
+	}
+
+	return nil
+}
+
+// repoConfigHash returns a hash of the repo config of the repo at root, or an
+// empty string if it has none.
+func repoConfigHash(root string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(root, repoConfigFile)) //nolint:gosec
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read repo config: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// isAllowed reports whether the shell hook may load the variables of the repo at
+// root. Like direnv, a repo has to be allowed again when its repo config changes.
+func isAllowed(root string) (bool, error) {
+	allowed, err := readAllowed()
+	if err != nil {
+		return false, err
+	}
+
+	hash, ok := allowed[root]
+	if !ok {
+		return false, nil
+	}
+
+	current, err := repoConfigHash(root)
+	if err != nil {
+		return false, err
+	}
+
+	return hash == current, nil
+}
+
+// setAllowed allows or denies the repo at root.
+func setAllowed(root string, allow bool) error {
+	allowed, err := readAllowed()
+	if err != nil {
+		return err
+	}
+
+	delete(allowed, root)
+	if allow {
+		allowed[root], err = repoConfigHash(root)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeAllowed(allowed)
+}
+
+// repoRoot returns the absolute root of the git repo that contains the directory
+// in args, or the working directory if args is empty.
+func repoRoot(args []string) (string, error) {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("find absolute path: %w", err)
+	}
+
+	root := gitRoot(dir)
+	if root == "" {
+		return "", fmt.Errorf("%w: %s", errNotGitRepo, dir)
+	}
+
+	return root, nil
+}
+
+func allowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "allow [DIR]",
+		Short: "Allows the shell hook to load the variables of a repo",
+		Long: `Allows the shell hook to load the variables of the git repo that contains DIR,
+or the current directory. The hook never loads variables in a repo that is not
+allowed, so that cloning a repo and entering it does not call GitLab with your
+token. A repo has to be allowed again when its .glen.yaml changes.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			root, err := repoRoot(args)
+			if err != nil {
+				slog.Error("failed to find the repo", "error", err)
+				os.Exit(1)
+			}
+
+			err = setAllowed(root, true)
+			if err != nil {
+				slog.Error("failed to allow the repo", "repo", root, "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func denyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "deny [DIR]",
+		Short: "Stops the shell hook from loading the variables of a repo",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			root, err := repoRoot(args)
+			if err != nil {
+				slog.Error("failed to find the repo", "error", err)
+				os.Exit(1)
+			}
+
+			err = setAllowed(root, false)
+			if err != nil {
+				slog.Error("failed to deny the repo", "repo", root, "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lingrino/glen/glentest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllow(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	root := glentest.NewRepo(t, nil)
+	config := filepath.Join(root, repoConfigFile)
+	require.NoError(t, os.WriteFile(config, []byte("profile: work\n"), 0o600))
+
+	allowed, err := isAllowed(root)
+	require.NoError(t, err)
+	assert.False(t, allowed, "new repo")
+
+	require.NoError(t, setAllowed(root, true))
+	allowed, err = isAllowed(root)
+	require.NoError(t, err)
+	assert.True(t, allowed, "allowed repo")
+
+	require.NoError(t, os.WriteFile(config, []byte("profile: evil\n"), 0o600))
+	allowed, err = isAllowed(root)
+	require.NoError(t, err)
+	assert.False(t, allowed, "changed repo config")
+
+	require.NoError(t, setAllowed(root, true))
+	require.NoError(t, setAllowed(root, false))
+	allowed, err = isAllowed(root)
+	require.NoError(t, err)
+	assert.False(t, allowed, "denied repo")
+}
+
+func TestRepoRoot(t *testing.T) {
+	t.Parallel()
+
+	root := glentest.NewRepo(t, nil)
+	sub := filepath.Join(root, "sub")
+	require.NoError(t, os.Mkdir(sub, 0o750))
+
+	got, err := repoRoot([]string{sub})
+	require.NoError(t, err)
+	assert.Equal(t, root, got)
+
+	_, err = repoRoot([]string{t.TempDir()})
+	require.ErrorIs(t, err, errNotGitRepo)
+}
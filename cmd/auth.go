@@ -0,0 +1,531 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	gitlab "gitlab.com/gitlab-org/api/client-go/v2"
+	"golang.org/x/oauth2"
+)
+
+// credentialsDir is the directory, relative to the user config directory, that
+// holds one credentials file for every host that glen is logged in to.
+const credentialsDir = "glen/credentials"
+
+// defaultLoginHost is the host that glen logs in to when neither --host nor the
+// profile sets one.
+const defaultLoginHost = "gitlab.com"
+
+const (
+	flagLoginHostDesc = "The GitLab host to log in to. Defaults to the host of your profile or gitlab.com"
+	flagClientIDDesc  = "The application ID of a GitLab OAuth application that allows the device authorization grant"
+	flagScopeDesc     = "The OAuth scopes to request. Can be repeated"
+	flagAuthHostDesc  = "Only use the credentials of this GitLab host"
+)
+
+var (
+	// errClientIDNotSet is returned by 'glen login' without an OAuth application.
+	errClientIDNotSet = errors.New("OAuth application ID not set. Please use --client-id, GLEN_CLIENT_ID or the clientId of your profile")
+	// errNotLoggedIn is returned when there are no stored credentials for a host.
+	errNotLoggedIn = errors.New("not logged in")
+)
+
+// credentials are the OAuth tokens of a host, stored by 'glen login'.
+type credentials struct {
+	Host     string        `json:"host"`
+	ClientID string        `json:"clientId"`
+	Scopes   []string      `json:"scopes"`
+	Token    *oauth2.Token `json:"token"`
+}
+
+// credentialsPath returns the path of the credentials file of host.
+func credentialsPath(host string) string {
+	return filepath.Join(userConfigDir(), credentialsDir, url.PathEscape(host)+".json")
+}
+
+// readCredentials reads the stored credentials of host, returning errNotLoggedIn
+// if there are none.
+func readCredentials(host string) (*credentials, error) {
+	data, err := os.ReadFile(credentialsPath(host))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w to %s", errNotLoggedIn, host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read credentials: %w", err)
+	}
+
+	c := &credentials{}
+	err = json.Unmarshal(data, c)
+	if err != nil {
+		return nil, fmt.Errorf("parse credentials of %s: %w", host, err)
+	}
+
+	return c, nil
+}
+
+// storedHosts returns every host with stored credentials.
+func storedHosts() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(userConfigDir(), credentialsDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read credentials directory: %w", err)
+	}
+
+	hosts := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		host, err := url.PathUnescape(name)
+		if err == nil {
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts, nil
+}
+
+// write stores the credentials in a file that only the user can read. The file is
+// replaced atomically so that a failed write never loses the refresh token.
+func (c *credentials) write() error {
+	path := credentialsPath(c.Host)
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode credentials: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o700) //nolint:mnd
+	if err != nil {
+		return fmt.Errorf("create credentials directory: %w", err)
+	}
+
+	// CreateTemp creates the file with mode 0600
+	f, err := os.CreateTemp(filepath.Dir(path), ".credentials-*")
+	if err != nil {
+		return fmt.Errorf("create credentials: %w", err)
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck
+
+	_, err = f.Write(data)
+	if err != nil {
+		return fmt.Errorf("write credentials: %w", errors.Join(err, f.Close()))
+	}
+
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("write credentials: %w", err)
+	}
+
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		return fmt.Errorf("write credentials: %w", err)
+	}
+
+	return nil
+}
+
+// oauthConfig returns the OAuth configuration of the GitLab instance at host.
+// https://docs.gitlab.com/ee/api/oauth2.html
+func oauthConfig(host string, clientID string, scopes []string) *oauth2.Config {
+	base := "https://" + host
+
+	return &oauth2.Config{
+		ClientID: clientID,
+		Scopes:   scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:       base + "/oauth/authorize",
+			DeviceAuthURL: base + "/oauth/authorize_device",
+			TokenURL:      base + "/oauth/token",
+			AuthStyle:     oauth2.AuthStyleInParams,
+		},
+	}
+}
+
+// credentialsTokenSource returns the access token of stored credentials, and
+// refreshes and stores them when the token expires or GitLab rejects it. It is
+// safe for concurrent use.
+type credentialsTokenSource struct {
+	mu     sync.Mutex
+	creds  *credentials
+	client *http.Client
+}
+
+// Token implements oauth2.TokenSource.
+func (s *credentialsTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.creds.Token.Valid() {
+		return s.creds.Token, nil
+	}
+
+	return s.refresh()
+}
+
+// Refresh implements glen.TokenRefresher.
+func (s *credentialsTokenSource) Refresh(rejected string) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Another request already refreshed the rejected token
+	if s.creds.Token.AccessToken != rejected {
+		return s.creds.Token, nil
+	}
+
+	return s.refresh()
+}
+
+// refresh exchanges the refresh token for a new token and stores it, since GitLab
+// refresh tokens can only be used once.
+func (s *credentialsTokenSource) refresh() (*oauth2.Token, error) {
+	if s.creds.Token.RefreshToken == "" {
+		return nil, fmt.Errorf("the token of %s expired, run 'glen login --host %s'", s.creds.Host, s.creds.Host)
+	}
+
+	// Another glen process may have refreshed the token already
+	stored, err := readCredentials(s.creds.Host)
+	if err == nil && stored.Token.AccessToken != s.creds.Token.AccessToken && stored.Token.Valid() {
+		s.creds = stored
+
+		return stored.Token, nil
+	}
+
+	config := oauthConfig(s.creds.Host, s.creds.ClientID, s.creds.Scopes)
+	expired := &oauth2.Token{RefreshToken: s.creds.Token.RefreshToken}
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, s.client)
+
+	token, err := config.TokenSource(ctx, expired).Token()
+	if err != nil {
+		return nil, fmt.Errorf("refresh the token of %s: %w", s.creds.Host, err)
+	}
+
+	s.creds.Token = token
+
+	err = s.creds.write()
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// loadTokenSource returns a token source for the stored credentials of host, which
+// refreshes them with client, or errAPIKeyNotSet if there are none.
+func loadTokenSource(host string, client *http.Client) (*credentialsTokenSource, error) {
+	creds, err := readCredentials(host)
+	if errors.Is(err, errNotLoggedIn) {
+		return nil, errAPIKeyNotSet
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &credentialsTokenSource{creds: creds, client: client}, nil
+}
+
+// resolveAuth returns the API key resolved by resolveAPIKey or, when there is none,
+// a token source for the credentials that 'glen login' stored for host.
+func resolveAuth(apiKey string, p *profile, host string, client *http.Client) (string, oauth2.TokenSource, error) {
+	key, err := resolveAPIKey(apiKey, p)
+	if !errors.Is(err, errAPIKeyNotSet) {
+		return key, nil, err
+	}
+
+	ts, err := loadTokenSource(host, client)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return "", ts, nil
+}
+
+func loginCmd() *cobra.Command {
+	var (
+		host     string   // host is the GitLab instance to log in to
+		clientID string   // clientID is the application ID of the OAuth application
+		scopes   []string // scopes are the OAuth scopes that glen requests
+	)
+
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Logs in to GitLab with your browser",
+		Long: `Login authorizes glen to call the GitLab API as you, using the OAuth 2.0 device
+authorization grant. It prints a code to enter in your browser and stores the
+resulting tokens, readable only by you, in your user config directory.
+
+Glen uses the stored tokens of a host when no API key is set, and refreshes them
+when they expire. The OAuth application must be registered on your GitLab
+instance, with the device authorization grant enabled.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			_, _, err := applyConfig(cmd, ".")
+			if err != nil {
+				slog.Error("failed to load config", "error", err)
+				os.Exit(1)
+			}
+			if host == "" {
+				host = defaultLoginHost
+			}
+			if clientID == "" {
+				fmt.Println(errClientIDNotSet)
+				os.Exit(1)
+			}
+
+			client, err := httpClient(cmd.Flags(), host)
+			if err != nil {
+				slog.Error("failed to create HTTP client", "error", err)
+				os.Exit(1)
+			}
+
+			ctx := context.WithValue(cmd.Context(), oauth2.HTTPClient, client)
+			err = login(ctx, host, clientID, scopes)
+			if err != nil {
+				slog.Error("failed to log in", "host", host, "error", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Logged in to %s\n", host)
+		},
+	}
+
+	cmd.Flags().StringVarP(&host, "host", "H", "", flagLoginHostDesc)
+	cmd.Flags().StringVar(&clientID, "client-id", "", flagClientIDDesc)
+	cmd.Flags().StringSliceVar(&scopes, "scope", []string{"read_api"}, flagScopeDesc)
+
+	return cmd
+}
+
+// login runs the device authorization grant against host and stores the tokens.
+func login(ctx context.Context, host string, clientID string, scopes []string) error {
+	config := oauthConfig(host, clientID, scopes)
+
+	auth, err := config.DeviceAuth(ctx)
+	if err != nil {
+		return fmt.Errorf("start device authorization: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Open %s in your browser and enter the code %s\n", auth.VerificationURI, auth.UserCode)
+	if auth.VerificationURIComplete != "" {
+		fmt.Fprintf(os.Stderr, "Or open %s\n", auth.VerificationURIComplete)
+	}
+
+	token, err := config.DeviceAccessToken(ctx, auth)
+	if err != nil {
+		return fmt.Errorf("wait for authorization: %w", err)
+	}
+
+	creds := &credentials{Host: host, ClientID: clientID, Scopes: scopes, Token: token}
+
+	return creds.write()
+}
+
+func logoutCmd() *cobra.Command {
+	var host string // host is the GitLab instance to log out of
+
+	cmd := &cobra.Command{
+		Use:   "logout",
+		Short: "Revokes and removes the stored tokens of a GitLab host",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			_, _, err := applyConfig(cmd, ".")
+			if err != nil {
+				slog.Error("failed to load config", "error", err)
+				os.Exit(1)
+			}
+			if host == "" {
+				host = defaultLoginHost
+			}
+
+			creds, err := readCredentials(host)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			// Remove the credentials even if GitLab cannot be reached
+			client, err := httpClient(cmd.Flags(), host)
+			if err == nil {
+				err = revoke(cmd.Context(), client, creds)
+			}
+			if err != nil {
+				slog.Warn("failed to revoke token", "host", host, "error", err)
+			}
+
+			err = os.Remove(credentialsPath(host))
+			if err != nil {
+				slog.Error("failed to remove credentials", "host", host, "error", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Logged out of %s\n", host)
+		},
+	}
+
+	cmd.Flags().StringVarP(&host, "host", "H", "", flagLoginHostDesc)
+
+	return cmd
+}
+
+// revoke revokes the access and refresh tokens of creds.
+// https://docs.gitlab.com/ee/api/oauth2.html#revoke-a-token
+func revoke(ctx context.Context, client *http.Client, creds *credentials) error {
+	for _, token := range []string{creds.Token.RefreshToken, creds.Token.AccessToken} {
+		if token == "" {
+			continue
+		}
+
+		err := revokeToken(ctx, client, creds, token)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// revokeToken revokes one access or refresh token of creds.
+func revokeToken(ctx context.Context, client *http.Client, creds *credentials, token string) error {
+	form := url.Values{"client_id": {creds.ClientID}, "token": {token}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+creds.Host+"/oauth/revoke",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("create revoke request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("revoke token: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("revoke token: %s", resp.Status)
+	}
+
+	return nil
+}
+
+func authCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Inspect stored GitLab credentials",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			cmd.Help() //nolint:errcheck,gosec
+		},
+	}
+
+	cmd.AddCommand(authStatusCmd())
+
+	return cmd
+}
+
+func authStatusCmd() *cobra.Command {
+	var host string // host limits the status to one GitLab instance
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Prints the hosts that glen is logged in to and checks their tokens",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			hosts := []string{host}
+			if host == "" {
+				var err error
+				hosts, err = storedHosts()
+				if err != nil {
+					slog.Error("failed to list credentials", "error", err)
+					os.Exit(1)
+				}
+			}
+			if len(hosts) == 0 {
+				fmt.Println("Not logged in to any host. Run 'glen login' to log in")
+			}
+			if os.Getenv("GITLAB_TOKEN") != "" {
+				fmt.Println("GITLAB_TOKEN is set and is used instead of stored credentials")
+			}
+
+			ok := true
+			for _, h := range hosts {
+				ok = printAuthStatus(cmd.Flags(), h) && ok
+			}
+			if !ok {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&host, "host", "H", "", flagAuthHostDesc)
+
+	return cmd
+}
+
+// printAuthStatus prints the stored credentials of host and checks them by getting
+// the current user, refreshing the token if it expired. It reports whether the
+// credentials work.
+func printAuthStatus(fs *pflag.FlagSet, host string) bool {
+	fmt.Println(host)
+
+	client, err := httpClient(fs, host)
+	if err != nil {
+		fmt.Printf("  Error: %s\n", err)
+
+		return false
+	}
+
+	ts, err := loadTokenSource(host, client)
+	if errors.Is(err, errAPIKeyNotSet) {
+		err = fmt.Errorf("%w, run 'glen login --host %s'", errNotLoggedIn, host)
+	}
+	if err != nil {
+		fmt.Printf("  Error: %s\n", err)
+
+		return false
+	}
+
+	fmt.Printf("  Client ID: %s\n", ts.creds.ClientID)
+	fmt.Printf("  Scopes: %s\n", strings.Join(ts.creds.Scopes, ", "))
+
+	user, err := currentUser(host, ts, client)
+	if err != nil {
+		fmt.Printf("  Error: %s\n", err)
+
+		return false
+	}
+
+	fmt.Printf("  Logged in as: %s\n", user)
+	fmt.Printf("  Token expires: %s\n", ts.creds.Token.Expiry.Local().Format(time.RFC1123))
+
+	return true
+}
+
+// currentUser returns the username that the token of ts belongs to.
+func currentUser(host string, ts oauth2.TokenSource, client *http.Client) (string, error) {
+	glc, err := gitlab.NewAuthSourceClient(gitlab.OAuthTokenSource{TokenSource: ts},
+		gitlab.WithBaseURL("https://"+host+"/api/v4"), gitlab.WithHTTPClient(client))
+	if err != nil {
+		return "", fmt.Errorf("create gitlab client: %w", err)
+	}
+
+	user, _, err := glc.Users.CurrentUser()
+	if err != nil {
+		return "", fmt.Errorf("get current user: %w", err)
+	}
+
+	return user.Username, nil
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/lingrino/glen/glen"
+	"github.com/spf13/cobra"
+)
+
+const (
+	flagHostDesc      = "The GitLab host to use, such as gitlab.com or gitlab.example.com"
+	flagFileDesc      = "The file to write the backup to. Defaults to stdout"
+	flagRecipientDesc = "An age public key to encrypt the backup to. Can be repeated"
+	flagBackupRecDesc = "Set recurse to true to also back up every subgroup and project of the group"
+)
+
+func backupCmd() *cobra.Command {
+	var (
+		recurse    bool     // recurse determines if glen also backs up every subgroup and project
+		apiKey     string   // apiKey is the GitLab key that we should use when calling the API
+		host       string   // host is the GitLab instance that holds the group
+		apiURL     string   // apiURL overrides the GitLab API URL
+		file       string   // file is where the backup is written, stdout when empty
+		recipients []string // recipients are age public keys that the backup is encrypted to
+	)
+
+	cmd := &cobra.Command{
+		Use:   "backup GROUP",
+		Short: "Backs up all variables of a GitLab group",
+		Long: `Backup writes every variable of a GitLab group, with full metadata, to a
+versioned JSON archive. With --recurse every subgroup and project of the group
+is included. With --recipient the archive is encrypted using age.
+
+Restore the archive with 'glen restore'.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			p, _, err := applyConfig(cmd, ".")
+			if err != nil {
+				slog.Error("failed to load config", "error", err)
+				os.Exit(1)
+			}
+
+			conn, err := connect(cmd.Flags(), apiKey, p, host)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			ageRecipients, err := parseRecipients(recipients)
+			if err != nil {
+				slog.Error("failed to parse recipients", "error", err)
+				os.Exit(1)
+			}
+
+			backup := glen.NewBackup(host, args[0])
+			backup.Recurse = recurse
+			backup.APIURL = apiURL
+			backup.SetAPIKey(conn.apiKey)
+			backup.TokenSource = conn.tokenSource
+			backup.HTTPClient = conn.client
+
+			err = backup.Init()
+			if err != nil {
+				slog.Error("failed to back up variables", "error", err)
+				os.Exit(1)
+			}
+
+			err = writeBackup(backup, file, ageRecipients)
+			if err != nil {
+				slog.Error("failed to write backup", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVarP(&recurse, "recurse", "r", false, flagBackupRecDesc)
+	cmd.Flags().StringVarP(&apiKey, "api-key", "k", "GITLAB_TOKEN", flagAPIKeyDesc)
+	cmd.Flags().StringVarP(&host, "host", "H", "gitlab.com", flagHostDesc)
+	cmd.Flags().StringVar(&apiURL, "api-url", "", flagAPIURLDesc)
+	cmd.Flags().StringVarP(&file, "file", "f", "", flagFileDesc)
+	cmd.Flags().StringSliceVar(&recipients, "recipient", nil, flagRecipientDesc)
+
+	return cmd
+}
+
+// writeBackup writes the backup to file, or to stdout if file is empty, encrypted
+// to any recipients. Backup files are only readable by the current user.
+func writeBackup(backup *glen.Backup, file string, recipients []age.Recipient) error {
+	var w io.Writer = os.Stdout
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600) //nolint:mnd
+		if err != nil {
+			return fmt.Errorf("create backup file: %w", err)
+		}
+		defer f.Close() //nolint:errcheck
+		w = f
+	}
+
+	err := backup.Write(w, recipients...)
+	if err != nil {
+		return fmt.Errorf("write backup: %w", err)
+	}
+
+	return nil
+}
+
+// parseRecipients parses a list of age public keys.
+func parseRecipients(keys []string) ([]age.Recipient, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	recipients, err := age.ParseRecipients(strings.NewReader(strings.Join(keys, "\n")))
+	if err != nil {
+		return nil, fmt.Errorf("parse recipients: %w", err)
+	}
+
+	return recipients, nil
+}
@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lingrino/glen/glen"
+	"github.com/spf13/pflag"
+)
+
+// cacheDir is the directory, under the user cache directory, where results are stored.
+const cacheDir = "glen"
+
+// resultCache stores the variables of a glen run on disk for a short time, so
+// that shell hooks and direnv do not call the GitLab API on every 'cd'. Results
+// are keyed by the repo directory, its checked out ref and commit, the profile and
+// credentials in use, and the value of every flag that changes them.
+// Cached values are not encrypted, and are readable only by the current user.
+// Expired entries are removed whenever the cache is read or written.
+type resultCache struct {
+	path string
+	ttl  time.Duration
+}
+
+// newResultCache returns the cache entry for the variables selected by fs in
+// directory, as seen with the credentials identified by identity.
+func newResultCache(fs *pflag.FlagSet, directory string, identity string, ttl time.Duration) (*resultCache, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("find cache directory: %w", err)
+	}
+
+	directory, err = filepath.Abs(directory)
+	if err != nil {
+		return nil, fmt.Errorf("find absolute path of %s: %w", directory, err)
+	}
+
+	profile, err := profileName(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(directory))
+
+	// Predefined variables and simulated refs depend on the checked out commit, and
+	// what a token can read depends on who it belongs to
+	fmt.Fprintf(h, "\x00head=%s", headKey(directory))
+	fmt.Fprintf(h, "\x00profile=%s\x00identity=%s", profile, identity)
+
+	fs.VisitAll(func(f *pflag.Flag) {
+		if selectsVariables(f.Name) {
+			fmt.Fprintf(h, "\x00%s=%s", f.Name, f.Value.String())
+		}
+	})
+
+	return &resultCache{
+		path: filepath.Join(base, cacheDir, hex.EncodeToString(h.Sum(nil))+".json"),
+		ttl:  ttl,
+	}, nil
+}
+
+// headKey returns the ref and commit checked out in the git repo in directory, or
+// an empty string if it has no commits.
+func headKey(directory string) string {
+	head, err := (&glen.Repo{LocalPath: directory}).Head()
+	if err != nil {
+		return ""
+	}
+
+	return head.RefName() + "@" + head.SHA
+}
+
+// selectsVariables reports whether the flag name changes which variables glen gets.
+// The other flags only change where and how they are printed, or how glen logs.
+func selectsVariables(name string) bool {
+	switch name {
+	case "directory", "merge", "output", "recipient", "sort", "json-array", "template", "reveal", "reveal-prefix",
+		"cache-ttl", "profile", "verbose", "log-format", "no-daemon":
+		return false
+	default:
+		return true
+	}
+}
+
+// read returns the cached variables, if there are any that have not expired.
+func (c *resultCache) read() (*projectVariables, bool) {
+	c.prune()
+
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return nil, false
+	}
+	if time.Since(info.ModTime()) > c.ttl {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil, false
+	}
+
+	var vars projectVariables
+
+	err = json.Unmarshal(data, &vars)
+	if err != nil {
+		return nil, false
+	}
+
+	return &vars, true
+}
+
+// write stores vars in the cache, replacing the file atomically so that readers
+// never see a partial entry.
+func (c *resultCache) write(vars *projectVariables) error {
+	c.prune()
+
+	data, err := json.Marshal(vars)
+	if err != nil {
+		return fmt.Errorf("marshal cache entry: %w", err)
+	}
+
+	dir := filepath.Dir(c.path)
+
+	err = os.MkdirAll(dir, 0o700) //nolint:mnd
+	if err != nil {
+		return fmt.Errorf("create cache directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return fmt.Errorf("create cache entry: %w", err)
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close() //nolint:errcheck,gosec
+
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+
+	err = os.Rename(f.Name(), c.path)
+	if err != nil {
+		return fmt.Errorf("write cache entry: %w", err)
+	}
+
+	return nil
+}
+
+// prune removes every entry of the cache that has expired, and files left behind
+// by failed writes, so that variables of other repos, refs and flags do not stay
+// on disk. Other files in the cache directory, such as the daemon socket, are kept.
+func (c *resultCache) prune() {
+	dir := filepath.Dir(c.path)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || ext != ".json" && ext != ".tmp" {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) <= c.ttl {
+			continue
+		}
+		os.Remove(filepath.Join(dir, e.Name())) //nolint:errcheck,gosec
+	}
+}
+
+// cachedVariables returns the variables selected by opts for the git repo in
+// directory from the glen serve daemon, if one is running, or else reading them
+// from and writing them to the result cache when opts.cacheTTL is set.
+func (opts *glenOptions) cachedVariables(fs *pflag.FlagSet, directory string) (*projectVariables, error) {
+	if result, ok, err := opts.daemonVariables(fs, directory); ok || err != nil {
+		return result, err
+	}
+
+	if opts.cacheTTL <= 0 {
+		vars, err := opts.variables(fs, directory)
+		if err != nil {
+			return nil, err
+		}
+
+		return &projectVariables{Project: vars.Repo.Path, Variables: vars.Vars}, nil
+	}
+
+	identity, err := opts.authIdentity(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := newResultCache(fs, directory, identity, opts.cacheTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	if result, ok := cache.read(); ok {
+		slog.Debug("using cached variables", "directory", directory, "project", result.Project)
+
+		return result, nil
+	}
+
+	vars, err := opts.variables(fs, directory)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &projectVariables{Project: vars.Repo.Path, Variables: vars.Vars}
+
+	err = cache.write(result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/lingrino/glen/glentest"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewResultCacheKey(t *testing.T) {
+	t.Parallel()
+
+	fs := pflag.NewFlagSet("glen", pflag.ContinueOnError)
+	addGlenFlags(fs, &glenOptions{})
+	fs.String("profile", "", flagProfileDesc)
+
+	dir := glentest.NewRepo(t, nil)
+	path := func(identity string) string {
+		t.Helper()
+
+		cache, err := newResultCache(fs, dir, identity, time.Hour)
+		require.NoError(t, err)
+
+		return cache.path
+	}
+
+	glentest.Commit(t, dir, map[string]string{"README.md": "one"}, "First")
+	first := path("key:a")
+	assert.Equal(t, first, path("key:a"), "same commit")
+	assert.NotEqual(t, first, path("key:b"), "other token")
+
+	repo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("feature"), Create: true}))
+	branch := path("key:a")
+	assert.NotEqual(t, first, branch, "new branch")
+
+	glentest.Commit(t, dir, map[string]string{"README.md": "two"}, "Second")
+	commit := path("key:a")
+	assert.NotEqual(t, branch, commit, "new commit")
+
+	require.NoError(t, fs.Set("profile", "work"))
+	profile := path("key:a")
+	assert.NotEqual(t, commit, profile, "profile flag")
+
+	require.NoError(t, fs.Set("ref", "other"))
+	assert.NotEqual(t, profile, path("key:a"), "ref flag")
+}
+
+func TestResultCachePrune(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+	for name, expired := range map[string]bool{
+		"fresh.json": false, "expired.json": true, "expired.tmp": true, "glen.sock": true,
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte("{}"), 0o600))
+		if expired {
+			require.NoError(t, os.Chtimes(path, old, old))
+		}
+	}
+
+	c := &resultCache{path: filepath.Join(dir, "new.json"), ttl: time.Hour}
+	require.NoError(t, c.write(&projectVariables{Project: "group/project"}))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{"fresh.json", "glen.sock", "new.json"}, names)
+}
+
+func TestAuthIdentity(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("GITLAB_TOKEN", "")
+
+	dir := glentest.NewRepo(t, map[string]string{"origin": "git@gitlab.example.com:group/project.git"})
+
+	_, err := (&glenOptions{apiKey: "GITLAB_TOKEN", remoteName: "origin"}).authIdentity(dir)
+	require.ErrorIs(t, err, errAPIKeyNotSet)
+
+	require.NoError(t, (&credentials{Host: "gitlab.example.com", ClientID: "glen"}).write())
+	login, err := (&glenOptions{apiKey: "GITLAB_TOKEN", remoteName: "origin"}).authIdentity(dir)
+	require.NoError(t, err)
+
+	a, err := (&glenOptions{apiKey: "token-a"}).authIdentity(dir)
+	require.NoError(t, err)
+	b, err := (&glenOptions{apiKey: "token-b"}).authIdentity(dir)
+	require.NoError(t, err)
+	assert.NotEqual(t, a, b)
+	assert.NotEqual(t, login, a)
+}
@@ -0,0 +1,544 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// Config files, from lowest to highest precedence. The repo config is read from
+// the directory of the git repo.
+const (
+	userConfigFile = "glen/config.yaml"
+	repoConfigFile = ".glen.yaml"
+)
+
+// Sources of a setting, as printed by 'glen config show'.
+const (
+	sourceDefault    = "default"
+	sourceUserConfig = "user config"
+	sourceRepoConfig = "repo config"
+	sourceEnv        = "env"
+	sourceFlag       = "flag"
+)
+
+// envPrefix is the prefix of environment variables that override settings, for
+// example GLEN_OUTPUT for --output.
+const envPrefix = "GLEN_"
+
+var (
+	// errAPIKeyNotSet is returned when no API key is set by a flag, environment variable
+	// or profile, and there are no stored credentials.
+	errAPIKeyNotSet = errors.New("GitLab API key not set. Please use --api-key/-k flag, set GITLAB_TOKEN environment variable or run 'glen login'")
+	// errProfileNotFound is returned when the selected profile is not in any config file.
+	errProfileNotFound = errors.New("profile not found")
+)
+
+// config is a glen config file with named profiles and the connection settings of
+// GitLab hosts.
+type config struct {
+	DefaultProfile string                 `yaml:"defaultProfile,omitempty"`
+	Profiles       map[string]*profile    `yaml:"profiles,omitempty"`
+	Hosts          map[string]*hostConfig `yaml:"hosts,omitempty"`
+	HostAliases    map[string]string      `yaml:"hostAliases,omitempty"`
+}
+
+// profile is a named set of settings. Every setting except the token source maps
+// to the flag of the same name.
+type profile struct {
+	Host         string   `yaml:"host,omitempty"`
+	APIURL       string   `yaml:"apiUrl,omitempty"`
+	TokenEnv     string   `yaml:"tokenEnv,omitempty"`
+	TokenFile    string   `yaml:"tokenFile,omitempty"`
+	TokenCommand string   `yaml:"tokenCommand,omitempty"`
+	RemoteName   string   `yaml:"remoteName,omitempty"`
+	Recurse      *bool    `yaml:"recurse,omitempty"`
+	Environment  string   `yaml:"environment,omitempty"`
+	Output       string   `yaml:"output,omitempty"`
+	Include      []string `yaml:"include,omitempty"`
+	Exclude      []string `yaml:"exclude,omitempty"`
+	IncludeRegex []string `yaml:"includeRegex,omitempty"`
+	ExcludeRegex []string `yaml:"excludeRegex,omitempty"`
+	StripPrefix  string   `yaml:"stripPrefix,omitempty"`
+	AddPrefix    string   `yaml:"addPrefix,omitempty"`
+	CacheTTL     string   `yaml:"cacheTtl,omitempty"`
+	ClientID     string   `yaml:"clientId,omitempty"`
+
+	name string // name is the name the profile was selected by
+}
+
+// flagValues returns the settings of the profile that are set, keyed by flag name.
+// List settings have one value per element.
+func (p *profile) flagValues() map[string][]string {
+	values := map[string][]string{
+		"host":          {p.Host},
+		"api-url":       {p.APIURL},
+		"remote-name":   {p.RemoteName},
+		"environment":   {p.Environment},
+		"output":        {p.Output},
+		"strip-prefix":  {p.StripPrefix},
+		"add-prefix":    {p.AddPrefix},
+		"cache-ttl":     {p.CacheTTL},
+		"client-id":     {p.ClientID},
+		"include":       p.Include,
+		"exclude":       p.Exclude,
+		"include-regex": p.IncludeRegex,
+		"exclude-regex": p.ExcludeRegex,
+	}
+	if p.Recurse != nil {
+		values["recurse"] = []string{strconv.FormatBool(*p.Recurse)}
+	}
+
+	for k, v := range values {
+		if len(v) == 0 || (len(v) == 1 && v[0] == "") {
+			delete(values, k)
+		}
+	}
+
+	return values
+}
+
+// merge overrides the settings of p with those set in o.
+func (p *profile) merge(o *profile) {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&p.Host, o.Host}, {&p.APIURL, o.APIURL}, {&p.TokenEnv, o.TokenEnv},
+		{&p.TokenFile, o.TokenFile}, {&p.TokenCommand, o.TokenCommand},
+		{&p.RemoteName, o.RemoteName}, {&p.Environment, o.Environment}, {&p.Output, o.Output},
+		{&p.StripPrefix, o.StripPrefix}, {&p.AddPrefix, o.AddPrefix}, {&p.CacheTTL, o.CacheTTL},
+		{&p.ClientID, o.ClientID},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
+	}
+	if o.Recurse != nil {
+		p.Recurse = o.Recurse
+	}
+	if o.Include != nil {
+		p.Include = o.Include
+	}
+	if o.Exclude != nil {
+		p.Exclude = o.Exclude
+	}
+	if o.IncludeRegex != nil {
+		p.IncludeRegex = o.IncludeRegex
+	}
+	if o.ExcludeRegex != nil {
+		p.ExcludeRegex = o.ExcludeRegex
+	}
+}
+
+// mergeFrom overrides the settings of p with those set in o, and records source
+// as the source of every flag that o sets.
+func (p *profile) mergeFrom(o *profile, source string, sources map[string]string) {
+	p.merge(o)
+	for flag := range o.flagValues() {
+		sources[flag] = source
+	}
+	if o.tokenSource() != "" {
+		sources["api-key"] = source
+	}
+}
+
+// clearUserOnly clears the settings that decide which host glen sends the token
+// to and how it gets the token, which only the user config may set, so that a
+// cloned repo cannot read or run anything to steal it. It returns the names of
+// the settings that were set.
+func (p *profile) clearUserOnly() []string {
+	var cleared []string
+	for _, f := range []struct {
+		name  string
+		value *string
+	}{
+		{"host", &p.Host}, {"apiUrl", &p.APIURL}, {"clientId", &p.ClientID},
+		{"tokenEnv", &p.TokenEnv}, {"tokenFile", &p.TokenFile}, {"tokenCommand", &p.TokenCommand},
+	} {
+		if *f.value != "" {
+			cleared = append(cleared, f.name)
+			*f.value = ""
+		}
+	}
+
+	return cleared
+}
+
+// token returns the API key from the token source of the profile, if it has one.
+func (p *profile) token() (string, error) {
+	switch {
+	case p.TokenEnv != "":
+		return os.Getenv(p.TokenEnv), nil
+	case p.TokenFile != "":
+		data, err := os.ReadFile(expandHome(p.TokenFile))
+		if err != nil {
+			return "", fmt.Errorf("read token file: %w", err)
+		}
+
+		return strings.TrimSpace(string(data)), nil
+	case p.TokenCommand != "":
+		out, err := exec.Command("sh", "-c", p.TokenCommand).Output() //nolint:gosec,noctx
+		if err != nil {
+			return "", fmt.Errorf("run token command: %w", err)
+		}
+
+		return strings.TrimSpace(string(out)), nil
+	default:
+		return "", nil
+	}
+}
+
+// tokenSource describes where the profile reads its token from, without the token.
+func (p *profile) tokenSource() string {
+	switch {
+	case p.TokenEnv != "":
+		return "env " + p.TokenEnv
+	case p.TokenFile != "":
+		return "file " + p.TokenFile
+	case p.TokenCommand != "":
+		return "command " + p.TokenCommand
+	default:
+		return ""
+	}
+}
+
+// userConfigDir returns the user config directory, which is $XDG_CONFIG_HOME or
+// ~/.config.
+func userConfigDir() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+
+	return dir
+}
+
+// userConfigPath returns the path of the user config file, which is
+// $XDG_CONFIG_HOME/glen/config.yaml or ~/.config/glen/config.yaml.
+func userConfigPath() string {
+	return filepath.Join(userConfigDir(), userConfigFile)
+}
+
+// readConfig reads a config file, returning an empty config if it does not exist.
+func readConfig(path string) (*config, error) {
+	c := &config{}
+
+	data, err := os.ReadFile(path) //nolint:gosec
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config %s: %w", path, err)
+	}
+
+	err = yaml.Unmarshal(data, c)
+	if err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// loadProfile reads the user and repo config files and returns the selected profile,
+// with the repo config overriding the user config. The profile is chosen by the
+// --profile flag, GLEN_PROFILE, or the defaultProfile of the config files, falling
+// back to a profile named "default". Each setting of the profile is returned with
+// the config file it came from. The host, API URL, OAuth client and token source
+// are only read from the user config.
+func loadProfile(name string, directory string) (*profile, map[string]string, error) {
+	user, err := readConfig(userConfigPath())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	repo, err := readConfig(filepath.Join(directory, repoConfigFile))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	explicit := name != ""
+	if !explicit {
+		name = defaultProfileName(user, repo)
+	}
+
+	p := &profile{name: name}
+	sources := make(map[string]string)
+
+	found := false
+	for _, c := range []struct {
+		config *config
+		source string
+	}{{user, sourceUserConfig}, {repo, sourceRepoConfig}} {
+		cp, ok := c.config.Profiles[name]
+		if !ok || cp == nil {
+			continue
+		}
+		found = true
+
+		if c.source == sourceRepoConfig {
+			cp = repoProfile(cp, filepath.Join(directory, repoConfigFile))
+		}
+
+		p.mergeFrom(cp, c.source, sources)
+	}
+
+	if !found && explicit {
+		return nil, nil, fmt.Errorf("%w: %s", errProfileNotFound, name)
+	}
+
+	return p, sources, nil
+}
+
+// defaultProfileName returns the defaultProfile of the repo or user config, or
+// "default" if neither sets one.
+func defaultProfileName(user *config, repo *config) string {
+	switch {
+	case repo.DefaultProfile != "":
+		return repo.DefaultProfile
+	case user.DefaultProfile != "":
+		return user.DefaultProfile
+	default:
+		return "default"
+	}
+}
+
+// repoProfile returns a copy of a profile from the repo config at path without the
+// settings that only the user config may set, warning about any that were set.
+func repoProfile(p *profile, path string) *profile {
+	cp := *p
+	cleared := cp.clearUserOnly()
+	if len(cleared) > 0 {
+		slog.Warn("ignoring settings that only the user config can set", "config", path, "settings", cleared)
+	}
+
+	return &cp
+}
+
+// applyConfig sets every flag of cmd that was not set on the command line from,
+// in order of precedence, a GLEN_* environment variable or the selected profile.
+// It returns the profile and the source of every flag.
+func applyConfig(cmd *cobra.Command, directory string) (*profile, map[string]string, error) {
+	name, err := profileName(cmd.Flags())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p, configSources, err := loadProfile(name, directory)
+	if err != nil {
+		return nil, nil, err
+	}
+	values := p.flagValues()
+
+	sources := make(map[string]string)
+
+	var setErr error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		var err error
+
+		sources[f.Name], err = applyFlag(f, values[f.Name], configSources[f.Name])
+		if err != nil && setErr == nil {
+			setErr = fmt.Errorf("invalid value for %s from %s: %w", f.Name, sources[f.Name], err)
+		}
+	})
+	if setErr != nil {
+		return nil, nil, setErr
+	}
+
+	return p, sources, nil
+}
+
+// applyFlag sets f, unless it was set on the command line, from its GLEN_*
+// environment variable or else from configValue, which came from configSource.
+// It returns where the value of f came from.
+func applyFlag(f *pflag.Flag, configValue []string, configSource string) (string, error) {
+	if f.Changed {
+		return sourceFlag, nil
+	}
+
+	if env, ok := os.LookupEnv(envName(f.Name)); ok {
+		return sourceEnv, f.Value.Set(env) //nolint:wrapcheck
+	}
+
+	for _, value := range configValue {
+		err := f.Value.Set(value)
+		if err != nil {
+			return configSource, err //nolint:wrapcheck
+		}
+	}
+
+	// The API key is not set by the profile directly but by its token source
+	if configSource != "" {
+		return configSource, nil
+	}
+
+	return sourceDefault, nil
+}
+
+// profileName returns the profile selected by the --profile flag in fs or by
+// GLEN_PROFILE, or an empty string to select the default profile.
+func profileName(fs *pflag.FlagSet) (string, error) {
+	name, err := fs.GetString("profile")
+	if err != nil {
+		return "", fmt.Errorf("get profile flag: %w", err)
+	}
+	if !fs.Changed("profile") {
+		if env, ok := os.LookupEnv(envPrefix + "PROFILE"); ok {
+			name = env
+		}
+	}
+
+	return name, nil
+}
+
+// envName returns the environment variable that overrides a flag.
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// resolveAPIKey returns the API key passed as a flag, falling back to the
+// GITLAB_TOKEN environment variable and then to the token source of the profile.
+func resolveAPIKey(apiKey string, p *profile) (string, error) {
+	if apiKey == "GITLAB_TOKEN" {
+		apiKey = os.Getenv("GITLAB_TOKEN")
+	}
+
+	if apiKey == "" && p != nil {
+		var err error
+		apiKey, err = p.token()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if apiKey == "" {
+		return "", errAPIKeyNotSet
+	}
+
+	return apiKey, nil
+}
+
+// expandHome replaces a leading ~ in path with the home directory.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, path[2:])
+}
+
+func configCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect glen configuration",
+		Long: `Glen reads settings from a user config file at ~/.config/glen/config.yaml
+and from a repo config file at .glen.yaml in your git repo. Both hold named
+profiles, selected with --profile, GLEN_PROFILE or defaultProfile, and a
+profile named 'default' is used when none is selected.
+
+Settings are applied with the following precedence: flags, then GLEN_*
+environment variables (such as GLEN_OUTPUT), then the repo config, then the
+user config. The host, apiUrl, clientId and token source settings are only
+read from the user config, so that a repo cannot send your token to another
+host or run commands to read it.
+
+Example config:
+
+  defaultProfile: work
+  profiles:
+    work:
+      host: gitlab.example.com
+      apiUrl: https://gitlab-api.example.com/api/v4
+      tokenCommand: pass show gitlab/work
+      recurse: true
+      environment: production
+      output: table
+      include: ["AWS_*"]
+      exclude: ["DEPLOY_*"]
+      stripPrefix: AWS_`,
+		Args: cobra.NoArgs,
+	}
+
+	cmd.AddCommand(configShowCmd())
+
+	return cmd
+}
+
+func configShowCmd() *cobra.Command {
+	opts := &glenOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "show",
+		Short: "Prints the effective settings and where they come from",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			directory := configDirectory(opts.directories)
+
+			p, sources, err := applyConfig(cmd, directory)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("# user config: %s\n", userConfigPath())
+			fmt.Printf("# repo config: %s\n", filepath.Join(directory, repoConfigFile))
+			fmt.Printf("# profile: %s\n", p.name)
+
+			flags := make([]*pflag.Flag, 0)
+			cmd.Flags().VisitAll(func(f *pflag.Flag) {
+				switch f.Name {
+				case "help", "profile", "verbose", "log-format":
+					// These flags are not settings of a profile
+				default:
+					flags = append(flags, f)
+				}
+			})
+			sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+
+			for _, f := range flags {
+				value := f.Value.String()
+				if f.Name == "api-key" {
+					value = describeAPIKey(opts.apiKey, p)
+				}
+				fmt.Printf("%s: %s # %s\n", f.Name, value, sources[f.Name])
+			}
+		},
+	}
+
+	addGlenFlags(cmd.Flags(), opts)
+
+	return cmd
+}
+
+// describeAPIKey describes where the API key comes from without printing it.
+func describeAPIKey(apiKey string, p *profile) string {
+	switch {
+	case apiKey != "GITLAB_TOKEN":
+		return "<set>"
+	case os.Getenv("GITLAB_TOKEN") != "":
+		return "<set from env GITLAB_TOKEN>"
+	case p.tokenSource() != "":
+		return "<set from " + p.tokenSource() + ">"
+	default:
+		return "<not set>"
+	}
+}
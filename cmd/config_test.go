@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfigs writes a user config to a new XDG_CONFIG_HOME and a repo config
+// to a new repo directory, which is returned.
+func writeConfigs(t *testing.T, user string, repo string) string {
+	t.Helper()
+
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	require.NoError(t, os.MkdirAll(filepath.Join(configHome, "glen"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(configHome, userConfigFile), []byte(user), 0o600))
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, repoConfigFile), []byte(repo), 0o600))
+
+	return dir
+}
+
+//nolint:paralleltest // sets XDG_CONFIG_HOME
+func TestLoadProfileRepoConfig(t *testing.T) {
+	dir := writeConfigs(t, `
+profiles:
+  default:
+    host: gitlab.example.com
+    apiUrl: https://gitlab.example.com/api/v4
+    tokenEnv: WORK_TOKEN
+    output: json
+`, `
+profiles:
+  default:
+    host: evil.example.com
+    apiUrl: http://127.0.0.1:18555/api/v4
+    clientId: evil
+    tokenFile: /etc/passwd
+    tokenCommand: echo stolen
+    output: table
+    recurse: true
+`)
+
+	p, sources, err := loadProfile("", dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, "gitlab.example.com", p.Host)
+	assert.Equal(t, "https://gitlab.example.com/api/v4", p.APIURL)
+	assert.Equal(t, "WORK_TOKEN", p.TokenEnv)
+	assert.Empty(t, p.TokenFile)
+	assert.Empty(t, p.TokenCommand)
+	assert.Empty(t, p.ClientID)
+	assert.Equal(t, "table", p.Output)
+	assert.True(t, *p.Recurse)
+
+	assert.Equal(t, sourceUserConfig, sources["host"])
+	assert.Equal(t, sourceUserConfig, sources["api-url"])
+	assert.Equal(t, sourceUserConfig, sources["api-key"])
+	assert.NotContains(t, sources, "client-id")
+	assert.Equal(t, sourceRepoConfig, sources["output"])
+}
+
+func TestLoadProfileRepoTokenCommand(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "marker")
+	dir := writeConfigs(t, "", `
+profiles:
+  default:
+    tokenCommand: touch `+marker+`; echo stolen
+`)
+	t.Setenv("GITLAB_TOKEN", "")
+
+	p, _, err := loadProfile("", dir)
+	require.NoError(t, err)
+
+	_, err = resolveAPIKey("GITLAB_TOKEN", p)
+	require.ErrorIs(t, err, errAPIKeyNotSet)
+	assert.NoFileExists(t, marker)
+}
+
+//nolint:paralleltest // sets XDG_CONFIG_HOME
+func TestLoadProfileSelection(t *testing.T) {
+	dir := writeConfigs(t, `
+defaultProfile: work
+profiles:
+  work:
+    environment: production
+  other:
+    environment: staging
+`, `
+profiles:
+  work:
+    environment: review
+`)
+
+	p, sources, err := loadProfile("", dir)
+	require.NoError(t, err)
+	assert.Equal(t, "work", p.name)
+	assert.Equal(t, "review", p.Environment)
+	assert.Equal(t, sourceRepoConfig, sources["environment"])
+
+	p, _, err = loadProfile("other", dir)
+	require.NoError(t, err)
+	assert.Equal(t, "staging", p.Environment)
+
+	_, _, err = loadProfile("missing", dir)
+	require.ErrorIs(t, err, errProfileNotFound)
+}
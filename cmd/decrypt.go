@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/lingrino/glen/glen"
+	"github.com/spf13/cobra"
+)
+
+const (
+	flagDecryptOutputDesc   = "One of 'export', 'json', 'table', 'template'. Default 'export', which can be executed to export variables"
+	flagDecryptIdentityDesc = "An age identity file used to decrypt the file. Defaults to SOPS_AGE_KEY_FILE, or the keys in SOPS_AGE_KEY"
+)
+
+// errNoIdentity is returned when decrypting without --identity, SOPS_AGE_KEY_FILE or SOPS_AGE_KEY.
+var errNoIdentity = errors.New("set --identity, SOPS_AGE_KEY_FILE or SOPS_AGE_KEY to decrypt the file")
+
+func decryptCmd() *cobra.Command {
+	opts := &glenOptions{}
+	var identity string // identity is an age identity file that decrypts the file
+
+	cmd := &cobra.Command{
+		Use:   "decrypt FILE",
+		Short: "Prints the variables of an encrypted file",
+		Long: `Decrypt reads a file written with '--output sops-yaml', 'sops-dotenv' or 'age'
+and prints its variables in another output format, without calling GitLab. Use
+'-' to read the file from stdin.
+
+SOPS files written by sops itself can be decrypted too, as long as they are
+encrypted with age and nest values no more than one level deep.`,
+		Example: `  glen -o sops-yaml --recipient age1... > secrets.enc.yaml
+  glen decrypt -i key.txt secrets.enc.yaml
+  eval $(SOPS_AGE_KEY_FILE=key.txt glen decrypt secrets.enc.yaml)`,
+		Args: cobra.ExactArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			outOpts, err := opts.outputOptions()
+			if err != nil {
+				slog.Error("failed to set up the output", "error", err)
+				os.Exit(1)
+			}
+
+			identities, err := decryptIdentities(identity)
+			if err != nil {
+				slog.Error("failed to read identities", "error", err)
+				os.Exit(1)
+			}
+
+			snapshot, err := readSnapshotFile(args[0], identities)
+			if err != nil {
+				slog.Error("failed to decrypt file", "file", args[0], "error", err)
+				os.Exit(1)
+			}
+
+			projects := snapshotProjects(snapshot)
+			switch len(projects) {
+			case 0:
+				output(os.Stdout, &projectVariables{}, opts.outputFormat, outOpts)
+			case 1:
+				output(os.Stdout, projects[0], opts.outputFormat, outOpts)
+			default:
+				outputProjects(os.Stdout, projects, opts.outputFormat, outOpts)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.outputFormat, "output", "o", "export", flagDecryptOutputDesc)
+	cmd.Flags().StringVarP(&identity, "identity", "i", "", flagDecryptIdentityDesc)
+	cmd.Flags().BoolVar(&opts.reveal, "reveal", false, flagRevealDesc)
+	cmd.Flags().IntVar(&opts.revealPrefix, "reveal-prefix", 0, flagRevealPrefixDesc)
+	cmd.Flags().StringVar(&opts.sort, "sort", string(glen.SortByKey), flagSortDesc)
+	cmd.Flags().BoolVar(&opts.jsonArray, "json-array", false, flagJSONArrayDesc)
+	cmd.Flags().StringVar(&opts.template, "template", "", flagTemplateDesc)
+
+	return cmd
+}
+
+// decryptIdentities returns the identities in identityFile, or where sops looks
+// for them if it is empty.
+func decryptIdentities(identityFile string) ([]age.Identity, error) {
+	if identityFile == "" {
+		identityFile = os.Getenv("SOPS_AGE_KEY_FILE")
+	}
+	if identityFile != "" {
+		return readIdentities(expandHome(identityFile))
+	}
+
+	keys := os.Getenv("SOPS_AGE_KEY")
+	if keys == "" {
+		return nil, errNoIdentity
+	}
+
+	identities, err := age.ParseIdentities(strings.NewReader(keys))
+	if err != nil {
+		return nil, fmt.Errorf("parse SOPS_AGE_KEY: %w", err)
+	}
+
+	return identities, nil
+}
+
+// readSnapshotFile reads and decrypts the snapshot in file, or stdin if file is "-".
+func readSnapshotFile(file string, identities []age.Identity) (*glen.Snapshot, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file) //nolint:gosec
+		if err != nil {
+			return nil, fmt.Errorf("open file: %w", err)
+		}
+		defer f.Close() //nolint:errcheck
+		r = f
+	}
+
+	snapshot, err := glen.ReadSnapshot(r, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// snapshotProjects returns the variables of every project in the snapshot.
+func snapshotProjects(snapshot *glen.Snapshot) []*projectVariables {
+	projects := make([]*projectVariables, 0, len(snapshot.Projects))
+	for _, p := range snapshot.Projects {
+		vars := make(map[string]glen.Variable, len(p.Variables))
+		for _, v := range p.Variables {
+			vars[v.Key] = v
+		}
+		projects = append(projects, &projectVariables{Project: p.Project, Variables: vars})
+	}
+
+	return projects
+}
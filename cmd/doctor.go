@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lingrino/glen/glen"
+	"github.com/spf13/cobra"
+)
+
+const flagDoctorDirectoryDesc = "The directory where your git repo lives. Defaults to your current working directory"
+
+func doctorCmd() *cobra.Command {
+	var (
+		apiKey     string // apiKey is the GitLab key that we should use when calling the API
+		directory  string // directory is the path of the git repo to diagnose
+		remoteName string // remoteName is the name of the GitLab remote in your git repo
+		host       string // host overrides the GitLab host from the remote when calling the API
+		apiURL     string // apiURL overrides the GitLab API URL
+	)
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnoses why glen cannot read the variables of a repo",
+		Long: `Doctor prints how glen understands your git repo and checks everything that
+glen needs to read its variables: that the GitLab API can be reached, that your
+token is valid, unexpired and has the api or read_api scope, and that you have
+the Maintainer role on the project and each of its groups. Doctor exits with a
+non-zero status if any check fails.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			p, _, err := applyConfig(cmd, directory)
+			if err != nil {
+				printCheck(glen.Check{Name: "Config", Detail: err.Error()})
+				os.Exit(1)
+			}
+
+			repo, err := openRepo(directory, remoteName, host)
+			if err != nil {
+				printCheck(glen.Check{Name: "Repo", Detail: err.Error()})
+				os.Exit(1)
+			}
+			printRepo(repo)
+
+			client, err := httpClient(cmd.Flags(), repo.BaseURL)
+			if err != nil {
+				printCheck(glen.Check{Name: "HTTP client", Detail: err.Error()})
+				os.Exit(1)
+			}
+
+			key, tokenSource, err := resolveAuth(apiKey, p, repo.BaseURL, client)
+			if err != nil {
+				printCheck(glen.Check{Name: "Token", Detail: err.Error()})
+				os.Exit(1)
+			}
+
+			doctor := glen.NewDoctor(repo)
+			doctor.APIURL = apiURL
+			doctor.SetAPIKey(key)
+			doctor.TokenSource = tokenSource
+			doctor.HTTPClient = client
+			if !runDoctor(doctor) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&apiKey, "api-key", "k", "GITLAB_TOKEN", flagAPIKeyDesc)
+	cmd.Flags().StringVarP(&directory, "directory", "d", ".", flagDoctorDirectoryDesc)
+	cmd.Flags().StringVarP(&remoteName, "remote-name", "n", "origin", flagRemoteNameDesc)
+	cmd.Flags().StringVar(&host, "host", "", flagAPIHostDesc)
+	cmd.Flags().StringVar(&apiURL, "api-url", "", flagAPIURLDesc)
+
+	return cmd
+}
+
+// runDoctor runs the checks of doctor, prints them and reports whether they all passed.
+func runDoctor(doctor *glen.Doctor) bool {
+	err := doctor.Init()
+	if err != nil {
+		printCheck(glen.Check{Name: "API", Detail: err.Error()})
+
+		return false
+	}
+	for _, c := range doctor.Checks {
+		printCheck(c)
+	}
+
+	return doctor.OK()
+}
+
+// printRepo prints the parsed repo as a passed check.
+func printRepo(repo *glen.Repo) {
+	printCheck(glen.Check{Name: "Repo", OK: true, Detail: "remote " + repo.RemoteName + " is " + repo.RedactedRemoteURL()})
+	fmt.Printf("      BaseURL: %s\n", repo.BaseURL)
+	fmt.Printf("      Path:    %s\n", repo.Path)
+	fmt.Printf("      Groups:  %s\n", strings.Join(repo.Groups, ", "))
+}
+
+// printCheck prints the result of a check as one line of the doctor report.
+func printCheck(c glen.Check) {
+	status := "FAIL"
+	if c.OK {
+		status = "PASS"
+	}
+	fmt.Printf("%s  %s: %s\n", status, c.Name, c.Detail)
+}
@@ -0,0 +1,315 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lingrino/glen/glen"
+	"github.com/spf13/cobra"
+)
+
+// Environment variables that record what the shell hook loaded. hookDirEnv is the
+// repo the variables were loaded from, and hookKeysEnv is the keys glen set, each
+// with a fingerprint of the value it was set to.
+const (
+	hookDirEnv  = "GLEN_HOOK_DIR"
+	hookKeysEnv = "GLEN_HOOK_KEYS"
+)
+
+// errRepoNotAllowed is returned when the shell hook enters a repo that is not allowed.
+var errRepoNotAllowed = errors.New("repo is not allowed, run 'glen allow' to load its variables")
+
+// defaultHookCacheTTL is how long the shell hook reuses the variables of a repo.
+const defaultHookCacheTTL = time.Minute
+
+// hookShell is a shell that glen can print a hook for. Shells that only have a
+// hook script, like direnv, have no export and unset.
+type hookShell struct {
+	script string // script is the hook, where %[1]s is the quoted path to glen
+	export func(key string, value string) string
+	unset  func(key string) string
+}
+
+// hookShells returns the shells that glen can print a hook for, keyed by name.
+func hookShells() map[string]hookShell {
+	return map[string]hookShell{
+		"bash":   {script: bashHook, export: posixExport, unset: posixUnset},
+		"zsh":    {script: zshHook, export: posixExport, unset: posixUnset},
+		"fish":   {script: fishHook, export: fishExport, unset: fishUnset},
+		"direnv": {script: direnvHook},
+	}
+}
+
+const bashHook = `_glen_hook() {
+  local previous_exit_status=$?
+  if [[ "${_GLEN_PWD:-}" != "$PWD" ]]; then
+    _GLEN_PWD=$PWD
+    eval "$(%[1]s hook-env bash)"
+  fi
+  return $previous_exit_status
+}
+if [[ ";${PROMPT_COMMAND[*]:-};" != *";_glen_hook;"* ]]; then
+  PROMPT_COMMAND="_glen_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+`
+
+const zshHook = `_glen_hook() {
+  if [[ "${_GLEN_PWD:-}" != "$PWD" ]]; then
+    _GLEN_PWD=$PWD
+    eval "$(%[1]s hook-env zsh)"
+  fi
+}
+typeset -ag precmd_functions
+if (( ! ${precmd_functions[(I)_glen_hook]} )); then
+  precmd_functions=(_glen_hook $precmd_functions)
+fi
+`
+
+const fishHook = `function __glen_hook --on-variable PWD
+    %[1]s hook-env fish | source
+end
+__glen_hook
+`
+
+const direnvHook = `use_glen() {
+  local glen_env
+  glen_env=$(%[1]s --cache-ttl "${GLEN_CACHE_TTL:-1m}" --output export "$@") || return
+  eval "$glen_env"
+  watch_file .glen.yaml
+}
+`
+
+func hookCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:       "hook SHELL",
+		Short:     "Prints a shell hook that loads variables when entering a repo",
+		ValidArgs: []string{"bash", "zsh", "fish", "direnv"},
+		Long: `Prints a hook for bash, zsh or fish that exports the variables of a GitLab
+repo when you enter it and unsets them when you leave. Only the variables that
+glen set are unset, and variables that you already defined, or changed after
+entering the repo, are left alone. Add the hook to your shell's startup file:
+
+  eval "$(glen hook bash)"     # ~/.bashrc
+  eval "$(glen hook zsh)"      # ~/.zshrc
+  glen hook fish | source      # ~/.config/fish/config.fish
+
+The hook only loads variables in repos that you allowed with 'glen allow', and
+a repo has to be allowed again when its .glen.yaml changes. Variables whose
+names are not valid shell names are skipped.
+
+The hook is configured with glen config files and GLEN_* environment variables,
+and reuses the variables of a repo for a minute unless GLEN_CACHE_TTL is set.
+
+'glen hook direnv' instead prints a use_glen function for direnv. Add it to
+~/.config/direnv/direnvrc and put 'use glen' in the .envrc of a repo. Any
+arguments to 'use glen' are passed to glen.
+
+  eval "$(glen hook direnv)"   # ~/.config/direnv/direnvrc
+  use glen -r                  # .envrc`,
+		Args: cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		Run: func(_ *cobra.Command, args []string) {
+			exe, err := os.Executable()
+			if err != nil {
+				slog.Error("failed to find the glen executable", "error", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf(hookShells()[args[0]].script, posixQuote(exe))
+		},
+	}
+
+	return cmd
+}
+
+func hookEnvCmd() *cobra.Command {
+	opts := &glenOptions{}
+
+	cmd := &cobra.Command{
+		Use:    "hook-env SHELL",
+		Short:  "Prints the commands the shell hook evaluates",
+		Hidden: true,
+		Args:   cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			shell, ok := hookShells()[args[0]]
+			if !ok || shell.export == nil {
+				slog.Error("shell is not supported", "shell", args[0])
+				os.Exit(1)
+			}
+
+			dir, err := os.Getwd()
+			if err != nil {
+				slog.Error("failed to get the working directory", "error", err)
+				os.Exit(1)
+			}
+
+			root := gitRoot(dir)
+			if root == os.Getenv(hookDirEnv) {
+				return
+			}
+
+			fmt.Print(hookEnv(cmd, opts, shell, root))
+		},
+	}
+
+	addGlenFlags(cmd.Flags(), opts)
+	cmd.Flags().Lookup("cache-ttl").DefValue = defaultHookCacheTTL.String()
+	opts.cacheTTL = defaultHookCacheTTL
+
+	return cmd
+}
+
+// hookEnv returns the commands that unset the variables glen set for the previous
+// repo and, if root is not empty, export the variables of the repo at root.
+func hookEnv(cmd *cobra.Command, opts *glenOptions, shell hookShell, root string) string {
+	var out strings.Builder
+
+	unset := hookLeave(&out, shell)
+
+	if root == "" {
+		out.WriteString(shell.unset(hookDirEnv))
+		out.WriteString(shell.unset(hookKeysEnv))
+
+		return out.String()
+	}
+
+	// Enter the new repo, recording it even if loading fails so the hook does not
+	// retry in every subdirectory
+	out.WriteString(shell.export(hookDirEnv, root))
+
+	vars, err := hookVariables(cmd, opts, root)
+	if err != nil {
+		slog.Warn("failed to load variables", "repo", root, "error", err)
+		out.WriteString(shell.unset(hookKeysEnv))
+
+		return out.String()
+	}
+
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var set []string
+	for _, key := range keys {
+		if _, defined := os.LookupEnv(key); defined && !unset[key] {
+			continue
+		}
+		if !glen.ValidVariableName(key) {
+			slog.Warn("skipping variable with an invalid name", "key", key)
+
+			continue
+		}
+		out.WriteString(shell.export(key, vars[key].Value))
+		set = append(set, key+":"+vars[key].Fingerprint())
+	}
+	out.WriteString(shell.export(hookKeysEnv, strings.Join(set, ",")))
+
+	return out.String()
+}
+
+// hookLeave writes the commands that unset the variables glen set for the previous
+// repo to out, keeping variables the user changed since, and returns their keys.
+func hookLeave(out *strings.Builder, shell hookShell) map[string]bool {
+	unset := make(map[string]bool)
+	for key, fingerprint := range parseHookKeys(os.Getenv(hookKeysEnv)) {
+		value, ok := os.LookupEnv(key)
+		if ok && (glen.Variable{Value: value}).Fingerprint() == fingerprint {
+			out.WriteString(shell.unset(key))
+			unset[key] = true
+		}
+	}
+
+	return unset
+}
+
+// hookVariables returns the variables of the repo at root, with settings from
+// the config files and environment. Only repos allowed with 'glen allow' are
+// loaded, so that entering a cloned repo does not read its config or call GitLab.
+func hookVariables(cmd *cobra.Command, opts *glenOptions, root string) (map[string]glen.Variable, error) {
+	allowed, err := isAllowed(root)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, errRepoNotAllowed
+	}
+
+	opts.profile, _, err = applyConfig(cmd, root)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := opts.cachedVariables(cmd.Flags(), root)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Variables, nil
+}
+
+// gitRoot returns the root of the git repo that contains dir, and an empty
+// string if dir is not in a git repo.
+func gitRoot(dir string) string {
+	for {
+		_, err := os.Stat(filepath.Join(dir, ".git"))
+		if err == nil {
+			return dir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// parseHookKeys parses the value of hookKeysEnv into fingerprints keyed by variable
+// key. Keys that are not valid variable names are left out.
+func parseHookKeys(value string) map[string]string {
+	keys := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		key, fingerprint, ok := strings.Cut(entry, ":")
+		if ok && glen.ValidVariableName(key) {
+			keys[key] = fingerprint
+		}
+	}
+
+	return keys
+}
+
+// posixQuote quotes s for bash and zsh.
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func posixExport(key string, value string) string {
+	return fmt.Sprintf("export %s=%s\n", key, posixQuote(value))
+}
+
+func posixUnset(key string) string {
+	return fmt.Sprintf("unset %s\n", key)
+}
+
+// fishQuote quotes s for fish, where only backslashes and single quotes are special
+// inside single quotes.
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+func fishExport(key string, value string) string {
+	return fmt.Sprintf("set -gx %s %s\n", key, fishQuote(value))
+}
+
+func fishUnset(key string) string {
+	return fmt.Sprintf("set -e %s\n", key)
+}
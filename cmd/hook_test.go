@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lingrino/glen/glen"
+	"github.com/lingrino/glen/glentest"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHookKeys(t *testing.T) {
+	t.Parallel()
+
+	got := parseHookKeys("FOO:abc,BAR_2:def,$(id):ghi,BAD KEY:jkl,NOFINGERPRINT")
+	assert.Equal(t, map[string]string{"FOO": "abc", "BAR_2": "def"}, got)
+}
+
+// newTestHook returns a command with the glen flags, its options and a new repo,
+// with a new config and cache directory, a token and without the daemon.
+func newTestHook(t *testing.T) (*cobra.Command, *glenOptions, string) {
+	t.Helper()
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv(hookKeysEnv, "")
+	t.Setenv("GITLAB_TOKEN", "token")
+
+	opts := &glenOptions{}
+	cmd := &cobra.Command{}
+	addGlenFlags(cmd.Flags(), opts)
+	cmd.Flags().String("profile", "", flagProfileDesc)
+	opts.noDaemon = true
+	opts.cacheTTL = time.Hour
+
+	return cmd, opts, glentest.NewRepo(t, nil)
+}
+
+//nolint:paralleltest // sets XDG_CONFIG_HOME, XDG_CACHE_HOME and GITLAB_TOKEN
+func TestHookEnv(t *testing.T) {
+	cmd, opts, root := newTestHook(t)
+	shell := hookShells()["bash"]
+
+	identity, err := opts.authIdentity(root)
+	require.NoError(t, err)
+	cache, err := newResultCache(cmd.Flags(), root, identity, opts.cacheTTL)
+	require.NoError(t, err)
+	require.NoError(t, cache.write(&projectVariables{Project: "group/project", Variables: map[string]glen.Variable{
+		"GLEN_TEST_VALID": {Key: "GLEN_TEST_VALID", Value: "valid"},
+		"$(id)":           {Key: "$(id)", Value: "invalid"},
+	}}))
+
+	want := shell.export(hookDirEnv, root) + shell.unset(hookKeysEnv)
+	assert.Equal(t, want, hookEnv(cmd, opts, shell, root), "repo not allowed")
+
+	require.NoError(t, setAllowed(root, true))
+	want = shell.export(hookDirEnv, root) +
+		shell.export("GLEN_TEST_VALID", "valid") +
+		shell.export(hookKeysEnv, "GLEN_TEST_VALID:"+glen.Variable{Value: "valid"}.Fingerprint())
+	assert.Equal(t, want, hookEnv(cmd, opts, shell, root), "repo allowed")
+}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/lingrino/glen/glen"
+	"github.com/spf13/pflag"
+	"golang.org/x/oauth2"
+)
+
+const (
+	flagCAFileDesc             = "A PEM file of certificate authorities to trust when calling GitLab, in addition to the system ones"
+	flagClientCertDesc         = "A PEM client certificate for GitLab instances that require mutual TLS. Requires --client-key"
+	flagClientKeyDesc          = "The PEM key of --client-cert"
+	flagInsecureSkipVerifyDesc = "Do not verify the TLS certificate of GitLab. Only use this to debug"
+	flagProxyDesc              = "The HTTP, HTTPS or SOCKS5 proxy to call GitLab through, such as socks5://127.0.0.1:1080. Defaults to HTTPS_PROXY"
+	flagNoProxyDesc            = "Comma-separated hosts, domains and IP ranges to call without the proxy. Defaults to NO_PROXY"
+)
+
+// sshConfigPath is the OpenSSH client config that SSH remote hosts are looked up in.
+const sshConfigPath = "~/.ssh/config"
+
+// hostConfig holds the connection settings of a GitLab host, from the hosts of the
+// user config. They are not read from repo configs, so that a repo cannot weaken
+// how glen connects to GitLab.
+type hostConfig struct {
+	CAFile             string `yaml:"caFile,omitempty"`
+	ClientCert         string `yaml:"clientCert,omitempty"`
+	ClientKey          string `yaml:"clientKey,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty"`
+	Proxy              string `yaml:"proxy,omitempty"`
+	NoProxy            string `yaml:"noProxy,omitempty"`
+}
+
+// addHTTPFlags adds the flags that configure how glen connects to GitLab to fs.
+func addHTTPFlags(fs *pflag.FlagSet) {
+	fs.String("ca-file", "", flagCAFileDesc)
+	fs.String("client-cert", "", flagClientCertDesc)
+	fs.String("client-key", "", flagClientKeyDesc)
+	fs.Bool("insecure-skip-verify", false, flagInsecureSkipVerifyDesc)
+	fs.String("proxy", "", flagProxyDesc)
+	fs.String("no-proxy", "", flagNoProxyDesc)
+}
+
+// loadHostConfig returns the settings of host from the user config, which are
+// empty if it has none.
+func loadHostConfig(host string) (*hostConfig, error) {
+	user, err := readConfig(userConfigPath())
+	if err != nil {
+		return nil, err
+	}
+
+	hc, ok := user.Hosts[host]
+	if !ok || hc == nil {
+		return &hostConfig{}, nil
+	}
+
+	return hc, nil
+}
+
+// configureHosts sets how repo maps the host of its remote to a GitLab host: with
+// the host aliases of the user config and the HostName of SSH hosts in
+// ~/.ssh/config. Like the host settings, aliases are not read from repo configs,
+// so that a repo cannot send your token to another host.
+func configureHosts(repo *glen.Repo) error {
+	user, err := readConfig(userConfigPath())
+	if err != nil {
+		return err
+	}
+
+	repo.HostAliases = user.HostAliases
+	repo.SSHConfigPath = expandHome(sshConfigPath)
+
+	return nil
+}
+
+// httpOptions returns the connection settings of host, from the flags in fs or,
+// for flags that are not set, from the host settings of the user config.
+func httpOptions(fs *pflag.FlagSet, host string) (glen.HTTPOptions, error) {
+	hc, err := loadHostConfig(host)
+	if err != nil {
+		return glen.HTTPOptions{}, err
+	}
+
+	o := glen.HTTPOptions{
+		CAFile:             expandHome(hc.CAFile),
+		CertFile:           expandHome(hc.ClientCert),
+		KeyFile:            expandHome(hc.ClientKey),
+		InsecureSkipVerify: hc.InsecureSkipVerify,
+		Proxy:              hc.Proxy,
+		NoProxy:            hc.NoProxy,
+	}
+
+	flags := map[string]*string{
+		"ca-file": &o.CAFile, "client-cert": &o.CertFile, "client-key": &o.KeyFile,
+		"proxy": &o.Proxy, "no-proxy": &o.NoProxy,
+	}
+	for flag, dst := range flags {
+		value, err := fs.GetString(flag)
+		if err != nil {
+			return glen.HTTPOptions{}, fmt.Errorf("get %s flag: %w", flag, err)
+		}
+		if value != "" {
+			*dst = value
+		}
+	}
+
+	insecure, err := fs.GetBool("insecure-skip-verify")
+	if err != nil {
+		return glen.HTTPOptions{}, fmt.Errorf("get insecure-skip-verify flag: %w", err)
+	}
+	o.InsecureSkipVerify = o.InsecureSkipVerify || insecure
+
+	return o, nil
+}
+
+// httpClient returns the HTTP client for calling GitLab at host, configured by
+// httpOptions.
+func httpClient(fs *pflag.FlagSet, host string) (*http.Client, error) {
+	o, err := httpOptions(fs, host)
+	if err != nil {
+		return nil, err
+	}
+	if o.InsecureSkipVerify {
+		slog.Warn("TLS certificate verification is disabled", "host", host)
+	}
+
+	client, err := glen.NewHTTPClient(o)
+	if err != nil {
+		return nil, fmt.Errorf("configure HTTP client for %s: %w", host, err)
+	}
+
+	return client, nil
+}
+
+// connection is how glen calls the GitLab API of a host.
+type connection struct {
+	client      *http.Client       // client makes the requests, with the TLS settings of the host
+	apiKey      string             // apiKey authenticates the requests when there is no tokenSource
+	tokenSource oauth2.TokenSource // tokenSource authenticates the requests with the credentials of 'glen login'
+}
+
+// connect returns the connection to host configured by the flags in fs, which
+// authenticates with the key resolved from apiKey and p or with stored credentials.
+func connect(fs *pflag.FlagSet, apiKey string, p *profile, host string) (*connection, error) {
+	client, err := httpClient(fs, host)
+	if err != nil {
+		return nil, err
+	}
+
+	key, tokenSource, err := resolveAuth(apiKey, p, host, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &connection{client: client, apiKey: key, tokenSource: tokenSource}, nil
+}
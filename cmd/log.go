@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	flagVerboseDesc   = "Log what glen does to stderr. Repeat as -vv for debug logs, including every API request"
+	flagLogFormatDesc = "One of 'text', 'json'. The format of logs written to stderr"
+)
+
+// Log formats of --log-format.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// errInvalidLogFormat is returned when --log-format is not a known format.
+var errInvalidLogFormat = errors.New("invalid log format")
+
+// logLevel returns the level that is logged with the number of -v flags given:
+// warnings and errors by default, info with -v and debug with -vv.
+func logLevel(verbosity int) slog.Level {
+	switch {
+	case verbosity <= 0:
+		return slog.LevelWarn
+	case verbosity == 1:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
+
+// setupLogging configures the default logger from the --verbose and --log-format
+// flags of cmd, or GLEN_LOG_FORMAT. Text logs keep the format of the standard
+// logger. Tokens and variable values are never logged.
+func setupLogging(cmd *cobra.Command) error {
+	verbosity, err := cmd.Flags().GetCount("verbose")
+	if err != nil {
+		return fmt.Errorf("get verbose flag: %w", err)
+	}
+
+	format, err := cmd.Flags().GetString("log-format")
+	if err != nil {
+		return fmt.Errorf("get log-format flag: %w", err)
+	}
+	if env, ok := os.LookupEnv(envName("log-format")); ok && !cmd.Flags().Changed("log-format") {
+		format = env
+	}
+
+	level := logLevel(verbosity)
+	switch format {
+	case logFormatText:
+		slog.SetLogLoggerLevel(level)
+	case logFormatJSON:
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+	default:
+		return fmt.Errorf("%w: %s", errInvalidLogFormat, format)
+	}
+
+	return nil
+}
@@ -3,22 +3,78 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"text/template"
 
+	"filippo.io/age"
+	"github.com/lingrino/glen/glen"
 	"github.com/olekukonko/tablewriter"
 	"github.com/olekukonko/tablewriter/tw"
 )
 
-// output outputs a map of environment variables in the specified format.
-func output(m map[string]string, format string) {
+// redacted replaces the value of masked and hidden variables, the same as GitLab
+// does in job logs.
+const redacted = "[MASKED]"
+
+// Output formats that are encrypted with age.
+const (
+	outputSOPSYAML   = "sops-yaml"
+	outputSOPSDotenv = "sops-dotenv"
+	outputAge        = "age"
+)
+
+// outputTemplate is the output format that executes the template of --template.
+const outputTemplate = "template"
+
+// outputOptions holds the settings that change how variables are printed.
+type outputOptions struct {
+	reveal       bool                   // reveal prints masked and hidden values in table and JSON output
+	revealPrefix int                    // revealPrefix prints the first n characters of masked and hidden values
+	recipients   []*age.X25519Recipient // recipients are the age public keys that encrypted output is written to
+	sort         glen.SortOrder         // sort is the order that variables are printed in
+	jsonArray    bool                   // jsonArray prints JSON output as an array of variables with their metadata
+	template     *template.Template     // template is executed for template output
+}
+
+// output writes the variables of a project to w in the specified format. The
+// project is empty when the variables of several projects were merged.
+func output(w io.Writer, p *projectVariables, format string, opts outputOptions) {
 	switch format {
 	case "export":
-		outputExport(m)
+		outputExport(w, p.Variables, opts)
 	case "json":
-		outputJSON(m)
+		outputJSON(w, p, opts)
 	case "table":
-		outputTable(m)
+		outputTable(w, p.Variables, opts)
+	case outputSOPSYAML, outputSOPSDotenv, outputAge:
+		outputEncrypted(w, []*projectVariables{p}, format, opts)
+	case outputTemplate:
+		outputTemplates(w, []*projectVariables{p}, opts)
+	default:
+		slog.Error("output type is not supported", "type", format)
+		os.Exit(1)
+	}
+}
+
+// outputProjects writes the variables of several projects to w in the specified
+// format, keyed by project.
+func outputProjects(w io.Writer, projects []*projectVariables, format string, opts outputOptions) {
+	switch format {
+	case "export":
+		for _, p := range projects {
+			fmt.Fprintf(w, "# %s\n", p.Project)
+			outputExport(w, p.Variables, opts)
+		}
+	case "json":
+		outputProjectsJSON(w, projects, opts)
+	case "table":
+		outputProjectsTable(w, projects, opts)
+	case outputSOPSYAML, outputSOPSDotenv, outputAge:
+		outputEncrypted(w, projects, format, opts)
+	case outputTemplate:
+		outputTemplates(w, projects, opts)
 	default:
 		slog.Error("output type is not supported", "type", format)
 		os.Exit(1)
@@ -27,36 +83,224 @@ func output(m map[string]string, format string) {
 
 // outputExport outputs a map of environment variables in 'export' format,
 // meaning the output can be immediately evaluated to export the variables.
-func outputExport(m map[string]string) {
-	for k, v := range m {
-		fmt.Printf("export %s=\"%s\"\n", k, v)
+// Values are never redacted because the output is meant to be evaluated, and
+// variables whose keys are not valid shell names are skipped.
+func outputExport(w io.Writer, vars map[string]glen.Variable, opts outputOptions) {
+	for _, v := range glen.SortVariables(vars, opts.sort) {
+		if !glen.ValidVariableName(v.Key) {
+			slog.Warn("skipping variable with an invalid name", "key", v.Key)
+
+			continue
+		}
+		fmt.Fprint(w, posixExport(v.Key, v.Value))
 	}
 }
 
-// outputJSON outputs a map of environment variables in JSON format.
-func outputJSON(m map[string]string) {
+// jsonValue is the value of a variable in JSON object output, with its fingerprint.
+type jsonValue struct {
+	Value       string `json:"value"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// newJSONValue returns the redacted value and the fingerprint of v.
+func newJSONValue(v glen.Variable, opts outputOptions) jsonValue {
+	return jsonValue{Value: redact(v, opts), Fingerprint: v.Fingerprint()}
+}
+
+// outputJSON outputs the variables of a project in JSON format, as an object of
+// keys and values with their fingerprints, or as an array of variables.
+func outputJSON(w io.Writer, p *projectVariables, opts outputOptions) {
+	if opts.jsonArray {
+		outputJSONArray(w, []*projectVariables{p}, opts)
+
+		return
+	}
+
+	m := make(map[string]jsonValue, len(p.Variables))
+	for k, v := range p.Variables {
+		m[k] = newJSONValue(v, opts)
+	}
+
+	json, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		slog.Error("failed to marshal the output into JSON")
+		os.Exit(1)
+	}
+	fmt.Fprintln(w, string(json))
+}
+
+// outputProjectsJSON outputs the variables of several projects in JSON format, as
+// an object with one object of variables per project or as an array of variables.
+func outputProjectsJSON(w io.Writer, projects []*projectVariables, opts outputOptions) {
+	if opts.jsonArray {
+		outputJSONArray(w, projects, opts)
+
+		return
+	}
+
+	m := make(map[string]map[string]jsonValue, len(projects))
+	for _, p := range projects {
+		m[p.Project] = make(map[string]jsonValue, len(p.Variables))
+		for k, v := range p.Variables {
+			m[p.Project][k] = newJSONValue(v, opts)
+		}
+	}
+
 	json, err := json.MarshalIndent(m, "", "    ")
 	if err != nil {
 		slog.Error("failed to marshal the output into JSON")
 		os.Exit(1)
 	}
-	fmt.Println(string(json))
+	fmt.Fprintln(w, string(json))
+}
+
+// jsonVariable is a variable in JSON array output, with the project it belongs to
+// if it is known and the fingerprint of its value.
+type jsonVariable struct {
+	Project string `json:"project,omitempty"`
+	glen.Variable
+	Fingerprint string `json:"fingerprint"`
 }
 
-// outputTable outputs a map of environment variables in a table format.
-func outputTable(m map[string]string) {
+// outputJSONArray outputs the variables of projects in JSON format, as an array of
+// variables with all of their metadata, in order.
+func outputJSONArray(w io.Writer, projects []*projectVariables, opts outputOptions) {
+	vars := []jsonVariable{}
+	for _, p := range projects {
+		for _, v := range glen.SortVariables(p.Variables, opts.sort) {
+			fingerprint := v.Fingerprint()
+			v.Value = redact(v, opts)
+			vars = append(vars, jsonVariable{Project: p.Project, Variable: v, Fingerprint: fingerprint})
+		}
+	}
+
+	json, err := json.MarshalIndent(vars, "", "    ")
+	if err != nil {
+		slog.Error("failed to marshal the output into JSON")
+		os.Exit(1)
+	}
+	fmt.Fprintln(w, string(json))
+}
+
+// outputTable outputs a map of environment variables in a table format, with a
+// fingerprint of each value so tables can be compared without revealing values.
+func outputTable(w io.Writer, vars map[string]glen.Variable, opts outputOptions) {
+	data := [][]string{}
+	for _, v := range glen.SortVariables(vars, opts.sort) {
+		data = append(data, []string{v.Key, redact(v, opts), v.Fingerprint()})
+	}
+
+	table := tablewriter.NewTable(w,
+		tablewriter.WithAlignment([]tw.Align{tw.AlignLeft}),
+		tablewriter.WithRendition(tw.Rendition{
+			Borders: tw.Border{Left: tw.On, Top: tw.Off, Right: tw.On, Bottom: tw.Off},
+		}),
+	)
+	table.Header([]string{"Key", "Value", "Fingerprint"})
+	table.Bulk(data) //nolint:errcheck,gosec
+	table.Render()   //nolint:errcheck,gosec
+}
+
+// outputProjectsTable outputs the variables of several projects in a table format,
+// with a column for the project of each variable.
+func outputProjectsTable(w io.Writer, projects []*projectVariables, opts outputOptions) {
 	data := [][]string{}
-	for k, v := range m {
-		data = append(data, []string{k, v})
+	for _, p := range projects {
+		for _, v := range glen.SortVariables(p.Variables, opts.sort) {
+			data = append(data, []string{p.Project, v.Key, redact(v, opts), v.Fingerprint()})
+		}
 	}
 
-	table := tablewriter.NewTable(os.Stdout,
+	table := tablewriter.NewTable(w,
 		tablewriter.WithAlignment([]tw.Align{tw.AlignLeft}),
 		tablewriter.WithRendition(tw.Rendition{
 			Borders: tw.Border{Left: tw.On, Top: tw.Off, Right: tw.On, Bottom: tw.Off},
 		}),
 	)
-	table.Header([]string{"Key", "Value"})
+	table.Header([]string{"Project", "Key", "Value", "Fingerprint"})
 	table.Bulk(data) //nolint:errcheck,gosec
 	table.Render()   //nolint:errcheck,gosec
 }
+
+// outputEncrypted outputs the variables of projects as a snapshot encrypted to the
+// recipients, either as a SOPS file in YAML or dotenv format or as an age file.
+// Values are never redacted because only the recipients can read them.
+func outputEncrypted(w io.Writer, projects []*projectVariables, format string, opts outputOptions) {
+	snapshot := glen.NewSnapshot()
+	for _, p := range projects {
+		snapshot.Add(p.Project, p.Variables)
+	}
+
+	var err error
+	switch format {
+	case outputSOPSYAML:
+		err = snapshot.WriteSOPS(w, glen.SOPSYAML, opts.recipients...)
+	case outputSOPSDotenv:
+		err = snapshot.WriteSOPS(w, glen.SOPSDotenv, opts.recipients...)
+	default:
+		recipients := make([]age.Recipient, 0, len(opts.recipients))
+		for _, r := range opts.recipients {
+			recipients = append(recipients, r)
+		}
+		err = snapshot.WriteAge(w, recipients...)
+	}
+	if err != nil {
+		slog.Error("failed to encrypt the output", "type", format, "error", err)
+		os.Exit(1)
+	}
+}
+
+// outputTemplates outputs the variables of projects by executing the template with
+// glen.TemplateData. Values are never redacted, so that templates can write files
+// that tools read the variables from.
+func outputTemplates(w io.Writer, projects []*projectVariables, opts outputOptions) {
+	tp := make([]glen.TemplateProject, 0, len(projects))
+	for _, p := range projects {
+		tp = append(tp, glen.TemplateProject{
+			Project:   p.Project,
+			Repo:      p.repo,
+			Variables: glen.SortVariables(p.Variables, opts.sort),
+		})
+	}
+
+	err := opts.template.Execute(w, glen.NewTemplateData(tp...))
+	if err != nil {
+		slog.Error("failed to execute the template", "error", err)
+		os.Exit(1)
+	}
+}
+
+// encryptedFormat reports whether format is an output format that is encrypted.
+func encryptedFormat(format string) bool {
+	return format == outputSOPSYAML || format == outputSOPSDotenv || format == outputAge
+}
+
+// parseX25519Recipients parses a list of age X25519 public keys, the only kind of
+// recipient that SOPS supports.
+func parseX25519Recipients(keys []string) ([]*age.X25519Recipient, error) {
+	recipients := make([]*age.X25519Recipient, 0, len(keys))
+	for _, key := range keys {
+		r, err := age.ParseX25519Recipient(key)
+		if err != nil {
+			return nil, fmt.Errorf("parse recipient %q: %w", key, err)
+		}
+		recipients = append(recipients, r)
+	}
+
+	return recipients, nil
+}
+
+// redact returns the value of a variable, replacing masked and hidden values unless
+// they are revealed. With a reveal prefix only the first characters are shown.
+func redact(v glen.Variable, opts outputOptions) string {
+	if opts.reveal || !v.Sensitive() {
+		return v.Value
+	}
+
+	value := []rune(v.Value)
+	if opts.revealPrefix > 0 && opts.revealPrefix < len(value) {
+		return string(value[:opts.revealPrefix]) + redacted
+	}
+
+	return redacted
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"testing"
+
+	"github.com/lingrino/glen/glen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputExport(t *testing.T) {
+	t.Parallel()
+
+	vars := map[string]glen.Variable{
+		"PLAIN":  {Value: "value"},
+		"DOLLAR": {Value: "$HOME and $$ and ${PATH}"},
+		"SUBST":  {Value: "`id` $(id)"},
+		"QUOTES": {Value: `it's "quoted" \n`},
+		"$(id)":  {Key: "$(id)", Value: "invalid"},
+	}
+
+	var out bytes.Buffer
+	outputExport(&out, vars, outputOptions{sort: glen.SortByKey})
+
+	assert.Equal(t, "export DOLLAR='$HOME and $$ and ${PATH}'\n"+
+		"export PLAIN='value'\n"+
+		"export QUOTES='it'\\''s \"quoted\" \\n'\n"+
+		"export SUBST='`id` $(id)'\n", out.String())
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not installed")
+	}
+
+	script := out.String() + `printf '%s|%s|%s' "$DOLLAR" "$QUOTES" "$SUBST"`
+	got, err := exec.Command(sh, "-c", script).Output() //nolint:gosec,noctx
+	require.NoError(t, err)
+	assert.Equal(t, `$HOME and $$ and ${PATH}|it's "quoted" \n|`+"`id` $(id)", string(got))
+}
+
+// testJSONProject is a project with a plain and a masked variable.
+var testJSONProject = &projectVariables{Project: "group/project", Variables: map[string]glen.Variable{
+	"PLAIN":  {Key: "PLAIN", Value: "value"},
+	"SECRET": {Key: "SECRET", Value: "secret", Masked: true},
+}}
+
+func TestOutputJSON(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	outputJSON(&out, testJSONProject, outputOptions{})
+
+	assert.JSONEq(t, `{
+		"PLAIN": {"value": "value", "fingerprint": "cd42404d52ad"},
+		"SECRET": {"value": "[MASKED]", "fingerprint": "2bb80d537b1d"}
+	}`, out.String())
+}
+
+func TestOutputJSONArray(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	outputJSON(&out, testJSONProject, outputOptions{jsonArray: true, sort: glen.SortByKey})
+
+	var got []jsonVariable
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	require.Len(t, got, 2)
+	assert.Equal(t, "value", got[0].Value)
+	assert.Equal(t, "cd42404d52ad", got[0].Fingerprint)
+	assert.Equal(t, "[MASKED]", got[1].Value)
+	assert.Equal(t, "2bb80d537b1d", got[1].Fingerprint)
+}
@@ -0,0 +1,35 @@
+//go:build darwin
+
+package cmd
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerUID returns the user ID of the process at the other end of conn.
+func peerUID(conn *net.UnixConn) (int, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, fmt.Errorf("get socket: %w", err)
+	}
+
+	var (
+		cred    *unix.Xucred
+		credErr error
+	)
+
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("get socket: %w", err)
+	}
+	if credErr != nil {
+		return 0, fmt.Errorf("get peer credentials: %w", credErr)
+	}
+
+	return int(cred.Uid), nil
+}
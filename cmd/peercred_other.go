@@ -0,0 +1,17 @@
+//go:build !linux && !darwin
+
+package cmd
+
+import (
+	"errors"
+	"net"
+)
+
+// errPeerCredentials is returned on systems where glen cannot check who is at the
+// other end of a Unix socket, so it does not serve or use the daemon.
+var errPeerCredentials = errors.New("peer credentials are not supported on this system")
+
+// peerUID returns errPeerCredentials.
+func peerUID(_ *net.UnixConn) (int, error) {
+	return 0, errPeerCredentials
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/lingrino/glen/glen"
+	"github.com/spf13/pflag"
+)
+
+// maxConcurrentProjects is the number of projects whose variables are fetched at once.
+const maxConcurrentProjects = 8
+
+var (
+	// errDuplicateProject is returned when two directories are checkouts of the same project.
+	errDuplicateProject = errors.New("directories are checkouts of the same project")
+	// errNoDirectories is returned when the directory globs match no git repos.
+	errNoDirectories = errors.New("no git repos match the directories")
+	// errPipelineDirectories is returned when a pipeline or job is selected for several directories.
+	errPipelineDirectories = errors.New("--pipeline and --job-id select a pipeline of a single project")
+)
+
+// projectVariables are the variables of the GitLab project checked out in a directory.
+type projectVariables struct {
+	Project   string                   `json:"project"`
+	Variables map[string]glen.Variable `json:"variables"`
+
+	directory string     // directory is where the project is checked out
+	repo      *glen.Repo // repo is the git repo of the project, set for template output
+}
+
+// configDirectory returns the directory to read the repo config from, which is
+// the only directory if there is exactly one and the working directory otherwise.
+func configDirectory(directories []string) string {
+	if len(directories) == 1 && !hasMeta(directories[0]) {
+		return directories[0]
+	}
+
+	return "."
+}
+
+// expandDirectories expands globs in directories, keeping the order in which they
+// are given and dropping duplicates. Globs match only git repos, and within a
+// glob repos are sorted by name.
+func expandDirectories(directories []string) ([]string, error) {
+	seen := make(map[string]bool)
+
+	var dirs []string
+	for _, pattern := range directories {
+		matches := []string{pattern}
+		if hasMeta(pattern) {
+			var err error
+
+			matches, err = filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("expand %s: %w", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("expand %s: %w", pattern, os.ErrNotExist)
+			}
+		}
+
+		for _, match := range matches {
+			if hasMeta(pattern) {
+				_, err := os.Stat(filepath.Join(match, ".git"))
+				if err != nil {
+					continue
+				}
+			}
+
+			clean := filepath.Clean(match)
+			if !seen[clean] {
+				seen[clean] = true
+				dirs = append(dirs, clean)
+			}
+		}
+	}
+
+	if len(dirs) == 0 {
+		return nil, errNoDirectories
+	}
+
+	return dirs, nil
+}
+
+// hasMeta reports whether path contains any of the magic characters of filepath.Match.
+func hasMeta(path string) bool {
+	for _, c := range path {
+		switch c {
+		case '*', '?', '[', '\\':
+			return true
+		}
+	}
+
+	return false
+}
+
+// projectVariables returns the variables of the project in every directory, in
+// the order of directories. Projects are fetched concurrently.
+func (opts *glenOptions) projectVariables(fs *pflag.FlagSet, directories []string) ([]*projectVariables, error) {
+	if len(directories) > 1 && (opts.pipeline != 0 || opts.jobID != 0) {
+		return nil, errPipelineDirectories
+	}
+
+	projects := make([]*projectVariables, len(directories))
+	errs := make([]error, len(directories))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentProjects)
+
+	for i, dir := range directories {
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result, err := opts.cachedVariables(fs, dir)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", dir, err)
+
+				return
+			}
+			result.directory = dir
+			projects[i] = result
+		})
+	}
+	wg.Wait()
+
+	err := errors.Join(errs...)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]string)
+	for _, p := range projects {
+		if dir, ok := seen[p.Project]; ok {
+			return nil, fmt.Errorf("%w: %s and %s are both %s", errDuplicateProject, dir, p.directory, p.Project)
+		}
+		seen[p.Project] = p.directory
+	}
+
+	return projects, nil
+}
+
+// mergeProjects merges the variables of several projects into one set, where
+// the variables of later projects override those of earlier ones.
+func mergeProjects(projects []*projectVariables) map[string]glen.Variable {
+	merged := make(map[string]glen.Variable)
+	for _, p := range projects {
+		for k, v := range p.Variables {
+			merged[k] = v
+		}
+	}
+
+	return merged
+}
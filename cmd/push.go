@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/lingrino/glen/glen"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	flagSinkDesc       = "The secret store to write to. One of 'kdbx', 'pass', 'vault'"
+	flagMapDesc        = "A PATTERN=TEMPLATE rule that maps keys matching the glob to a secret path, using {key} and {project}, or '-' to skip them. Can be repeated, and the first matching rule wins"
+	flagKDBXFileDesc   = "The KeePass database to write to. Its password is read from GLEN_KDBX_PASSWORD"
+	flagPassDirDesc    = "The password store to write to. Defaults to PASSWORD_STORE_DIR or ~/.password-store"
+	flagVaultAddrDesc  = "The address of the Vault server. Defaults to VAULT_ADDR"
+	flagVaultMountDesc = "The path of the Vault KV v2 secrets engine"
+	flagPushDryRunDesc = "Print the secret paths that would be written, without their values, and write nothing"
+)
+
+// Secret stores that glen push can write to.
+const (
+	sinkKDBX  = "kdbx"
+	sinkPass  = "pass"
+	sinkVault = "vault"
+)
+
+var (
+	// errUnknownSink is returned when --sink is not a supported secret store.
+	errUnknownSink = errors.New("unknown sink, use one of 'kdbx', 'pass', 'vault'")
+	// errNoKDBXFile is returned when pushing to a KeePass database without --kdbx-file.
+	errNoKDBXFile = errors.New("set --kdbx-file to push to a KeePass database")
+)
+
+// pushOptions holds the flags of glen push that configure the sink.
+type pushOptions struct {
+	sink       string   // sink is the secret store that glen writes to
+	rules      []string // rules map the keys of variables to secret paths
+	kdbxFile   string   // kdbxFile is the KeePass database that glen writes to
+	passDir    string   // passDir is the password store that glen writes to
+	vaultAddr  string   // vaultAddr is the address of the Vault server
+	vaultMount string   // vaultMount is the path of the Vault KV v2 engine
+	dryRun     bool     // dryRun prints the secret paths instead of writing them
+}
+
+func pushCmd() *cobra.Command {
+	opts := &glenOptions{}
+	push := &pushOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "push --sink NAME",
+		Short: "Writes variables into another secret store",
+		Long: `Push writes the variables of your repo into another secret store, so that local
+tools that read from it can use them. Secrets are created or updated, and other
+secrets in the store are left untouched.
+
+Every variable is written to the path {project}/{key}, such as
+my-group/my-project/DB_PASSWORD, unless a --map rule matches its key. The first
+matching rule wins, and a rule whose template is '-' skips the variable.
+
+Sinks:
+  kdbx   A KeePass database. Paths are groups and the title of the entry. The file
+         is created if it does not exist, with the password in GLEN_KDBX_PASSWORD
+  pass   The pass password store. Every path is a file encrypted with gpg for the
+         keys in the nearest .gpg-id
+  vault  The KV v2 engine of HashiCorp Vault. The last element of a path is a
+         field of the secret at the rest of the path. VAULT_TOKEN authenticates`,
+		Example: `  glen push -r --sink kdbx --kdbx-file ~/secrets.kdbx
+  glen push --sink pass --map 'AWS_*=aws/{key}' --map 'CI_*=-'
+  glen push --sink vault --vault-mount kv --map '*=apps/{project}/{key}' --dry-run`,
+		Args: cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, _ []string) {
+			var err error
+
+			opts.profile, _, err = applyConfig(cmd, configDirectory(opts.directories))
+			if err != nil {
+				slog.Error("failed to load config", "error", err)
+				os.Exit(1)
+			}
+
+			err = push.run(os.Stdout, opts, cmd.Flags())
+			if err != nil {
+				slog.Error("failed to push variables", "sink", push.sink, "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	addGlenFlags(cmd.Flags(), opts)
+	cmd.Flags().StringVar(&push.sink, "sink", "", flagSinkDesc)
+	cmd.Flags().StringArrayVar(&push.rules, "map", nil, flagMapDesc)
+	cmd.Flags().StringVar(&push.kdbxFile, "kdbx-file", "", flagKDBXFileDesc)
+	cmd.Flags().StringVar(&push.passDir, "pass-dir", "", flagPassDirDesc)
+	cmd.Flags().StringVar(&push.vaultAddr, "vault-addr", "", flagVaultAddrDesc)
+	cmd.Flags().StringVar(&push.vaultMount, "vault-mount", "secret", flagVaultMountDesc)
+	cmd.Flags().BoolVar(&push.dryRun, "dry-run", false, flagPushDryRunDesc)
+	cmd.MarkFlagRequired("sink") //nolint:errcheck,gosec
+
+	return cmd
+}
+
+// run maps the variables of the directories in opts to secrets and writes them
+// to the sink, or prints their paths to w with --dry-run.
+func (p *pushOptions) run(w io.Writer, opts *glenOptions, fs *pflag.FlagSet) error {
+	sink, err := p.newSink()
+	if err != nil {
+		return err
+	}
+
+	rules, err := parseMapRules(p.rules)
+	if err != nil {
+		return err
+	}
+
+	dirs, err := expandDirectories(opts.directories)
+	if err != nil {
+		return fmt.Errorf("find directories: %w", err)
+	}
+
+	projects, err := opts.projectVariables(fs, dirs)
+	if err != nil {
+		return fmt.Errorf("get variables: %w", err)
+	}
+
+	secrets, err := mapProjects(projects, rules)
+	if err != nil {
+		return fmt.Errorf("map variables: %w", err)
+	}
+
+	if p.dryRun {
+		outputSecretPaths(w, secrets)
+
+		return nil
+	}
+
+	err = sink.Write(secrets)
+	if err != nil {
+		return fmt.Errorf("write secrets: %w", err)
+	}
+	slog.Info("pushed variables", "sink", p.sink, "count", len(secrets))
+
+	return nil
+}
+
+// newSink returns the sink selected by --sink, configured by the flags.
+func (p *pushOptions) newSink() (glen.Sink, error) { //nolint:ireturn
+	switch p.sink {
+	case sinkKDBX:
+		if p.kdbxFile == "" {
+			return nil, errNoKDBXFile
+		}
+
+		return glen.NewKDBXSink(expandHome(p.kdbxFile)), nil
+	case sinkPass:
+		sink := glen.NewPassSink()
+		if p.passDir != "" {
+			sink.Dir = expandHome(p.passDir)
+		}
+
+		return sink, nil
+	case sinkVault:
+		sink := glen.NewVaultSink()
+		if p.vaultAddr != "" {
+			sink.Address = p.vaultAddr
+		}
+		sink.Mount = p.vaultMount
+
+		return sink, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", errUnknownSink, p.sink)
+	}
+}
+
+// parseMapRules parses the --map rules.
+func parseMapRules(rules []string) ([]glen.MapRule, error) {
+	parsed := make([]glen.MapRule, 0, len(rules))
+	for _, rule := range rules {
+		r, err := glen.ParseMapRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("parse --map: %w", err)
+		}
+		parsed = append(parsed, r)
+	}
+
+	return parsed, nil
+}
+
+// mapProjects maps the variables of every project to secrets. Two variables may
+// not map to the same path, even if they are in different projects.
+func mapProjects(projects []*projectVariables, rules []glen.MapRule) ([]glen.Secret, error) {
+	var secrets []glen.Secret
+	seen := make(map[string]string)
+
+	for _, p := range projects {
+		mapped, err := glen.MapSecrets(p.Project, p.Variables, rules)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Project, err)
+		}
+
+		for _, s := range mapped {
+			if other, ok := seen[s.Path]; ok {
+				return nil, fmt.Errorf("%w: %s and %s/%s map to %s",
+					glen.ErrDuplicateSecretPath, other, p.Project, s.Variable.Key, s.Path)
+			}
+			seen[s.Path] = p.Project + "/" + s.Variable.Key
+		}
+		secrets = append(secrets, mapped...)
+	}
+
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Path < secrets[j].Path
+	})
+
+	return secrets, nil
+}
+
+// outputSecretPaths prints the path of every secret and the key it comes from.
+func outputSecretPaths(w io.Writer, secrets []glen.Secret) {
+	for _, s := range secrets {
+		fmt.Fprintf(w, "%s\t%s\n", s.Path, s.Variable.Key) //nolint:errcheck
+	}
+}
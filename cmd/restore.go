@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"filippo.io/age"
+	"github.com/lingrino/glen/glen"
+	"github.com/olekukonko/tablewriter"
+	"github.com/olekukonko/tablewriter/tw"
+	"github.com/spf13/cobra"
+)
+
+const (
+	flagRestoreHostDesc = "The GitLab host to restore into. Defaults to the host the backup was taken from"
+	flagTargetDesc      = "The group to restore into. Defaults to the group the backup was taken from"
+	flagKeyDesc         = "Only restore variables whose key matches this glob. Can be repeated"
+	flagDryRunDesc      = "Print what would be restored without changing anything"
+	flagIdentityDesc    = "An age identity file used to decrypt an encrypted backup"
+)
+
+func restoreCmd() *cobra.Command {
+	var (
+		apiKey   string   // apiKey is the GitLab key that we should use when calling the API
+		host     string   // host overrides the GitLab instance from the backup
+		apiURL   string   // apiURL overrides the GitLab API URL
+		target   string   // target overrides the group from the backup
+		keys     []string // keys are globs selecting which variables to restore
+		dryRun   bool     // dryRun prints the restore plan without applying it
+		identity string   // identity is an age identity file for encrypted backups
+	)
+
+	cmd := &cobra.Command{
+		Use:   "restore FILE",
+		Short: "Restores variables from a backup",
+		Long: `Restore replays an archive written by 'glen backup' into GitLab, creating
+missing variables and updating existing ones. Use --target to restore into a
+different group and --key to restore only some variables.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			p, _, err := applyConfig(cmd, ".")
+			if err != nil {
+				slog.Error("failed to load config", "error", err)
+				os.Exit(1)
+			}
+
+			backup, err := readBackupFile(args[0], identity)
+			if err != nil {
+				slog.Error("failed to read backup", "error", err)
+				os.Exit(1)
+			}
+
+			restore := glen.NewRestore(backup)
+			restore.Keys = keys
+			restore.DryRun = dryRun
+			if host != "" {
+				restore.BaseURL = host
+			}
+
+			conn, err := connect(cmd.Flags(), apiKey, p, restore.BaseURL)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if target != "" {
+				restore.Target = target
+			}
+			restore.APIURL = apiURL
+			restore.SetAPIKey(conn.apiKey)
+			restore.TokenSource = conn.tokenSource
+			restore.HTTPClient = conn.client
+
+			err = restore.Init()
+			outputRestoreActions(restore.Actions)
+			if err != nil {
+				slog.Error("failed to restore variables", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&apiKey, "api-key", "k", "GITLAB_TOKEN", flagAPIKeyDesc)
+	cmd.Flags().StringVarP(&host, "host", "H", "", flagRestoreHostDesc)
+	cmd.Flags().StringVar(&apiURL, "api-url", "", flagAPIURLDesc)
+	cmd.Flags().StringVarP(&target, "target", "t", "", flagTargetDesc)
+	cmd.Flags().StringSliceVar(&keys, "key", nil, flagKeyDesc)
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, flagDryRunDesc)
+	cmd.Flags().StringVarP(&identity, "identity", "i", "", flagIdentityDesc)
+
+	return cmd
+}
+
+// readBackupFile reads a backup from a file, decrypting it with the identities
+// in identityFile if one is given.
+func readBackupFile(file string, identityFile string) (*glen.Backup, error) {
+	var identities []age.Identity
+
+	if identityFile != "" {
+		var err error
+
+		identities, err = readIdentities(identityFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.Open(file) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("open backup file: %w", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	backup, err := glen.ReadBackup(f, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("read backup file: %w", err)
+	}
+
+	return backup, nil
+}
+
+// readIdentities reads the age identities in identityFile.
+func readIdentities(identityFile string) ([]age.Identity, error) {
+	f, err := os.Open(identityFile) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("open identity file: %w", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse identity file: %w", err)
+	}
+
+	return identities, nil
+}
+
+// outputRestoreActions outputs the actions taken by a restore in a table format.
+func outputRestoreActions(actions []glen.RestoreAction) {
+	data := [][]string{}
+	for _, a := range actions {
+		data = append(data, []string{a.Action, a.Kind, a.Path, a.Key, a.EnvironmentScope, a.Reason})
+	}
+
+	table := tablewriter.NewTable(os.Stdout,
+		tablewriter.WithAlignment([]tw.Align{tw.AlignLeft}),
+		tablewriter.WithRendition(tw.Rendition{
+			Borders: tw.Border{Left: tw.On, Top: tw.Off, Right: tw.On, Bottom: tw.Off},
+		}),
+	)
+	table.Header([]string{"Action", "Kind", "Path", "Key", "Scope", "Reason"})
+	table.Bulk(data) //nolint:errcheck,gosec
+	table.Render()   //nolint:errcheck,gosec
+}
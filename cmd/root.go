@@ -1,32 +1,118 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"regexp"
+	"sync"
+	"time"
 
 	"github.com/lingrino/glen/glen"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/oauth2"
 )
 
 const (
 	flagRecurseDesc      = "Set recurse to true if you want to include the variables of the parent groups"
 	flagAPIKeyDesc       = "Your GitLab API key, if not set as a GITLAB_TOKEN environment variable" //nolint:gosec
-	flagDirectoryDesc    = "The directory where your git repo lives. Defaults to your current working directory"
+	flagDirectoryDesc    = "The directory where your git repo lives. Can be repeated or a glob to get the variables of several repos. Defaults to your current working directory"
 	flagRemoteNameDesc   = "Name of the GitLab remote in your git repo. Defaults to 'origin'"
-	flagOutputFormatDesc = "One of 'export', 'json', 'table'. Default 'export', which can be executed to export variables"
+	flagOutputFormatDesc = "One of 'export', 'json', 'table', 'sops-yaml', 'sops-dotenv', 'age', 'template'. Default 'export', which can be executed to export variables"
 	flagGroupDesc        = "Set group to true to get only variables from the parent groups."
+	flagCIVarsDesc       = "Include the GitLab predefined CI/CD variables, such as CI_PROJECT_PATH and CI_COMMIT_SHA"
+	flagCIConfigDesc     = "Include the variables declared in the .gitlab-ci.yml pipeline configuration"
+	flagJobDesc          = "Include the variables of this job from the pipeline configuration. Implies --ci-config"
+	flagPipelineDesc     = "Reproduce the variables of this pipeline ID, with its ref and the variables it was created with"
+	flagJobIDDesc        = "Reproduce the variables of this job ID, with the ref and variables of its pipeline and its environment"
+	flagPipelineSrcDesc  = "The CI_PIPELINE_SOURCE of --ci-vars, such as 'merge_request_event' or 'schedule'. Defaults to 'push', or the source of --pipeline"
+	flagSimulateRefDesc  = "Drop protected variables unless the current branch or tag is protected, like GitLab does"
+	flagRefDesc          = "The branch or tag to simulate instead of the current one. Implies --simulate-ref"
+	flagRevealDesc       = "Print masked and hidden values in table and JSON output instead of redacting them"
+	flagRevealPrefixDesc = "Print the first n characters of masked and hidden values in table and JSON output"
+	flagExpandDesc       = "Expand $VAR and ${VAR} references in variable values, like GitLab does"
+	flagExpandEnvDesc    = "Resolve references to variables not defined in GitLab from the local environment"
+	flagAPIHostDesc      = "The GitLab host to call the API on. Defaults to the host of your GitLab remote"
+	flagAPIURLDesc       = "The GitLab API URL. Defaults to https://<host>/api/v4"
+	flagEnvironmentDesc  = "Only include variables whose environment scope matches this environment"
+	flagIncludeDesc      = "Only include variables whose key matches this glob. Can be repeated"
+	flagExcludeDesc      = "Exclude variables whose key matches this glob. Can be repeated"
+	flagProfileDesc      = "The profile to use from your glen config files"
+	flagIncludeRegexDesc = "Only include variables whose key matches this regular expression. Can be repeated"
+	flagExcludeRegexDesc = "Exclude variables whose key matches this regular expression. Can be repeated"
+	flagStripPrefixDesc  = "Remove this prefix from the keys of variables that have it"
+	flagAddPrefixDesc    = "Add this prefix to the key of every variable"
+	flagMergeDesc        = "Merge the variables of several directories into one set, where later directories override earlier ones"
+	flagCacheTTLDesc     = "Reuse the variables of an identical run within this long, for example '1m'. Cached values are stored unencrypted"
+	flagEncryptToDesc    = "An age public key to encrypt sops-yaml, sops-dotenv and age output to. Can be repeated"
+	flagSortDesc         = "The order to print variables in, then by key. One of 'key', 'source', 'scope'. Keys of JSON objects are always sorted by key"
+	flagJSONArrayDesc    = "Print JSON output as an ordered array of variables with their metadata, instead of an object of keys and values"
+	flagTemplateDesc     = "A Go text/template file, or the name of a built-in template, to execute for template output"
 )
 
+var (
+	// errNoOutputRecipients is returned when encrypted output is requested without --recipient.
+	errNoOutputRecipients = errors.New("set --recipient to encrypt the output")
+	// errNoTemplate is returned when template output is requested without --template.
+	errNoTemplate = errors.New("set --template to a template file or a built-in template")
+)
+
+// glenOptions holds the flags of the root glen command.
+type glenOptions struct {
+	recurse      bool          // recurse determines if glen with also get variables from the project's parent groups
+	apiKey       string        // apiKey is the GitLab key that we should use when calling the API
+	directories  []string      // directories are the paths, or globs, of the git repos that we should run glen on
+	merge        bool          // merge determines if the variables of several directories are merged into one set
+	remoteName   string        // remoteName is the name of the GitLab remote in your git repo
+	outputFormat string        // outputFormat is the text format that we should use to print our results to stdout
+	recipients   []string      // recipients are the age public keys that encrypted output is written to
+	sort         string        // sort is the order that glen prints variables in
+	jsonArray    bool          // jsonArray determines if glen prints JSON output as an array of variables
+	template     string        // template is the template file or built-in template for template output
+	groupOnly    bool          // groupOnly determines if glen only gets variables from the project's parent groups
+	ciVars       bool          // ciVars determines if glen includes the GitLab predefined CI/CD variables
+	ciConfig     bool          // ciConfig determines if glen includes the variables from .gitlab-ci.yml
+	job          string        // job is the job in .gitlab-ci.yml whose variables glen includes
+	pipeline     int64         // pipeline is the ID of the pipeline whose variables glen reproduces
+	jobID        int64         // jobID is the ID of the job whose variables glen reproduces
+	pipelineSrc  string        // pipelineSrc is the CI_PIPELINE_SOURCE that glen simulates
+	simulateRef  bool          // simulateRef determines if glen drops protected variables on unprotected refs
+	ref          string        // ref is the branch or tag that glen simulates
+	reveal       bool          // reveal determines if glen prints masked values in table and JSON output
+	revealPrefix int           // revealPrefix is the number of characters of masked values that glen prints
+	expand       bool          // expand determines if glen expands variable references in values
+	expandEnv    bool          // expandEnv determines if references can be resolved from the local environment
+	host         string        // host overrides the GitLab host from the remote when calling the API
+	apiURL       string        // apiURL overrides the GitLab API URL
+	environment  string        // environment is the environment that variable scopes are matched against
+	include      []string      // include are globs of keys that glen includes
+	exclude      []string      // exclude are globs of keys that glen excludes
+	includeRegex []string      // includeRegex are regular expressions of keys that glen includes
+	excludeRegex []string      // excludeRegex are regular expressions of keys that glen excludes
+	stripPrefix  string        // stripPrefix is removed from the keys of variables that have it
+	addPrefix    string        // addPrefix is added to the key of every variable
+	cacheTTL     time.Duration // cacheTTL is how long the variables of a run are reused for
+
+	profile *profile // profile is the config profile in use, set by applyConfig
+
+	resolveKeyOnce sync.Once // resolveKeyOnce resolves the API key once for every project
+	resolvedKey    string    // resolvedKey is the API key resolved from apiKey and the profile
+	resolveKeyErr  error     // resolveKeyErr is the error from resolving the API key
+
+	tokenSourcesMu sync.Mutex                         // tokenSourcesMu guards tokenSources
+	tokenSources   map[string]*credentialsTokenSource // tokenSources are the stored credentials in use, by host
+
+	noDaemon      bool                    // noDaemon gets variables from GitLab even if a daemon is running
+	revalidate    bool                    // revalidate caches responses and revalidates them with ETags, for polling
+	httpClientsMu sync.Mutex              // httpClientsMu guards httpClients
+	httpClients   map[string]*http.Client // httpClients are the HTTP clients in use, by host
+}
+
 func glenCmd() *cobra.Command {
-	var (
-		recurse      bool   // recurse determines if glen with also get variables from the project's parent groups
-		apiKey       string // apiKey is the GitLab key that we should use when calling the API
-		directory    string // directory is the path to the git repo that we should run glen on
-		remoteName   string // remoteName is the name of the GitLab remote in your git repo
-		outputFormat string // outputFormat is the text format that we should use to print our results to stdout
-		groupOnly    bool   // groupOnly determines if glen only gets variables from the project's parent groups
-	)
+	opts := &glenOptions{}
 
 	cmd := &cobra.Command{
 		Use:   "glen",
@@ -38,55 +124,408 @@ CI/CD pipeline and print them locally, ready for exporting.
 With the default flags you can run 'eval $(glen -r)' to export the variables of
 your project and the variables of every parent group.`,
 		Args: cobra.ExactArgs(0),
-		Run: func(_ *cobra.Command, _ []string) {
+		Run: func(cmd *cobra.Command, _ []string) {
 			var err error
 
-			repo := glen.NewRepo()
-			repo.LocalPath = directory
-			repo.RemoteName = remoteName
-
-			err = repo.Init()
+			opts.profile, _, err = applyConfig(cmd, configDirectory(opts.directories))
 			if err != nil {
-				slog.Error("failed to initialize the repository", "error", err)
+				slog.Error("failed to load config", "error", err)
 				os.Exit(1)
 			}
 
-			vars := glen.NewVariables(repo)
-			vars.GroupOnly = groupOnly
-			vars.Recurse = recurse
-			if apiKey != "GITLAB_TOKEN" {
-				vars.SetAPIKey(apiKey)
+			outOpts, err := opts.outputOptions()
+			if err != nil {
+				slog.Error("failed to set up the output", "error", err)
+				os.Exit(1)
 			}
 
-			if !vars.IsAPIKeySet() {
-				fmt.Println("GitLab API key not set. Please use --api-key/-k flag or set GITLAB_TOKEN environment variable.")
+			dirs, err := expandDirectories(opts.directories)
+			if err != nil {
+				slog.Error("failed to find directories", "error", err)
 				os.Exit(1)
 			}
 
-			err = vars.Init()
+			projects, err := opts.projectVariables(cmd.Flags(), dirs)
 			if err != nil {
-				slog.Error("failed to initialize variables", "error", err)
+				slog.Error("failed to get variables", "error", err)
 				os.Exit(1)
 			}
 
-			output(vars.Env, outputFormat)
+			if opts.outputFormat == outputTemplate {
+				err = opts.openRepos(projects)
+				if err != nil {
+					slog.Error("failed to open the repos", "error", err)
+					os.Exit(1)
+				}
+			}
+
+			switch {
+			case len(projects) == 1:
+				output(os.Stdout, projects[0], opts.outputFormat, outOpts)
+			case opts.merge:
+				output(os.Stdout, &projectVariables{Variables: mergeProjects(projects)}, opts.outputFormat, outOpts)
+			default:
+				outputProjects(os.Stdout, projects, opts.outputFormat, outOpts)
+			}
 		},
 	}
 
-	cmd.Flags().BoolVarP(&recurse, "recurse", "r", false, flagRecurseDesc)
-	cmd.Flags().StringVarP(&apiKey, "api-key", "k", "GITLAB_TOKEN", flagAPIKeyDesc)
-	cmd.Flags().StringVarP(&directory, "directory", "d", ".", flagDirectoryDesc)
-	cmd.Flags().StringVarP(&remoteName, "remote-name", "n", "origin", flagRemoteNameDesc)
-	cmd.Flags().StringVarP(&outputFormat, "output", "o", "export", flagOutputFormatDesc)
-	cmd.Flags().BoolVarP(&groupOnly, "group-only", "g", false, flagGroupDesc)
+	addGlenFlags(cmd.Flags(), opts)
+	cmd.PersistentFlags().String("profile", "", flagProfileDesc)
+	cmd.PersistentFlags().CountP("verbose", "v", flagVerboseDesc)
+	cmd.PersistentFlags().String("log-format", logFormatText, flagLogFormatDesc)
+	addHTTPFlags(cmd.PersistentFlags())
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, _ []string) error {
+		return setupLogging(cmd)
+	}
 
 	return cmd
 }
 
+// addGlenFlags adds the flags of the root glen command to fs, bound to opts.
+func addGlenFlags(fs *pflag.FlagSet, opts *glenOptions) {
+	fs.BoolVarP(&opts.recurse, "recurse", "r", false, flagRecurseDesc)
+	fs.StringVarP(&opts.apiKey, "api-key", "k", "GITLAB_TOKEN", flagAPIKeyDesc)
+	fs.StringArrayVarP(&opts.directories, "directory", "d", []string{"."}, flagDirectoryDesc)
+	fs.StringVarP(&opts.remoteName, "remote-name", "n", "origin", flagRemoteNameDesc)
+	fs.StringVarP(&opts.outputFormat, "output", "o", "export", flagOutputFormatDesc)
+	fs.StringSliceVar(&opts.recipients, "recipient", nil, flagEncryptToDesc)
+	fs.StringVar(&opts.sort, "sort", string(glen.SortByKey), flagSortDesc)
+	fs.BoolVar(&opts.jsonArray, "json-array", false, flagJSONArrayDesc)
+	fs.StringVar(&opts.template, "template", "", flagTemplateDesc)
+	fs.BoolVarP(&opts.groupOnly, "group-only", "g", false, flagGroupDesc)
+	fs.BoolVar(&opts.ciVars, "ci-vars", false, flagCIVarsDesc)
+	fs.BoolVar(&opts.ciConfig, "ci-config", false, flagCIConfigDesc)
+	fs.StringVar(&opts.job, "job", "", flagJobDesc)
+	fs.Int64Var(&opts.pipeline, "pipeline", 0, flagPipelineDesc)
+	fs.Int64Var(&opts.jobID, "job-id", 0, flagJobIDDesc)
+	fs.StringVar(&opts.pipelineSrc, "pipeline-source", "", flagPipelineSrcDesc)
+	fs.BoolVar(&opts.simulateRef, "simulate-ref", false, flagSimulateRefDesc)
+	fs.StringVar(&opts.ref, "ref", "", flagRefDesc)
+	fs.BoolVar(&opts.reveal, "reveal", false, flagRevealDesc)
+	fs.IntVar(&opts.revealPrefix, "reveal-prefix", 0, flagRevealPrefixDesc)
+	fs.BoolVar(&opts.expand, "expand", true, flagExpandDesc)
+	fs.BoolVar(&opts.expandEnv, "expand-env", false, flagExpandEnvDesc)
+	fs.StringVar(&opts.host, "host", "", flagAPIHostDesc)
+	fs.StringVar(&opts.apiURL, "api-url", "", flagAPIURLDesc)
+	fs.StringVarP(&opts.environment, "environment", "e", "", flagEnvironmentDesc)
+	fs.StringSliceVar(&opts.include, "include", nil, flagIncludeDesc)
+	fs.StringSliceVar(&opts.exclude, "exclude", nil, flagExcludeDesc)
+	fs.StringArrayVar(&opts.includeRegex, "include-regex", nil, flagIncludeRegexDesc)
+	fs.StringArrayVar(&opts.excludeRegex, "exclude-regex", nil, flagExcludeRegexDesc)
+	fs.StringVar(&opts.stripPrefix, "strip-prefix", "", flagStripPrefixDesc)
+	fs.StringVar(&opts.addPrefix, "add-prefix", "", flagAddPrefixDesc)
+	fs.BoolVar(&opts.merge, "merge", false, flagMergeDesc)
+	fs.DurationVar(&opts.cacheTTL, "cache-ttl", 0, flagCacheTTLDesc)
+	fs.BoolVar(&opts.noDaemon, "no-daemon", false, flagNoDaemonDesc)
+}
+
+// outputOptions returns the settings that change how variables are printed. It
+// fails early if the sort order is unknown, or if the output is encrypted and a
+// recipient is missing or invalid.
+func (opts *glenOptions) outputOptions() (outputOptions, error) {
+	order, err := glen.ParseSortOrder(opts.sort)
+	if err != nil {
+		return outputOptions{}, fmt.Errorf("parse --sort: %w", err)
+	}
+
+	recipients, err := parseX25519Recipients(opts.recipients)
+	if err != nil {
+		return outputOptions{}, err
+	}
+	if encryptedFormat(opts.outputFormat) && len(recipients) == 0 {
+		return outputOptions{}, errNoOutputRecipients
+	}
+
+	outOpts := outputOptions{
+		reveal:       opts.reveal,
+		revealPrefix: opts.revealPrefix,
+		recipients:   recipients,
+		sort:         order,
+		jsonArray:    opts.jsonArray,
+	}
+
+	if opts.outputFormat == outputTemplate {
+		if opts.template == "" {
+			return outputOptions{}, errNoTemplate
+		}
+
+		outOpts.template, err = glen.ParseTemplate(expandHome(opts.template))
+		if err != nil {
+			return outputOptions{}, fmt.Errorf("parse --template: %w", err)
+		}
+	}
+
+	return outOpts, nil
+}
+
+// openRepos opens the git repo of every project, for templates to read.
+func (opts *glenOptions) openRepos(projects []*projectVariables) error {
+	for _, p := range projects {
+		repo, err := openRepo(p.directory, opts.remoteName, opts.host)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.directory, err)
+		}
+		p.repo = repo
+	}
+
+	return nil
+}
+
+// variables collects, expands and filters the variables selected by opts for the
+// git repo in directory, connecting to GitLab as configured by the flags in fs.
+func (opts *glenOptions) variables(fs *pflag.FlagSet, directory string) (*glen.Variables, error) {
+	repo, err := openRepo(directory, opts.remoteName, opts.host)
+	if err != nil {
+		return nil, fmt.Errorf("initialize the repository: %w", err)
+	}
+
+	client, err := opts.httpClient(fs, repo.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey, tokenSource, err := opts.resolveAuth(repo.BaseURL, client)
+	if err != nil {
+		return nil, err
+	}
+
+	includeRegex, err := compileRegexps(opts.includeRegex)
+	if err != nil {
+		return nil, err
+	}
+	excludeRegex, err := compileRegexps(opts.excludeRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := glen.NewVariables(repo)
+	vars.GroupOnly = opts.groupOnly
+	vars.Recurse = opts.recurse
+	vars.CIVars = opts.ciVars
+	if opts.ciConfig || opts.job != "" {
+		vars.CIConfigPath = glen.DefaultCIConfigPath
+		vars.Job = opts.job
+	}
+	vars.PipelineID = opts.pipeline
+	vars.JobID = opts.jobID
+	vars.PipelineSource = opts.pipelineSrc
+	vars.SimulateRef = opts.simulateRef || opts.ref != ""
+	vars.Ref = opts.ref
+	vars.Environment = opts.environment
+	vars.Include = opts.include
+	vars.Exclude = opts.exclude
+	vars.IncludeRegex = includeRegex
+	vars.ExcludeRegex = excludeRegex
+	vars.StripPrefix = opts.stripPrefix
+	vars.AddPrefix = opts.addPrefix
+	vars.APIURL = opts.apiURL
+	vars.HTTPClient = client
+	vars.Logger = slog.Default()
+	vars.SetAPIKey(apiKey)
+	vars.TokenSource = tokenSource
+
+	err = vars.Init()
+	if err != nil {
+		return nil, fmt.Errorf("initialize variables: %w", err)
+	}
+
+	if opts.expand {
+		err = opts.expandVariables(vars)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	vars.Filter()
+
+	return vars, nil
+}
+
+// expandVariables expands the variable references in the values of vars, from
+// the local environment as well if --expand-env is set.
+func (opts *glenOptions) expandVariables(vars *glen.Variables) error {
+	var lookups []glen.LookupFunc
+	if opts.expandEnv {
+		lookups = append(lookups, os.LookupEnv)
+	}
+
+	err := vars.Expand(lookups...)
+	if err != nil {
+		return fmt.Errorf("expand variables: %w", err)
+	}
+	if len(vars.Unresolved) > 0 {
+		slog.Warn("unresolved variable references", "keys", vars.Unresolved)
+	}
+
+	return nil
+}
+
+// openRepo returns the git repo in directory, whose GitLab remote is remoteName.
+// Its GitLab host is resolved by configureHosts, unless host overrides it.
+func openRepo(directory string, remoteName string, host string) (*glen.Repo, error) {
+	repo := glen.NewRepo()
+	repo.LocalPath = directory
+	repo.RemoteName = remoteName
+	repo.Logger = slog.Default()
+
+	err := configureHosts(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repo.Init()
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	if host != "" {
+		repo.BaseURL = host
+	}
+
+	return repo, nil
+}
+
+// resolveAPIKey resolves the API key once, since projects are fetched concurrently
+// and a profile may get the key by running a command.
+func (opts *glenOptions) resolveAPIKey() (string, error) {
+	opts.resolveKeyOnce.Do(func() {
+		opts.resolvedKey, opts.resolveKeyErr = resolveAPIKey(opts.apiKey, opts.profile)
+	})
+
+	return opts.resolvedKey, opts.resolveKeyErr
+}
+
+// authIdentity returns what identifies the credentials that glen calls GitLab with
+// for the git repo in directory: the API key or, when there is none, the stored
+// login of its host. It is only used in hashes, never stored or logged.
+func (opts *glenOptions) authIdentity(directory string) (string, error) {
+	key, err := opts.resolveAPIKey()
+	if err == nil {
+		return "key:" + key, nil
+	}
+	if !errors.Is(err, errAPIKeyNotSet) {
+		return "", err
+	}
+
+	repo, err := openRepo(directory, opts.remoteName, opts.host)
+	if err != nil {
+		return "", fmt.Errorf("initialize the repository: %w", err)
+	}
+
+	creds, err := readCredentials(repo.BaseURL)
+	if errors.Is(err, errNotLoggedIn) {
+		return "", errAPIKeyNotSet
+	}
+	if err != nil {
+		return "", err
+	}
+
+	identity := "login:" + creds.Host + "\x00" + creds.ClientID
+	if creds.Token != nil {
+		identity += "\x00" + creds.Token.RefreshToken
+	}
+
+	return identity, nil
+}
+
+// resolveAuth returns the API key or, when there is none, a token source for the
+// stored credentials of host that refreshes them with client. Projects on the same
+// host share a token source, so that its refresh token is only used once.
+func (opts *glenOptions) resolveAuth(host string, client *http.Client) (string, oauth2.TokenSource, error) {
+	key, err := opts.resolveAPIKey()
+	if !errors.Is(err, errAPIKeyNotSet) {
+		return key, nil, err
+	}
+
+	opts.tokenSourcesMu.Lock()
+	defer opts.tokenSourcesMu.Unlock()
+
+	if ts, ok := opts.tokenSources[host]; ok {
+		return "", ts, nil
+	}
+
+	ts, err := loadTokenSource(host, client)
+	if err != nil {
+		return "", nil, err
+	}
+	if opts.tokenSources == nil {
+		opts.tokenSources = make(map[string]*credentialsTokenSource)
+	}
+	opts.tokenSources[host] = ts
+
+	return "", ts, nil
+}
+
+// httpClient returns the HTTP client for host, shared by every project on the host
+// so that its connections are reused. When opts.revalidate is set, the client
+// revalidates the responses of earlier calls with ETags.
+func (opts *glenOptions) httpClient(fs *pflag.FlagSet, host string) (*http.Client, error) {
+	opts.httpClientsMu.Lock()
+	defer opts.httpClientsMu.Unlock()
+
+	if client, ok := opts.httpClients[host]; ok {
+		return client, nil
+	}
+
+	client, err := httpClient(fs, host)
+	if err != nil {
+		return nil, err
+	}
+	if opts.revalidate {
+		client.Transport = &glen.ETagTransport{Base: client.Transport}
+	}
+	if opts.httpClients == nil {
+		opts.httpClients = make(map[string]*http.Client)
+	}
+	opts.httpClients[host] = client
+
+	return client, nil
+}
+
+// closeIdleConnections closes the idle connections of the HTTP clients of opts,
+// once they are no longer used.
+func (opts *glenOptions) closeIdleConnections() {
+	opts.httpClientsMu.Lock()
+	defer opts.httpClientsMu.Unlock()
+
+	for _, client := range opts.httpClients {
+		client.CloseIdleConnections()
+	}
+}
+
+// compileRegexps compiles a list of regular expressions.
+func compileRegexps(expressions []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(expressions))
+	for _, expr := range expressions {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("compile %q: %w", expr, err)
+		}
+		compiled = append(compiled, re)
+	}
+
+	return compiled, nil
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute(v string) error {
 	glen := glenCmd()
 	glen.AddCommand(versionCmd(v))
+	glen.AddCommand(backupCmd())
+	glen.AddCommand(restoreCmd())
+	glen.AddCommand(configCmd())
+	glen.AddCommand(doctorCmd())
+	glen.AddCommand(loginCmd())
+	glen.AddCommand(logoutCmd())
+	glen.AddCommand(authCmd())
+	glen.AddCommand(hookCmd())
+	glen.AddCommand(hookEnvCmd())
+	glen.AddCommand(allowCmd())
+	glen.AddCommand(denyCmd())
+	glen.AddCommand(watchCmd())
+	glen.AddCommand(serveCmd())
+	glen.AddCommand(pushCmd())
+	glen.AddCommand(decryptCmd())
 
 	err := glen.Execute()
 	if err != nil {
@@ -0,0 +1,601 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	flagSocketDesc   = "The Unix socket of the daemon. Defaults to $XDG_RUNTIME_DIR/glen/glen.sock, or glen.sock in the user cache directory"
+	flagServeTTLDesc = "How long the daemon reuses the variables of a project before getting them from GitLab again"
+	flagNoDaemonDesc = "Get variables from GitLab even if a glen serve daemon is running"
+)
+
+const (
+	// socketFile is the name of the daemon socket in its directory.
+	socketFile = "glen.sock"
+	// defaultServeTTL is how long the daemon reuses variables by default.
+	defaultServeTTL = time.Minute
+	// daemonDialTimeout is how long the CLI waits to connect to the daemon.
+	daemonDialTimeout = time.Second
+	// daemonShutdownTimeout is how long the daemon waits for requests when stopping.
+	daemonShutdownTimeout = 5 * time.Second
+	// minEvictInterval is the shortest interval between removals of expired entries.
+	minEvictInterval = time.Second
+)
+
+// daemonURL is the base URL of requests to the daemon. The host is ignored, since
+// requests are sent on the socket.
+const daemonURL = "http://glen/v1"
+
+var (
+	// errDaemonRunning is returned when glen serve finds a daemon on its socket.
+	errDaemonRunning = errors.New("a glen serve daemon is already running")
+	// errPeerNotAllowed is returned when the other end of the socket is another user.
+	errPeerNotAllowed = errors.New("socket peer is another user")
+	// errDaemon is returned when the daemon fails to get variables.
+	errDaemon = errors.New("glen serve daemon")
+)
+
+// daemonRequest asks the daemon for the variables of the git repo in Directory.
+// Flags are the values of the flags that select variables, by name, after the
+// config files and environment are applied. The API key is never sent: the daemon
+// authenticates with its own environment, the token source of Profile, or the
+// credentials stored by 'glen login'.
+type daemonRequest struct {
+	Directory string              `json:"directory"`
+	Profile   string              `json:"profile"`
+	Flags     map[string][]string `json:"flags"`
+}
+
+// daemonError is the body of a failed daemon response.
+type daemonError struct {
+	Error string `json:"error"`
+}
+
+// daemonProject describes a project whose variables the daemon holds, without them.
+type daemonProject struct {
+	Project   string    `json:"project"`
+	Directory string    `json:"directory"`
+	Fetched   time.Time `json:"fetched"`
+}
+
+// socketPath returns the path of the daemon socket: GLEN_SOCKET, or glen.sock in
+// $XDG_RUNTIME_DIR/glen or in the user cache directory.
+func socketPath() (string, error) {
+	if path := os.Getenv(envName("socket")); path != "" {
+		return path, nil
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, cacheDir, socketFile), nil
+	}
+
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("find cache directory: %w", err)
+	}
+
+	return filepath.Join(base, cacheDir, socketFile), nil
+}
+
+func serveCmd() *cobra.Command {
+	var (
+		socket string        // socket is the path of the Unix socket to listen on
+		ttl    time.Duration // ttl is how long the variables of a project are reused
+	)
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serves variables to glen and other tools on a local socket",
+		Long: `Serve runs a daemon that gets and holds the variables of your repos, and
+serves them as JSON over HTTP on a Unix socket. While it runs, glen and the shell
+hook ask the daemon instead of calling GitLab themselves, so that several tools
+share one set of variables and API calls. Only processes of your own user can
+connect to the socket. Variables are dropped from memory once they are older
+than --ttl.
+
+The daemon authenticates with its own GITLAB_TOKEN, the token source of the
+selected profile or the credentials stored by 'glen login'. glen skips the daemon
+when --api-key or --no-daemon is passed, and gets variables itself when the
+daemon fails.
+
+  POST /v1/variables  gets the variables of a repo, like glen -o json
+  GET  /v1/projects   lists the projects the daemon holds variables for`,
+		Args: cobra.NoArgs,
+		Run: func(_ *cobra.Command, _ []string) {
+			if socket == "" {
+				var err error
+
+				socket, err = socketPath()
+				if err != nil {
+					slog.Error("failed to find socket", "error", err)
+					os.Exit(1)
+				}
+			}
+
+			err := serve(socket, ttl)
+			if err != nil {
+				slog.Error("failed to serve variables", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&socket, "socket", "", flagSocketDesc)
+	cmd.Flags().DurationVar(&ttl, "ttl", defaultServeTTL, flagServeTTLDesc)
+
+	return cmd
+}
+
+// serve listens on socket and serves variables until glen is interrupted.
+func serve(socket string, ttl time.Duration) error {
+	listener, err := listenSocket(socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket) //nolint:errcheck
+
+	d := &daemon{ttl: ttl, entries: make(map[string]*daemonEntry)}
+	server := &http.Server{Handler: d.handler(), ReadHeaderTimeout: daemonDialTimeout}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.evictLoop(ctx, max(ttl, minEvictInterval))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	go func() {
+		sig := <-signals
+		slog.Info("stopping", "signal", sig.String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), daemonShutdownTimeout)
+		defer cancel()
+		server.Shutdown(ctx) //nolint:errcheck,gosec
+	}()
+
+	slog.Info("serving variables", "socket", socket, "ttl", ttl)
+
+	err = server.Serve(&peerListener{Listener: listener})
+	if !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serve: %w", err)
+	}
+
+	return nil
+}
+
+// listenSocket listens on a Unix socket at path that only the current user can
+// connect to, replacing the socket of a daemon that is no longer running.
+func listenSocket(path string) (net.Listener, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0o700) //nolint:mnd
+	if err != nil {
+		return nil, fmt.Errorf("create socket directory: %w", err)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		conn, err := net.DialTimeout("unix", path, daemonDialTimeout)
+		if err == nil {
+			conn.Close() //nolint:errcheck,gosec
+
+			return nil, fmt.Errorf("%w on %s", errDaemonRunning, path)
+		}
+
+		err = os.Remove(path)
+		if err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listen on %s: %w", path, err)
+	}
+
+	err = os.Chmod(path, 0o600) //nolint:mnd
+	if err != nil {
+		listener.Close() //nolint:errcheck,gosec
+
+		return nil, fmt.Errorf("restrict socket: %w", err)
+	}
+
+	return listener, nil
+}
+
+// peerListener accepts only connections from processes of the current user.
+type peerListener struct {
+	net.Listener
+}
+
+// Accept waits for the next connection from the current user, closing the others.
+func (l *peerListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		err = checkPeer(conn)
+		if err == nil {
+			return conn, nil
+		}
+
+		slog.Warn("rejected connection", "error", err)
+		conn.Close() //nolint:errcheck,gosec
+	}
+}
+
+// checkPeer returns an error unless the other end of conn is the current user.
+func checkPeer(conn net.Conn) error {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("%w: not a Unix socket", errPeerNotAllowed)
+	}
+
+	uid, err := peerUID(unixConn)
+	if err != nil {
+		return err
+	}
+	if uid != os.Getuid() {
+		return fmt.Errorf("%w: uid %d", errPeerNotAllowed, uid)
+	}
+
+	return nil
+}
+
+// daemon holds the variables of the projects it was asked for.
+type daemon struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*daemonEntry // entries are keyed by directory, profile and flags
+}
+
+// daemonEntry holds the variables of one request.
+type daemonEntry struct {
+	mu        sync.Mutex // mu makes concurrent requests for the entry wait for one fetch
+	directory string
+	result    *projectVariables
+	fetched   time.Time
+}
+
+// handler returns the HTTP handler of the daemon.
+func (d *daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/variables", d.serveVariables)
+	mux.HandleFunc("GET /v1/projects", d.serveProjects)
+
+	return mux
+}
+
+// serveVariables answers a daemonRequest with the projectVariables it selects.
+func (d *daemon) serveVariables(w http.ResponseWriter, r *http.Request) {
+	var req daemonRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeDaemonError(w, http.StatusBadRequest, fmt.Errorf("decode request: %w", err))
+
+		return
+	}
+	if !filepath.IsAbs(req.Directory) {
+		writeDaemonError(w, http.StatusBadRequest, fmt.Errorf("directory %q is not absolute", req.Directory))
+
+		return
+	}
+
+	entry := d.entry(req)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	cached := entry.result != nil && time.Since(entry.fetched) < d.ttl
+	if !cached {
+		result, err := fetchDaemonRequest(req)
+		if err != nil {
+			writeDaemonError(w, http.StatusBadGateway, err)
+
+			return
+		}
+		entry.result = result
+		entry.fetched = time.Now()
+	}
+
+	slog.Info("served variables", "project", entry.result.Project, "cached", cached)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry.result) //nolint:errcheck,errchkjson,gosec
+}
+
+// serveProjects lists the projects that the daemon holds variables for.
+func (d *daemon) serveProjects(w http.ResponseWriter, _ *http.Request) {
+	d.mu.Lock()
+	entries := make([]*daemonEntry, 0, len(d.entries))
+	for _, e := range d.entries {
+		entries = append(entries, e)
+	}
+	d.mu.Unlock()
+
+	projects := []daemonProject{}
+	for _, e := range entries {
+		e.mu.Lock()
+		if e.result != nil {
+			projects = append(projects, daemonProject{Project: e.result.Project, Directory: e.directory, Fetched: e.fetched})
+		}
+		e.mu.Unlock()
+	}
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Directory < projects[j].Directory })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(projects) //nolint:errcheck,errchkjson,gosec
+}
+
+// evictLoop removes expired entries every interval until ctx is done.
+func (d *daemon) evictLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.evict()
+		}
+	}
+}
+
+// evict removes the entries whose variables are older than the TTL, or that have
+// none, so that the daemon does not hold every variable it ever fetched. Entries
+// that are being fetched are kept.
+func (d *daemon) evict() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, e := range d.entries {
+		if !e.mu.TryLock() {
+			continue
+		}
+		if e.result == nil || time.Since(e.fetched) >= d.ttl {
+			e.result = nil
+			delete(d.entries, key)
+		}
+		e.mu.Unlock()
+	}
+}
+
+// entry returns the entry of req, creating it if needed. Entries are keyed by
+// the commit checked out in the directory too, so that switching branches does
+// not return the variables of the previous one.
+func (d *daemon) entry(req daemonRequest) *daemonEntry {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s", req.Directory, req.Profile, headKey(req.Directory))
+
+	names := make([]string, 0, len(req.Flags))
+	for name := range req.Flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "\x00%s=%q", name, req.Flags[name])
+	}
+	key := hex.EncodeToString(h.Sum(nil))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e, ok := d.entries[key]
+	if !ok {
+		e = &daemonEntry{directory: req.Directory}
+		d.entries[key] = e
+	}
+
+	return e
+}
+
+// fetchDaemonRequest gets the variables that req selects from GitLab.
+func fetchDaemonRequest(req daemonRequest) (*projectVariables, error) {
+	opts := &glenOptions{}
+	fs := daemonFlagSet(opts)
+
+	err := setFlagValues(fs, req.Flags)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.profile, _, err = loadProfile(req.Profile, req.Directory)
+	if err != nil {
+		return nil, err
+	}
+	defer opts.closeIdleConnections()
+
+	vars, err := opts.variables(fs, req.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	return &projectVariables{Project: vars.Repo.Path, Variables: vars.Vars}, nil
+}
+
+// writeDaemonError writes err as a failed daemon response.
+func writeDaemonError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(daemonError{Error: err.Error()}) //nolint:errcheck,errchkjson,gosec
+}
+
+// daemonFlagSet returns the flags that the daemon gets variables with, bound to opts.
+func daemonFlagSet(opts *glenOptions) *pflag.FlagSet {
+	fs := pflag.NewFlagSet("glen", pflag.ContinueOnError)
+	addGlenFlags(fs, opts)
+	addHTTPFlags(fs)
+
+	return fs
+}
+
+// flagValues returns the values of the flags in fs that the daemon selects
+// variables with, except the API key, by name.
+func flagValues(fs *pflag.FlagSet) map[string][]string {
+	values := make(map[string][]string)
+	daemonFlagSet(&glenOptions{}).VisitAll(func(df *pflag.Flag) {
+		f := fs.Lookup(df.Name)
+		if f == nil || !selectsVariables(f.Name) || f.Name == "api-key" {
+			return
+		}
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			values[f.Name] = s.GetSlice()
+		} else {
+			values[f.Name] = []string{f.Value.String()}
+		}
+	})
+
+	return values
+}
+
+// setFlagValues sets the flags in fs to values returned by flagValues.
+func setFlagValues(fs *pflag.FlagSet, values map[string][]string) error {
+	for name, value := range values {
+		f := fs.Lookup(name)
+		if f == nil {
+			return fmt.Errorf("unknown flag %s, restart the daemon if glen was upgraded", name)
+		}
+
+		var err error
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			err = s.Replace(value)
+		} else if len(value) == 1 {
+			err = f.Value.Set(value[0])
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// daemonVariables returns the variables selected by the flags in fs for the git
+// repo in directory from the glen serve daemon. It reports false if the daemon
+// is not used: when none is running, when it fails to get the variables, when
+// --api-key or --no-daemon is passed, or when variables are polled by glen watch.
+func (opts *glenOptions) daemonVariables(fs *pflag.FlagSet, directory string) (*projectVariables, bool, error) {
+	if opts.noDaemon || opts.revalidate || fs.Changed("api-key") {
+		return nil, false, nil
+	}
+
+	socket, err := socketPath()
+	if err != nil {
+		return nil, false, nil //nolint:nilerr
+	}
+
+	body, err := newDaemonRequest(fs, directory)
+	if err != nil {
+		return nil, false, err
+	}
+
+	resp, err := daemonClient(socket).Post(daemonURL+"/variables", "application/json", bytes.NewReader(body)) //nolint:noctx
+	if errors.Is(err, errPeerNotAllowed) {
+		slog.Warn("not using daemon", "socket", socket, "error", err)
+
+		return nil, false, nil
+	}
+	if err != nil {
+		slog.Debug("not using daemon", "socket", socket, "error", err)
+
+		return nil, false, nil
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	result, err := decodeDaemonResponse(resp)
+	if err != nil {
+		slog.Warn("not using daemon, getting variables from GitLab", "socket", socket, "error", err)
+
+		return nil, false, nil
+	}
+
+	slog.Debug("using daemon", "socket", socket, "project", result.Project)
+
+	return result, true, nil
+}
+
+// newDaemonRequest returns the body of a daemonRequest for the variables selected
+// by the flags in fs for the git repo in directory.
+func newDaemonRequest(fs *pflag.FlagSet, directory string) ([]byte, error) {
+	directory, err := filepath.Abs(directory)
+	if err != nil {
+		return nil, fmt.Errorf("find absolute path of %s: %w", directory, err)
+	}
+
+	profile, err := profileName(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(daemonRequest{Directory: directory, Profile: profile, Flags: flagValues(fs)})
+	if err != nil {
+		return nil, fmt.Errorf("marshal daemon request: %w", err)
+	}
+
+	return body, nil
+}
+
+// decodeDaemonResponse returns the variables in a daemon response, or the error
+// of a failed one.
+func decodeDaemonResponse(resp *http.Response) (*projectVariables, error) {
+	if resp.StatusCode != http.StatusOK {
+		var e daemonError
+		json.NewDecoder(resp.Body).Decode(&e) //nolint:errcheck,gosec
+
+		return nil, fmt.Errorf("%w: %s", errDaemon, e.Error)
+	}
+
+	var result projectVariables
+
+	err := json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("decode daemon response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// daemonClient returns an HTTP client that sends every request to the daemon on
+// socket, after checking that the daemon runs as the current user.
+func daemonClient(socket string) *http.Client {
+	dialer := &net.Dialer{Timeout: daemonDialTimeout}
+
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, "unix", socket)
+			if err != nil {
+				return nil, err //nolint:wrapcheck
+			}
+
+			err = checkPeer(conn)
+			if err != nil {
+				conn.Close() //nolint:errcheck,gosec
+
+				return nil, err
+			}
+
+			return conn, nil
+		},
+	}}
+}
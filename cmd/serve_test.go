@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lingrino/glen/glen"
+	"github.com/lingrino/glen/glentest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDaemonEvict(t *testing.T) {
+	t.Parallel()
+
+	result := &projectVariables{Project: "group/project"}
+	d := &daemon{ttl: time.Minute, entries: map[string]*daemonEntry{
+		"fresh":    {result: result, fetched: time.Now()},
+		"expired":  {result: result, fetched: time.Now().Add(-2 * time.Minute)},
+		"failed":   {},
+		"fetching": {fetched: time.Now().Add(-2 * time.Minute)},
+	}}
+	d.entries["fetching"].mu.Lock()
+
+	d.evict()
+
+	assert.ElementsMatch(t, []string{"fresh", "fetching"}, entryKeys(d.entries))
+}
+
+func entryKeys(m map[string]*daemonEntry) []string {
+	k := make([]string, 0, len(m))
+	for key := range m {
+		k = append(k, key)
+	}
+
+	return k
+}
+
+// serveTestDaemon serves handler on a new socket that GLEN_SOCKET points to.
+func serveTestDaemon(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), socketFile)
+	t.Setenv(envName("socket"), socket)
+
+	listener, err := listenSocket(socket)
+	require.NoError(t, err)
+
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: time.Second}
+	go server.Serve(listener) //nolint:errcheck
+
+	t.Cleanup(func() {
+		server.Close() //nolint:errcheck,gosec
+	})
+}
+
+//nolint:paralleltest // sets GLEN_SOCKET
+func TestDaemonVariables(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantOK  bool
+	}{
+		{
+			name: "daemon",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				json.NewEncoder(w).Encode(projectVariables{ //nolint:errcheck,errchkjson,gosec
+					Project:   "group/project",
+					Variables: map[string]glen.Variable{"FOO": {Key: "FOO", Value: "bar"}},
+				})
+			},
+			wantOK: true,
+		},
+		{
+			name: "daemon error",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				writeDaemonError(w, http.StatusBadGateway, errDaemon)
+			},
+		},
+		{
+			name: "invalid response",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Write([]byte("{")) //nolint:errcheck,gosec
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serveTestDaemon(t, tt.handler)
+
+			opts := &glenOptions{}
+			fs := daemonFlagSet(opts)
+			fs.String("profile", "", flagProfileDesc)
+
+			result, ok, err := opts.daemonVariables(fs, glentest.NewRepo(t, nil))
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, "bar", result.Variables["FOO"].Value)
+			} else {
+				assert.Nil(t, result)
+			}
+		})
+	}
+}
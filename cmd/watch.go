@@ -0,0 +1,322 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/lingrino/glen/glen"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	flagIntervalDesc = "How often to check GitLab for changed variables"
+	flagOutFileDesc  = "Rewrite this file, in the format of --output, whenever the variables change"
+)
+
+const (
+	// defaultWatchInterval is how often glen watch polls GitLab by default.
+	defaultWatchInterval = 30 * time.Second
+	// stopTimeout is how long a command has to exit after SIGTERM before it is killed.
+	stopTimeout = 10 * time.Second
+)
+
+// errNothingToWatch is returned when glen watch has neither a file nor a command.
+var errNothingToWatch = errors.New("set --out-file or a command to run after --")
+
+func watchCmd() *cobra.Command {
+	opts := &glenOptions{}
+
+	var (
+		interval time.Duration // interval is how often GitLab is polled
+		outFile  string        // outFile is the file that is rewritten when the variables change
+	)
+
+	cmd := &cobra.Command{
+		Use:   "watch [flags] [-- command [args...]]",
+		Short: "Re-emits variables whenever they change in GitLab",
+		Long: `Watch polls GitLab for the variables of your repo and, whenever they change,
+rewrites --out-file or restarts the command after '--' with the variables in its
+environment. The command is stopped with SIGTERM, and killed if it has not exited
+within 10 seconds. Watch exits when the command does, with its exit status.
+
+Polls revalidate the previous responses with ETags, so GitLab does less work when
+nothing changed. Changes are printed to stderr by key, never with their values.
+The variables of several directories are merged, as with --merge.`,
+		Example: `  glen watch -r --out-file .env
+  glen watch -r -- npm run dev`,
+		Run: func(cmd *cobra.Command, args []string) {
+			var err error
+
+			opts.profile, _, err = applyConfig(cmd, configDirectory(opts.directories))
+			if err != nil {
+				slog.Error("failed to load config", "error", err)
+				os.Exit(1)
+			}
+
+			// Every poll must reach GitLab, and revalidation makes that cheap
+			opts.cacheTTL = 0
+			opts.revalidate = true
+
+			dirs, err := expandDirectories(opts.directories)
+			if err != nil {
+				slog.Error("failed to find directories", "error", err)
+				os.Exit(1)
+			}
+
+			w := &watcher{opts: opts, fs: cmd.Flags(), dirs: dirs, outFile: outFile, command: args, changes: os.Stderr}
+
+			code, err := w.run(interval)
+			if err != nil {
+				slog.Error("failed to watch variables", "error", err)
+				os.Exit(1)
+			}
+			os.Exit(code)
+		},
+	}
+
+	addGlenFlags(cmd.Flags(), opts)
+	cmd.Flags().DurationVar(&interval, "interval", defaultWatchInterval, flagIntervalDesc)
+	cmd.Flags().StringVar(&outFile, "out-file", "", flagOutFileDesc)
+
+	return cmd
+}
+
+// watcher polls the variables of dirs and re-emits them when they change.
+type watcher struct {
+	opts    *glenOptions
+	fs      *pflag.FlagSet
+	dirs    []string
+	outFile string    // outFile is rewritten with the variables, if it is set
+	command []string  // command is restarted with the variables, if it is set
+	changes io.Writer // changes is where changed keys are printed, whatever the log level
+
+	vars  map[string]glen.Variable // vars are the variables that were last emitted
+	child *child                   // child is the running command
+}
+
+// run emits the variables, then polls for changes every interval until the command
+// exits or glen is interrupted. It returns the exit status for glen.
+func (w *watcher) run(interval time.Duration) (int, error) {
+	if w.outFile == "" && len(w.command) == 0 {
+		return 0, errNothingToWatch
+	}
+
+	vars, err := w.poll()
+	if err != nil {
+		return 0, err
+	}
+
+	err = w.emit(vars)
+	if err != nil {
+		return 0, err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var exited <-chan struct{}
+		if w.child != nil {
+			exited = w.child.done
+		}
+
+		select {
+		case sig := <-signals:
+			slog.Info("stopping", "signal", sig.String())
+			if w.child != nil {
+				w.child.stop()
+			}
+
+			return 0, nil
+		case <-exited:
+			return w.child.exitCode(), nil
+		case <-ticker.C:
+			err = w.check()
+			if err != nil {
+				if w.child != nil {
+					w.child.stop()
+				}
+
+				return 0, err
+			}
+		}
+	}
+}
+
+// check polls the variables and emits them if they changed. Errors from GitLab
+// are logged and the previous variables are kept, so that an outage does not stop
+// the command, but an error emitting the variables is returned.
+func (w *watcher) check() error {
+	vars, err := w.poll()
+	if err != nil {
+		slog.Warn("failed to get variables, keeping the previous ones", "error", err)
+
+		return nil
+	}
+
+	return w.update(vars)
+}
+
+// update prints the changes from the emitted variables to vars and emits vars if
+// there are any.
+func (w *watcher) update(vars map[string]glen.Variable) error {
+	changes := glen.DiffVariables(w.vars, vars)
+	if len(changes) == 0 {
+		slog.Debug("variables unchanged")
+
+		return nil
+	}
+	for _, c := range changes {
+		fmt.Fprintln(w.changes, c.String())
+	}
+
+	return w.emit(vars)
+}
+
+// poll returns the merged variables of every directory.
+func (w *watcher) poll() (map[string]glen.Variable, error) {
+	projects, err := w.opts.projectVariables(w.fs, w.dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeProjects(projects), nil
+}
+
+// emit writes vars to the file and restarts the command with them.
+func (w *watcher) emit(vars map[string]glen.Variable) error {
+	w.vars = vars
+
+	if w.outFile != "" {
+		err := w.writeFile()
+		if err != nil {
+			return err
+		}
+		slog.Info("wrote variables", "file", w.outFile, "count", len(vars))
+	}
+
+	if len(w.command) > 0 {
+		if w.child != nil {
+			slog.Info("restarting command", "command", w.command[0])
+			w.child.stop()
+		}
+
+		var err error
+
+		w.child, err = startChild(w.command, vars)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeFile replaces the file with the variables atomically, so that tools that
+// read it never see a partial file. The file is readable only by the current user.
+func (w *watcher) writeFile() error {
+	outOpts, err := w.opts.outputOptions()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	output(&buf, &projectVariables{Variables: w.vars}, w.opts.outputFormat, outOpts)
+
+	f, err := os.CreateTemp(filepath.Dir(w.outFile), ".glen-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create %s: %w", w.outFile, err)
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck
+
+	_, err = f.Write(buf.Bytes())
+	if err != nil {
+		f.Close() //nolint:errcheck,gosec
+
+		return fmt.Errorf("write %s: %w", w.outFile, err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("write %s: %w", w.outFile, err)
+	}
+
+	err = os.Rename(f.Name(), w.outFile)
+	if err != nil {
+		return fmt.Errorf("write %s: %w", w.outFile, err)
+	}
+
+	return nil
+}
+
+// child is a running command.
+type child struct {
+	cmd  *exec.Cmd
+	done chan struct{} // done is closed when the command exits
+	err  error         // err is the result of waiting for the command, set before done is closed
+}
+
+// startChild starts command with vars added to the environment of glen.
+func startChild(command []string, vars map[string]glen.Variable) (*child, error) {
+	cmd := exec.Command(command[0], command[1:]...) //nolint:gosec,noctx
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	for k, v := range vars {
+		cmd.Env = append(cmd.Env, k+"="+v.Value)
+	}
+
+	err := cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("start %s: %w", command[0], err)
+	}
+
+	c := &child{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		c.err = cmd.Wait()
+		close(c.done)
+	}()
+
+	return c, nil
+}
+
+// stop stops the command with SIGTERM, or kills it if it does not exit in time.
+func (c *child) stop() {
+	c.cmd.Process.Signal(syscall.SIGTERM) //nolint:errcheck,gosec
+
+	select {
+	case <-c.done:
+	case <-time.After(stopTimeout):
+		slog.Warn("command did not exit, killing it", "command", c.cmd.Path)
+		c.cmd.Process.Kill() //nolint:errcheck,gosec
+		<-c.done
+	}
+}
+
+// exitCode returns the exit status of the exited command.
+func (c *child) exitCode() int {
+	var exitErr *exec.ExitError
+	if errors.As(c.err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if c.err != nil {
+		return 1
+	}
+
+	return 0
+}
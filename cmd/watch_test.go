@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lingrino/glen/glen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcherUpdate(t *testing.T) {
+	t.Parallel()
+
+	var changes bytes.Buffer
+	w := &watcher{
+		opts:    &glenOptions{outputFormat: "export", sort: "key"},
+		outFile: filepath.Join(t.TempDir(), ".env"),
+		changes: &changes,
+	}
+
+	require.NoError(t, w.emit(map[string]glen.Variable{
+		"KEPT":    {Key: "KEPT", Value: "kept"},
+		"REMOVED": {Key: "REMOVED", Value: "removed"},
+		"UPDATED": {Key: "UPDATED", Value: "old"},
+	}))
+	assert.Empty(t, changes.String())
+
+	require.NoError(t, w.update(map[string]glen.Variable{
+		"ADDED":   {Key: "ADDED", Value: "added"},
+		"KEPT":    {Key: "KEPT", Value: "kept"},
+		"UPDATED": {Key: "UPDATED", Value: "new"},
+	}))
+	assert.Equal(t, "+ ADDED\n- REMOVED\n~ UPDATED ("+glen.Variable{Value: "old"}.Fingerprint()+" -> "+
+		glen.Variable{Value: "new"}.Fingerprint()+")\n", changes.String())
+
+	got, err := os.ReadFile(w.outFile)
+	require.NoError(t, err)
+	assert.Equal(t, "export ADDED='added'\nexport KEPT='kept'\nexport UPDATED='new'\n", string(got))
+
+	changes.Reset()
+	require.NoError(t, w.update(w.vars))
+	assert.Empty(t, changes.String())
+}
@@ -0,0 +1,244 @@
+package glen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"filippo.io/age"
+	gitlab "gitlab.com/gitlab-org/api/client-go/v2"
+	"golang.org/x/oauth2"
+)
+
+// BackupVersion is the version of the archive format written by Backup.Write.
+// ReadBackup refuses archives written with a newer version.
+const BackupVersion = 1
+
+// ageHeader is the first line of every binary age encrypted file.
+const ageHeader = "age-encryption.org/v1"
+
+var (
+	// ErrUnsupportedBackupVersion is returned when reading an archive written by a newer glen.
+	ErrUnsupportedBackupVersion = errors.New("unsupported backup version")
+	// ErrBackupEncrypted is returned when reading an encrypted archive without any identities.
+	ErrBackupEncrypted = errors.New("backup is encrypted and no identities were provided")
+)
+
+// Backup represents an archive of all variables in a group and, optionally, all
+// of its subgroups and projects.
+type Backup struct {
+	Version    int         `json:"version"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	BaseURL    string      `json:"baseUrl"`
+	Root       string      `json:"root"`
+	Namespaces []Namespace `json:"namespaces"`
+
+	// Recurse includes every descendant group and project of Root when set.
+	Recurse bool `json:"-"`
+	// APIURL overrides the GitLab API URL, which defaults to https://<BaseURL>/api/v4.
+	APIURL string `json:"-"`
+	// TokenSource authenticates with OAuth access tokens instead of the API key when set.
+	TokenSource oauth2.TokenSource `json:"-"`
+	// HTTPClient is used to call the API instead of http.DefaultClient if it is set.
+	HTTPClient *http.Client `json:"-"`
+
+	apiKey string
+}
+
+// Namespace holds the variables of a single group or project. Kind is one of
+// SourceGroup or SourceProject.
+type Namespace struct {
+	Kind      string     `json:"kind"`
+	Path      string     `json:"path"`
+	Variables []Variable `json:"variables"`
+}
+
+// NewBackup returns an empty Backup of the group at root on the GitLab instance
+// at baseURL (e.g. "gitlab.com"). Like NewVariables, this assumes you have a
+// GitLab API key set as GITLAB_TOKEN. Set Backup.Recurse=true to also back up
+// every subgroup and project of the group.
+func NewBackup(baseURL string, root string) *Backup {
+	b := &Backup{}
+
+	b.Version = BackupVersion
+	b.BaseURL = baseURL
+	b.Root = root
+	b.Recurse = false
+	b.apiKey = os.Getenv("GITLAB_TOKEN")
+
+	return b
+}
+
+// SetAPIKey takes a GitLab API key and adds it to the Backup struct.
+func (b *Backup) SetAPIKey(key string) {
+	b.apiKey = key
+}
+
+// Init collects the variables of the root group, and of every descendant group
+// and project if Backup.Recurse=true. Unlike Variables.Init, any failure to read
+// a namespace is returned because a partial backup is worse than none.
+func (b *Backup) Init() error {
+	glc, err := newClient(clientConfig{
+		baseURL: b.BaseURL, apiURL: b.APIURL, apiKey: b.apiKey, tokenSource: b.TokenSource,
+		httpClient: b.HTTPClient,
+	})
+	if err != nil {
+		return err
+	}
+
+	b.CreatedAt = time.Now().UTC()
+	b.Namespaces = nil
+
+	groups := []string{b.Root}
+	if b.Recurse {
+		descendants, err := listDescendantGroups(glc, b.Root)
+		if err != nil {
+			return err
+		}
+		groups = append(groups, descendants...)
+	}
+
+	for _, group := range groups {
+		vars, err := listGroupVariables(glc, group)
+		if err != nil {
+			return err
+		}
+		b.Namespaces = append(b.Namespaces, Namespace{Kind: SourceGroup, Path: group, Variables: vars})
+	}
+
+	if !b.Recurse {
+		return nil
+	}
+
+	projects, err := listGroupProjects(glc, b.Root)
+	if err != nil {
+		return err
+	}
+
+	for _, project := range projects {
+		vars, err := listProjectVariables(glc, project)
+		if err != nil {
+			return err
+		}
+		b.Namespaces = append(b.Namespaces, Namespace{Kind: SourceProject, Path: project, Variables: vars})
+	}
+
+	return nil
+}
+
+// Write writes the backup as JSON to w. If any recipients are given the archive
+// is encrypted to them with age.
+func (b *Backup) Write(w io.Writer, recipients ...age.Recipient) error {
+	data, err := json.MarshalIndent(b, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup: %w", err)
+	}
+
+	if len(recipients) == 0 {
+		_, err = w.Write(append(data, '\n'))
+		if err != nil {
+			return fmt.Errorf("failed to write backup: %w", err)
+		}
+
+		return nil
+	}
+
+	ew, err := age.Encrypt(w, recipients...)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+	_, err = ew.Write(data)
+	if err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	err = ew.Close()
+	if err != nil {
+		return fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+
+	return nil
+}
+
+// ReadBackup reads an archive written by Backup.Write. Encrypted archives are
+// detected automatically and decrypted with the given identities.
+func ReadBackup(r io.Reader, identities ...age.Identity) (*Backup, error) {
+	br := bufio.NewReader(r)
+
+	header, err := br.Peek(len(ageHeader))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	var src io.Reader = br
+	if bytes.Equal(header, []byte(ageHeader)) {
+		if len(identities) == 0 {
+			return nil, ErrBackupEncrypted
+		}
+		src, err = age.Decrypt(br, identities...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt backup: %w", err)
+		}
+	}
+
+	b := &Backup{}
+	err = json.NewDecoder(src).Decode(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse backup: %w", err)
+	}
+
+	if b.Version < 1 || b.Version > BackupVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedBackupVersion, b.Version)
+	}
+
+	return b, nil
+}
+
+// listDescendantGroups returns the full path of every subgroup of a group, at any depth.
+func listDescendantGroups(glc *gitlab.Client, group string) ([]string, error) {
+	opt := &gitlab.ListDescendantGroupsOptions{
+		ListOptions: gitlab.ListOptions{PerPage: pageSize},
+	}
+
+	gs, err := listAll(func(opts ...gitlab.RequestOptionFunc) ([]*gitlab.Group, *gitlab.Response, error) {
+		return glc.Groups.ListDescendantGroups(group, opt, opts...)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subgroups of group %s: %w", group, err)
+	}
+
+	groups := make([]string, 0, len(gs))
+	for _, g := range gs {
+		groups = append(groups, g.FullPath)
+	}
+
+	return groups, nil
+}
+
+// listGroupProjects returns the full path of every project in a group and its subgroups.
+func listGroupProjects(glc *gitlab.Client, group string) ([]string, error) {
+	opt := &gitlab.ListGroupProjectsOptions{
+		ListOptions:      gitlab.ListOptions{PerPage: pageSize},
+		IncludeSubGroups: gitlab.Ptr(true),
+		Simple:           gitlab.Ptr(true),
+	}
+
+	ps, err := listAll(func(opts ...gitlab.RequestOptionFunc) ([]*gitlab.Project, *gitlab.Response, error) {
+		return glc.Groups.ListGroupProjects(group, opt, opts...)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects of group %s: %w", group, err)
+	}
+
+	projects := make([]string, 0, len(ps))
+	for _, p := range ps {
+		projects = append(projects, p.PathWithNamespace)
+	}
+
+	return projects, nil
+}
@@ -0,0 +1,199 @@
+package glen
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/lingrino/glen/glentest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBackup() *Backup {
+	return &Backup{
+		Version:   BackupVersion,
+		CreatedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		BaseURL:   "gitlab.com",
+		Root:      "group",
+		Namespaces: []Namespace{
+			{
+				Kind: SourceGroup,
+				Path: "group",
+				Variables: []Variable{
+					{Key: "GROUP_VAR", Value: "group", VariableType: "env_var", EnvironmentScope: "*", Source: "group:group"},
+				},
+			},
+			{
+				Kind: SourceProject,
+				Path: "group/project",
+				Variables: []Variable{
+					{Key: "SECRET", Value: "s3cr3t", Masked: true, Protected: true, EnvironmentScope: "production"},
+				},
+			},
+		},
+	}
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	b := testBackup()
+
+	var buf bytes.Buffer
+	require.NoError(t, b.Write(&buf))
+	assert.Contains(t, buf.String(), "s3cr3t")
+
+	got, err := ReadBackup(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, b.Namespaces, got.Namespaces)
+	assert.Equal(t, b.CreatedAt, got.CreatedAt)
+	assert.Equal(t, "group", got.Root)
+}
+
+func TestBackupEncryptedRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+
+	b := testBackup()
+
+	var buf bytes.Buffer
+	require.NoError(t, b.Write(&buf, identity.Recipient()))
+	assert.NotContains(t, buf.String(), "s3cr3t")
+
+	encrypted := buf.Bytes()
+
+	_, err = ReadBackup(bytes.NewReader(encrypted))
+	require.ErrorIs(t, err, ErrBackupEncrypted)
+
+	other, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	_, err = ReadBackup(bytes.NewReader(encrypted), other)
+	require.Error(t, err)
+
+	got, err := ReadBackup(bytes.NewReader(encrypted), identity)
+	require.NoError(t, err)
+	assert.Equal(t, b.Namespaces, got.Namespaces)
+}
+
+func TestReadBackupVersion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "current version", input: `{"version": 1}`},
+		{name: "newer version", input: `{"version": 2}`, wantErr: ErrUnsupportedBackupVersion},
+		{name: "missing version", input: `{}`, wantErr: ErrUnsupportedBackupVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ReadBackup(strings.NewReader(tt.input))
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+// newBackupServer returns a server with a group, a subgroup and a project in each.
+func newBackupServer(t *testing.T) *glentest.Server {
+	t.Helper()
+
+	s := glentest.NewServer(t)
+	s.AddGroupVariables("group", glentest.Variable{Key: "ROOT", Value: "root", EnvironmentScope: "*"})
+	s.AddGroupVariables("group/sub", glentest.Variable{Key: "SUB", Value: "sub", EnvironmentScope: "*"})
+	s.AddProjectVariables("group/project", glentest.Variable{Key: "PROJECT", Value: "project", EnvironmentScope: "*"})
+	s.AddProjectVariables("group/sub/app", glentest.Variable{
+		Key: "SECRET", Value: "s3cr3t", Masked: true, Protected: true, EnvironmentScope: "production",
+	})
+
+	return s
+}
+
+func TestBackupInit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		recurse bool
+		fail    string
+		want    []Namespace
+		wantErr bool
+	}{
+		{
+			name: "root group only",
+			want: []Namespace{
+				{Kind: SourceGroup, Path: "group", Variables: []Variable{
+					{Key: "ROOT", Value: "root", EnvironmentScope: "*", Source: "group:group"},
+				}},
+			},
+		},
+		{
+			name:    "recurse",
+			recurse: true,
+			want: []Namespace{
+				{Kind: SourceGroup, Path: "group", Variables: []Variable{
+					{Key: "ROOT", Value: "root", EnvironmentScope: "*", Source: "group:group"},
+				}},
+				{Kind: SourceGroup, Path: "group/sub", Variables: []Variable{
+					{Key: "SUB", Value: "sub", EnvironmentScope: "*", Source: "group:group/sub"},
+				}},
+				{Kind: SourceProject, Path: "group/project", Variables: []Variable{
+					{Key: "PROJECT", Value: "project", EnvironmentScope: "*", Source: "project:group/project"},
+				}},
+				{Kind: SourceProject, Path: "group/sub/app", Variables: []Variable{
+					{
+						Key: "SECRET", Value: "s3cr3t", Masked: true, Protected: true, EnvironmentScope: "production",
+						Source: "project:group/sub/app",
+					},
+				}},
+			},
+		},
+		{
+			name:    "unreadable project",
+			recurse: true,
+			fail:    "/projects/group/sub/app/variables",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newBackupServer(t)
+			if tt.fail != "" {
+				s.Fail(tt.fail, http.StatusForbidden)
+			}
+
+			b := NewBackup("gitlab.example.com", "group")
+			b.APIURL = s.URL
+			b.SetAPIKey(s.Token)
+			b.Recurse = tt.recurse
+
+			err := b.Init()
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, b.Namespaces)
+			assert.False(t, b.CreatedAt.IsZero())
+		})
+	}
+}
@@ -0,0 +1,507 @@
+package glen
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// SourceCIConfig is the Variable.Source of variables declared in the pipeline
+// configuration. Job variables are recorded as "ci-config:<job name>".
+const SourceCIConfig = "ci-config"
+
+// DefaultCIConfigPath is the default location of the pipeline configuration,
+// relative to the repo root.
+const DefaultCIConfigPath = ".gitlab-ci.yml"
+
+// GitLab limits the number of included files and the depth of 'extends'.
+// https://docs.gitlab.com/ee/ci/yaml/includes.html
+const (
+	maxIncludes     = 150
+	maxExtendsDepth = 11
+)
+
+var (
+	// ErrJobNotFound is returned when the requested job is not in the pipeline configuration.
+	ErrJobNotFound = errors.New("job not found in pipeline configuration")
+	// ErrTooManyIncludes is returned when the pipeline configuration includes too many files.
+	ErrTooManyIncludes = errors.New("too many included files")
+	// ErrExtendsCycle is returned when jobs extend each other in a cycle or too deeply.
+	ErrExtendsCycle = errors.New("circular or too deep 'extends'")
+)
+
+// isCIKeyword reports whether name is a top level keyword of a pipeline
+// configuration, rather than the name of a job.
+func isCIKeyword(name string) bool {
+	switch name {
+	case "default", "include", "stages", "variables", "workflow", "image", "services",
+		"cache", "before_script", "after_script", "types", "spec":
+		return true
+	default:
+		return false
+	}
+}
+
+// CIConfig holds the variables declared in a pipeline configuration, merged
+// across all of its local includes.
+type CIConfig struct {
+	Variables map[string]Variable
+
+	jobs map[string]ciJob
+}
+
+// ciJob is the part of a job definition that affects its variables.
+type ciJob struct {
+	Variables map[string]ciVariable `yaml:"variables"`
+	Extends   stringList            `yaml:"extends"`
+}
+
+// ciVariable is a variable in a 'variables:' block, either in the short 'KEY: value'
+// form or the long form with 'value', 'description', 'options' and 'expand'. The
+// value of the long form is the default of any 'options'.
+type ciVariable struct {
+	Value       string `yaml:"value"`
+	Description string `yaml:"description"`
+	Expand      *bool  `yaml:"expand"`
+}
+
+// UnmarshalYAML accepts both the short and the long form of a variable.
+func (c *ciVariable) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		c.Value = node.Value
+
+		return nil
+	}
+
+	type plain ciVariable
+
+	err := node.Decode((*plain)(c))
+	if err != nil {
+		return fmt.Errorf("invalid variable on line %d: %w", node.Line, err)
+	}
+
+	return nil
+}
+
+// stringList is a YAML value that may be a single string or a list of strings.
+type stringList []string
+
+// UnmarshalYAML accepts a single string or a list of strings.
+func (s *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*s = []string{node.Value}
+
+		return nil
+	}
+
+	var list []string
+
+	err := node.Decode(&list)
+	if err != nil {
+		return fmt.Errorf("expected a string or a list of strings on line %d: %w", node.Line, err)
+	}
+	*s = list
+
+	return nil
+}
+
+// ciInclude is a single entry of an 'include:' block. Only local includes can be
+// resolved without the API, the others are ignored.
+type ciInclude struct {
+	Local string `yaml:"local"`
+}
+
+// ciIncludes is the 'include:' block, which may be a single entry or a list.
+type ciIncludes []ciInclude
+
+// UnmarshalYAML accepts every form of 'include:', keeping only local includes.
+func (c *ciIncludes) UnmarshalYAML(node *yaml.Node) error {
+	nodes := []*yaml.Node{node}
+	if node.Kind == yaml.SequenceNode {
+		nodes = node.Content
+	}
+
+	for _, n := range nodes {
+		switch n.Kind {
+		case yaml.ScalarNode:
+			// A bare string is a remote include if it is a URL, and local otherwise
+			if !strings.HasPrefix(n.Value, "http://") && !strings.HasPrefix(n.Value, "https://") {
+				*c = append(*c, ciInclude{Local: n.Value})
+			}
+		case yaml.MappingNode:
+			var inc ciInclude
+
+			err := n.Decode(&inc)
+			if err != nil {
+				return fmt.Errorf("invalid include on line %d: %w", n.Line, err)
+			}
+			if inc.Local != "" {
+				*c = append(*c, inc)
+			}
+		default:
+			return fmt.Errorf("invalid include on line %d", n.Line)
+		}
+	}
+
+	return nil
+}
+
+// ReadCIConfig reads the pipeline configuration at file, relative to the repo root,
+// along with every file it includes with 'include:local'. Variables from included
+// files are overridden by the files that include them, the same as GitLab merges
+// configuration.
+func (r *Repo) ReadCIConfig(file string) (*CIConfig, error) {
+	c := &CIConfig{
+		Variables: make(map[string]Variable),
+		jobs:      make(map[string]ciJob),
+	}
+
+	seen := make(map[string]bool)
+
+	err := c.readFile(r.LocalPath, file, seen)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// readFile merges a single configuration file, and the files it includes, into c.
+func (c *CIConfig) readFile(root string, file string, seen map[string]bool) error {
+	file = filepath.Clean("/" + file)
+	if seen[file] {
+		return nil
+	}
+	seen[file] = true
+
+	if len(seen) > maxIncludes {
+		return fmt.Errorf("%w: more than %d", ErrTooManyIncludes, maxIncludes)
+	}
+
+	doc, err := readCIDocument(filepath.Join(root, file))
+	if err != nil {
+		return err
+	}
+
+	// Included configuration is merged first so this file can override it
+	err = c.readIncludes(root, file, doc, seen)
+	if err != nil {
+		return err
+	}
+
+	return c.merge(file, doc)
+}
+
+// readIncludes merges the files that the document of file includes into c.
+func (c *CIConfig) readIncludes(root string, file string, doc map[string]yaml.Node, seen map[string]bool) error {
+	var includes ciIncludes
+	if node, ok := doc["include"]; ok {
+		err := node.Decode(&includes)
+		if err != nil {
+			return fmt.Errorf("failed to parse includes in %s: %w", file, err)
+		}
+	}
+
+	for _, inc := range includes {
+		matches, err := globInclude(root, inc.Local)
+		if err != nil {
+			return fmt.Errorf("invalid include %s in %s: %w", inc.Local, file, err)
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("included file %s in %s does not exist", inc.Local, file)
+		}
+
+		for _, match := range matches {
+			err = c.readFile(root, match, seen)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// globInclude returns the files under root, relative to it, that match the path
+// of a local include. Like GitLab, '*' matches within a directory and '**' also
+// matches across directories, so "ci/**.yml" matches every YAML file under ci.
+func globInclude(root string, pattern string) ([]string, error) {
+	pattern = strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+pattern)), "/")
+	if strings.Contains(pattern, "**") {
+		return walkInclude(root, pattern)
+	}
+
+	matches, err := filepath.Glob(filepath.Join(root, filepath.FromSlash(pattern)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to match files: %w", err)
+	}
+	for i, match := range matches {
+		matches[i], err = filepath.Rel(root, match)
+		if err != nil {
+			return nil, fmt.Errorf("failed to match files: %w", err)
+		}
+	}
+
+	return matches, nil
+}
+
+// walkInclude returns the files under root, relative to it, that match a pattern
+// with '**' wildcards. The .git directory is skipped.
+func walkInclude(root string, pattern string) ([]string, error) {
+	re, err := regexp.Compile(globRegexp(pattern))
+	if err != nil {
+		return nil, fmt.Errorf("failed to match files: %w", err)
+	}
+
+	var matches []string
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case d.IsDir() && d.Name() == ".git":
+			return filepath.SkipDir
+		case d.IsDir():
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return fmt.Errorf("failed to match files: %w", err)
+		}
+		if re.MatchString(filepath.ToSlash(rel)) {
+			matches = append(matches, rel)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to match files: %w", err)
+	}
+
+	return matches, nil
+}
+
+// globRegexp converts a glob with '**', '*' and '?' wildcards to a regular expression.
+func globRegexp(pattern string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			b.WriteString("[^/]*")
+		case pattern[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+
+	return b.String()
+}
+
+// merge merges the global variables and jobs of a parsed document into c.
+func (c *CIConfig) merge(file string, doc map[string]yaml.Node) error {
+	if node, ok := doc["variables"]; ok {
+		var vars map[string]ciVariable
+
+		err := node.Decode(&vars)
+		if err != nil {
+			return fmt.Errorf("failed to parse variables in %s: %w", file, err)
+		}
+		err = checkVariableNames(vars, file)
+		if err != nil {
+			return err
+		}
+		for key, cv := range vars {
+			c.Variables[key] = cv.variable(key, SourceCIConfig)
+		}
+	}
+
+	for name, node := range doc {
+		if isCIKeyword(name) || node.Kind != yaml.MappingNode {
+			continue
+		}
+
+		err := c.mergeJob(file, name, node)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeJob merges the job name, defined by node in file, into any job with the
+// same name from the files that file includes.
+func (c *CIConfig) mergeJob(file string, name string, node yaml.Node) error {
+	var job ciJob
+
+	err := node.Decode(&job)
+	if err != nil {
+		return fmt.Errorf("failed to parse job %s in %s: %w", name, file, err)
+	}
+	err = checkVariableNames(job.Variables, file)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+
+	existing, ok := c.jobs[name]
+	if !ok {
+		c.jobs[name] = job
+
+		return nil
+	}
+	if existing.Variables == nil {
+		existing.Variables = make(map[string]ciVariable)
+	}
+	for key, cv := range job.Variables {
+		existing.Variables[key] = cv
+	}
+	if job.Extends != nil {
+		existing.Extends = job.Extends
+	}
+	c.jobs[name] = existing
+
+	return nil
+}
+
+// checkVariableNames returns an error if any of vars, from file, has an invalid name.
+func checkVariableNames(vars map[string]ciVariable, file string) error {
+	for key := range vars {
+		if !ValidVariableName(key) {
+			return fmt.Errorf("%w: %q in %s", ErrInvalidVariableName, key, file)
+		}
+	}
+
+	return nil
+}
+
+// JobVariables returns the variables declared on a job, including those inherited
+// from the jobs it extends. It does not include the global variables.
+func (c *CIConfig) JobVariables(name string) (map[string]Variable, error) {
+	vars := make(map[string]Variable)
+
+	err := c.collectJobVariables(name, name, vars, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return vars, nil
+}
+
+// collectJobVariables adds the variables of a job, after those of the jobs it
+// extends, to vars.
+func (c *CIConfig) collectJobVariables(job string, name string, vars map[string]Variable, depth int) error {
+	if depth > maxExtendsDepth {
+		return fmt.Errorf("%w: %s", ErrExtendsCycle, job)
+	}
+
+	j, ok := c.jobs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+
+	for _, parent := range j.Extends {
+		err := c.collectJobVariables(job, parent, vars, depth+1)
+		if err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(j.Variables))
+	for key := range j.Variables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		vars[key] = j.Variables[key].variable(key, SourceCIConfig+":"+job)
+	}
+
+	return nil
+}
+
+// variable converts a variable from the pipeline configuration to a Variable.
+func (c ciVariable) variable(key string, source string) Variable {
+	return Variable{
+		Key:              key,
+		Value:            c.Value,
+		VariableType:     string(gitlab.EnvVariableType),
+		Raw:              c.Expand != nil && !*c.Expand,
+		EnvironmentScope: "*",
+		Description:      c.Description,
+		Source:           source,
+	}
+}
+
+// readCIDocument reads the configuration document of a pipeline file. Files with a
+// 'spec:' header have the configuration in their second document.
+func readCIDocument(file string) (map[string]yaml.Node, error) {
+	f, err := os.Open(file) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pipeline configuration: %w", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	dec := yaml.NewDecoder(f)
+
+	var doc map[string]yaml.Node
+	for {
+		var next map[string]yaml.Node
+
+		err = dec.Decode(&next)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pipeline configuration %s: %w", file, err)
+		}
+
+		_, isSpec := next["spec"]
+		if doc == nil || !isSpec {
+			doc = next
+		}
+	}
+
+	return doc, nil
+}
+
+// getCIConfigVariables adds the global variables of the pipeline configuration to
+// v.Env and, if Variables.Job is set, the variables of that job.
+func (v *Variables) getCIConfigVariables() error {
+	c, err := v.Repo.ReadCIConfig(v.CIConfigPath)
+	if err != nil {
+		return err
+	}
+
+	for _, variable := range c.Variables {
+		v.set(variable)
+	}
+
+	if v.Job == "" {
+		return nil
+	}
+
+	jobVars, err := c.JobVariables(v.Job)
+	if err != nil {
+		return err
+	}
+	for _, variable := range jobVars {
+		v.set(variable)
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package glen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFiles writes files, keyed by path relative to a new temp dir, and returns the dir.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o750))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	return dir
+}
+
+func TestReadCIConfig(t *testing.T) {
+	t.Parallel()
+
+	dir := writeFiles(t, map[string]string{
+		".gitlab-ci.yml": `
+include:
+  - local: /ci/base.yml
+  - remote: https://example.com/remote.yml
+  - template: Auto-DevOps.gitlab-ci.yml
+  - ci/jobs/*.yml
+
+variables:
+  GLOBAL: main
+  OVERRIDDEN: main
+  DEPLOY_ENV:
+    value: staging
+    description: Where to deploy
+    options: [staging, production]
+  LITERAL:
+    value: $NOT_EXPANDED
+    expand: false
+  NUMBER: 42
+
+stages: [build, deploy]
+
+.base:
+  variables:
+    BASE: base
+    SHARED: base
+
+build:
+  extends: .base
+  script: make
+  variables:
+    SHARED: build
+`,
+		"ci/base.yml": `
+variables:
+  FROM_INCLUDE: base
+  OVERRIDDEN: base
+`,
+		"ci/jobs/deploy.yml": `
+spec:
+  inputs:
+    env:
+      default: staging
+---
+deploy:
+  extends: [.base, build]
+  variables:
+    DEPLOY: "yes"
+`,
+	})
+
+	c, err := (&Repo{LocalPath: dir}).ReadCIConfig(DefaultCIConfigPath)
+	require.NoError(t, err)
+
+	values := make(map[string]string)
+	for k, v := range c.Variables {
+		values[k] = v.Value
+	}
+	assert.Equal(t, map[string]string{
+		"GLOBAL":       "main",
+		"OVERRIDDEN":   "main",
+		"DEPLOY_ENV":   "staging",
+		"LITERAL":      "$NOT_EXPANDED",
+		"NUMBER":       "42",
+		"FROM_INCLUDE": "base",
+	}, values)
+	assert.Equal(t, "Where to deploy", c.Variables["DEPLOY_ENV"].Description)
+	assert.True(t, c.Variables["LITERAL"].Raw)
+	assert.False(t, c.Variables["GLOBAL"].Raw)
+	assert.Equal(t, SourceCIConfig, c.Variables["GLOBAL"].Source)
+
+	build, err := c.JobVariables("build")
+	require.NoError(t, err)
+	assert.Equal(t, "base", build["BASE"].Value)
+	assert.Equal(t, "build", build["SHARED"].Value)
+	assert.Equal(t, SourceCIConfig+":build", build["SHARED"].Source)
+
+	deploy, err := c.JobVariables("deploy")
+	require.NoError(t, err)
+	assert.Equal(t, "build", deploy["SHARED"].Value)
+	assert.Equal(t, "yes", deploy["DEPLOY"].Value)
+
+	_, err = c.JobVariables("missing")
+	require.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestReadCIConfigIncludeGlobs(t *testing.T) {
+	t.Parallel()
+
+	files := map[string]string{
+		"ci/top.yml":        "variables:\n  TOP: top\n",
+		"ci/sub/nested.yml": "variables:\n  NESTED: nested\n",
+		"ci/sub/other.txt":  "variables:\n  OTHER: other\n",
+	}
+
+	tests := []struct {
+		include string
+		want    []string
+	}{
+		{include: "ci/*.yml", want: []string{"TOP"}},
+		{include: "ci/**.yml", want: []string{"NESTED", "TOP"}},
+		{include: "ci/**/*.yml", want: []string{"NESTED"}},
+		{include: "/ci/sub/*", want: []string{"NESTED", "OTHER"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.include, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeFiles(t, files)
+			require.NoError(t, os.WriteFile(filepath.Join(dir, DefaultCIConfigPath), []byte("include: "+tt.include+"\n"), 0o600))
+
+			c, err := (&Repo{LocalPath: dir}).ReadCIConfig(DefaultCIConfigPath)
+			require.NoError(t, err)
+
+			keys := make([]string, 0, len(c.Variables))
+			for key := range c.Variables {
+				keys = append(keys, key)
+			}
+			assert.ElementsMatch(t, tt.want, keys)
+		})
+	}
+}
+
+func TestReadCIConfigErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		files       map[string]string
+		job         string
+		wantErr     error
+		errContains string
+	}{
+		{
+			name:        "missing file",
+			files:       map[string]string{},
+			errContains: "failed to open pipeline configuration",
+		},
+		{
+			name:        "missing include",
+			files:       map[string]string{".gitlab-ci.yml": "include: missing.yml\n"},
+			errContains: "does not exist",
+		},
+		{
+			name: "include cycle is read once",
+			files: map[string]string{
+				".gitlab-ci.yml": "include: a.yml\nvariables:\n  A: main\n",
+				"a.yml":          "include: .gitlab-ci.yml\nvariables:\n  A: a\n",
+			},
+		},
+		{
+			name:    "invalid global variable name",
+			files:   map[string]string{".gitlab-ci.yml": "variables:\n  \"A; id\": x\n"},
+			wantErr: ErrInvalidVariableName,
+		},
+		{
+			name:    "invalid job variable name",
+			files:   map[string]string{".gitlab-ci.yml": "build:\n  variables:\n    1ABC: x\n"},
+			wantErr: ErrInvalidVariableName,
+		},
+		{
+			name: "extends cycle",
+			files: map[string]string{
+				".gitlab-ci.yml": "a:\n  extends: b\nb:\n  extends: a\n",
+			},
+			job:     "a",
+			wantErr: ErrExtendsCycle,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := writeFiles(t, tt.files)
+
+			c, err := (&Repo{LocalPath: dir}).ReadCIConfig(DefaultCIConfigPath)
+			if err == nil && tt.job != "" {
+				_, err = c.JobVariables(tt.job)
+			}
+
+			switch {
+			case tt.wantErr != nil:
+				require.ErrorIs(t, err, tt.wantErr)
+			case tt.errContains != "":
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errContains)
+			default:
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package glen
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ChangeKind is how a variable changed between two sets of variables.
+type ChangeKind string
+
+// Kinds of changes.
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeRemoved ChangeKind = "removed"
+	ChangeUpdated ChangeKind = "updated"
+)
+
+// Change is a variable that was added, removed or whose value was updated. Old is
+// empty for added variables and New is empty for removed ones.
+type Change struct {
+	Key  string
+	Kind ChangeKind
+	Old  Variable
+	New  Variable
+}
+
+// String describes the change without the values of the variable, showing the
+// fingerprints of updated values instead.
+func (c Change) String() string {
+	switch c.Kind {
+	case ChangeAdded:
+		return "+ " + c.Key
+	case ChangeRemoved:
+		return "- " + c.Key
+	default:
+		return fmt.Sprintf("~ %s (%s -> %s)", c.Key, c.Old.Fingerprint(), c.New.Fingerprint())
+	}
+}
+
+// DiffVariables returns the changes from before to after, two sets of variables
+// keyed by name, sorted by key. Only values are compared, so a variable that moved
+// to another group with the same value is unchanged.
+func DiffVariables(before map[string]Variable, after map[string]Variable) []Change {
+	var changes []Change
+	for key, o := range before {
+		n, ok := after[key]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Key: key, Kind: ChangeRemoved, Old: o})
+		case n.Value != o.Value:
+			changes = append(changes, Change{Key: key, Kind: ChangeUpdated, Old: o, New: n})
+		}
+	}
+	for key, n := range after {
+		if _, ok := before[key]; !ok {
+			changes = append(changes, Change{Key: key, Kind: ChangeAdded, New: n})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes
+}
@@ -0,0 +1,43 @@
+package glen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffVariables(t *testing.T) {
+	t.Parallel()
+
+	before := map[string]Variable{
+		"KEPT":    {Key: "KEPT", Value: "kept", Source: "group:group"},
+		"UPDATED": {Key: "UPDATED", Value: "old", Masked: true},
+		"REMOVED": {Key: "REMOVED", Value: "removed"},
+	}
+	after := map[string]Variable{
+		"KEPT":    {Key: "KEPT", Value: "kept", Source: "project:group/project"},
+		"UPDATED": {Key: "UPDATED", Value: "new", Masked: true},
+		"ADDED":   {Key: "ADDED", Value: "added"},
+	}
+
+	changes := DiffVariables(before, after)
+
+	var descriptions []string
+	for _, c := range changes {
+		descriptions = append(descriptions, c.String())
+	}
+	assert.Equal(t, []string{
+		"+ ADDED",
+		"- REMOVED",
+		"~ UPDATED (" + before["UPDATED"].Fingerprint() + " -> " + after["UPDATED"].Fingerprint() + ")",
+	}, descriptions)
+	assert.Equal(t, []ChangeKind{ChangeAdded, ChangeRemoved, ChangeUpdated}, []ChangeKind{changes[0].Kind, changes[1].Kind, changes[2].Kind})
+
+	for _, d := range descriptions {
+		assert.NotContains(t, d, "old")
+		assert.NotContains(t, d, "new")
+	}
+
+	assert.Empty(t, DiffVariables(before, before))
+	assert.Empty(t, DiffVariables(nil, nil))
+}
@@ -18,5 +18,35 @@ However, you can set a custom API key and you can set Variables.Recurse=true to
 group variables of the project's parent groups. Variables are merged according to the GitLab
 specified precedence here:
 https://docs.gitlab.com/ee/ci/variables/#priority-of-environment-variables
+
+# Pipelines
+
+Set Variables.PipelineID or Variables.JobID to reproduce the variables of a pipeline or job that
+ran in GitLab. Variables simulates the ref of the pipeline and the environment of the job, and adds
+the variables that the pipeline was created with by a trigger, a schedule or by hand.
+
+# Sources
+
+Variables reads instance, group and project variables from a VariableSource, which by default calls
+the GitLab API. Set Variables.HTTPClient to call the API with your own client, for example one with a
+custom transport, or Variables.Source to read variables from anywhere else. NewGitLabSource wraps a
+GitLab API client that you have configured yourself.
+
+# Sinks
+
+A Sink writes variables into another secret store. MapSecrets turns variables into secrets with
+paths built from MapRule templates, which KDBXSink writes to a KeePass database, PassSink to a pass
+password store and VaultSink to the KV v2 engine of HashiCorp Vault.
+
+# Snapshots
+
+A Snapshot holds the variables of one or more projects to hand to someone that cannot reach GitLab.
+Snapshot.WriteAge writes it encrypted with age and Snapshot.WriteSOPS writes a SOPS file in YAML or
+dotenv format, and ReadSnapshot decrypts either.
+
+# Templates
+
+ParseTemplate parses a text/template output template from a file, or one of the BuiltinTemplates,
+with the helpers in TemplateFuncs. Templates are executed with TemplateData.
 */
 package glen
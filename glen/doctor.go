@@ -0,0 +1,234 @@
+package glen
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go/v2"
+	"golang.org/x/oauth2"
+)
+
+// Check is the result of one check run by Doctor.
+type Check struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+// Doctor diagnoses why variables cannot be read from a repo. It checks that the
+// GitLab API can be reached, that the token is valid, unexpired and has a scope
+// that can read the API, and that its user has the Maintainer role that reading
+// variables needs on the project and each of its groups.
+type Doctor struct {
+	Repo *Repo
+	// APIURL overrides the GitLab API URL, which defaults to https://<Repo.BaseURL>/api/v4.
+	APIURL string
+	// TokenSource authenticates with OAuth access tokens instead of the API key when set.
+	TokenSource oauth2.TokenSource
+	// HTTPClient is used to call the API instead of http.DefaultClient if it is set.
+	HTTPClient *http.Client
+
+	// Checks are the results of every check, in the order they ran.
+	Checks []Check
+
+	apiKey string
+	now    func() time.Time
+}
+
+// NewDoctor takes an initialized *Repo and returns a Doctor for it. Like
+// NewVariables, this assumes you have a GitLab API key set as GITLAB_TOKEN.
+func NewDoctor(r *Repo) *Doctor {
+	d := &Doctor{}
+
+	d.Repo = r
+	d.apiKey = os.Getenv("GITLAB_TOKEN")
+	d.now = time.Now
+
+	return d
+}
+
+// SetAPIKey takes a GitLab API key and adds it to the Doctor struct.
+func (d *Doctor) SetAPIKey(key string) {
+	d.apiKey = key
+}
+
+// OK reports whether every check passed.
+func (d *Doctor) OK() bool {
+	for _, c := range d.Checks {
+		if !c.OK {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Init runs every check and records the results in Doctor.Checks. Checks that
+// depend on a failed check are skipped. An error is only returned when the checks
+// cannot run at all.
+func (d *Doctor) Init() error {
+	glc, err := newClient(clientConfig{
+		baseURL: d.Repo.BaseURL, apiURL: d.APIURL, apiKey: d.apiKey, tokenSource: d.TokenSource,
+		httpClient: d.HTTPClient,
+	})
+	if err != nil {
+		return err
+	}
+
+	if !d.checkAPI(glc) {
+		return nil
+	}
+
+	user, ok := d.checkUser(glc)
+	if !ok {
+		return nil
+	}
+
+	d.checkToken(glc)
+
+	// Groups are ordered from the immediate parent to the root group
+	for _, group := range slices.Backward(d.Repo.Groups) {
+		d.checkRole("Group "+group, user, func() (gitlab.AccessLevelValue, *gitlab.Response, error) {
+			member, resp, err := glc.GroupMembers.GetInheritedGroupMember(group, user.ID)
+			if err != nil {
+				return 0, resp, err //nolint:wrapcheck
+			}
+
+			return member.AccessLevel, resp, nil
+		})
+	}
+	d.checkRole("Project "+d.Repo.Path, user, func() (gitlab.AccessLevelValue, *gitlab.Response, error) {
+		member, resp, err := glc.ProjectMembers.GetInheritedProjectMember(d.Repo.Path, user.ID)
+		if err != nil {
+			return 0, resp, err //nolint:wrapcheck
+		}
+
+		return member.AccessLevel, resp, nil
+	})
+
+	return nil
+}
+
+// add records the result of a check.
+func (d *Doctor) add(name string, ok bool, format string, args ...any) {
+	d.Checks = append(d.Checks, Check{Name: name, OK: ok, Detail: fmt.Sprintf(format, args...)})
+}
+
+// checkAPI checks that the API can be reached and records the GitLab version.
+// GitLab only returns its version to authenticated users, so any response passes.
+func (d *Doctor) checkAPI(glc *gitlab.Client) bool {
+	apiURL := glc.BaseURL().String()
+
+	version, resp, err := glc.Version.GetVersion()
+	switch {
+	case err == nil:
+		d.add("API", true, "GitLab %s at %s", version.Version, apiURL)
+	case resp != nil:
+		d.add("API", true, "reachable at %s, the version needs a valid token", apiURL)
+	default:
+		d.add("API", false, "cannot reach %s: %s", apiURL, err)
+
+		return false
+	}
+
+	return true
+}
+
+// checkUser checks that the token is accepted and records who it belongs to.
+func (d *Doctor) checkUser(glc *gitlab.Client) (*gitlab.User, bool) {
+	user, _, err := glc.Users.CurrentUser()
+	if err != nil {
+		d.add("Token", false, "rejected by GitLab: %s", err)
+
+		return nil, false
+	}
+
+	owner := "@" + user.Username
+	if user.IsAdmin {
+		owner += ", an administrator"
+	}
+	d.add("Token", true, "belongs to %s", owner)
+
+	return user, true
+}
+
+// checkToken checks the scopes and expiry of a personal access token. Other
+// tokens, such as OAuth tokens, cannot describe themselves and are not checked.
+func (d *Doctor) checkToken(glc *gitlab.Client) {
+	token, resp, err := glc.PersonalAccessTokens.GetSinglePersonalAccessToken()
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusNotFound) {
+			d.add("Token scopes", true, "not a personal access token, scopes cannot be checked")
+		} else {
+			d.add("Token scopes", false, "failed to get the token: %s", err)
+		}
+
+		return
+	}
+
+	scopes := strings.Join(token.Scopes, ", ")
+	if slices.Contains(token.Scopes, "api") || slices.Contains(token.Scopes, "read_api") {
+		d.add("Token scopes", true, "%s", scopes)
+	} else {
+		d.add("Token scopes", false, "%s, needs api or read_api", scopes)
+	}
+
+	switch {
+	case token.Revoked || !token.Active:
+		d.add("Token expiry", false, "%s is revoked or inactive", token.Name)
+	case token.ExpiresAt == nil:
+		d.add("Token expiry", true, "%s never expires", token.Name)
+	case time.Time(*token.ExpiresAt).Before(d.now()):
+		d.add("Token expiry", false, "%s expired on %s", token.Name, token.ExpiresAt)
+	default:
+		d.add("Token expiry", true, "%s expires on %s", token.Name, token.ExpiresAt)
+	}
+}
+
+// checkRole checks that the user has at least the Maintainer role, which reading
+// variables needs, in a group or project. Administrators can read every variable.
+func (d *Doctor) checkRole(
+	name string, user *gitlab.User, member func() (gitlab.AccessLevelValue, *gitlab.Response, error),
+) {
+	if user.IsAdmin {
+		d.add(name, true, "administrator")
+
+		return
+	}
+
+	level, resp, err := member()
+	switch {
+	case resp != nil && resp.StatusCode == http.StatusNotFound:
+		d.add(name, false, "@%s is not a member, needs Maintainer", user.Username)
+	case err != nil:
+		d.add(name, false, "failed to get the role of @%s: %s", user.Username, err)
+	case level < gitlab.MaintainerPermissions:
+		d.add(name, false, "@%s is %s, needs Maintainer", user.Username, accessLevelName(level))
+	default:
+		d.add(name, true, "@%s is %s", user.Username, accessLevelName(level))
+	}
+}
+
+// accessLevelName returns the name of the role with an access level.
+func accessLevelName(level gitlab.AccessLevelValue) string {
+	switch level {
+	case gitlab.GuestPermissions:
+		return "Guest"
+	case gitlab.PlannerPermissions:
+		return "Planner"
+	case gitlab.ReporterPermissions:
+		return "Reporter"
+	case gitlab.DeveloperPermissions:
+		return "Developer"
+	case gitlab.MaintainerPermissions:
+		return "Maintainer"
+	case gitlab.OwnerPermissions:
+		return "Owner"
+	default:
+		return fmt.Sprintf("access level %d", level)
+	}
+}
@@ -0,0 +1,129 @@
+package glen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lingrino/glen/glentest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoctorInit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		configure func(s *glentest.Server)
+		want      []Check
+	}{
+		{
+			name: "healthy",
+			configure: func(s *glentest.Server) {
+				s.PersonalAccessToken.ExpiresAt = "2030-01-31"
+				s.SetGroupAccess("group", glentest.MaintainerAccess)
+			},
+			want: []Check{
+				{Name: "API", OK: true},
+				{Name: "Token", OK: true, Detail: "belongs to @glentest"},
+				{Name: "Token scopes", OK: true, Detail: "api"},
+				{Name: "Token expiry", OK: true, Detail: "glentest expires on 2030-01-31"},
+				{Name: "Group group", OK: true, Detail: "@glentest is Maintainer"},
+				{Name: "Group group/sub", OK: true, Detail: "@glentest is Maintainer"},
+				{Name: "Project group/sub/project", OK: true, Detail: "@glentest is Maintainer"},
+			},
+		},
+		{
+			name: "missing role",
+			configure: func(s *glentest.Server) {
+				s.SetGroupAccess("group/sub", glentest.DeveloperAccess)
+				s.SetProjectAccess("group/sub/project", glentest.OwnerAccess)
+			},
+			want: []Check{
+				{Name: "API", OK: true},
+				{Name: "Token", OK: true, Detail: "belongs to @glentest"},
+				{Name: "Token scopes", OK: true, Detail: "api"},
+				{Name: "Token expiry", OK: true, Detail: "glentest never expires"},
+				{Name: "Group group", OK: false, Detail: "@glentest is not a member, needs Maintainer"},
+				{Name: "Group group/sub", OK: false, Detail: "@glentest is Developer, needs Maintainer"},
+				{Name: "Project group/sub/project", OK: true, Detail: "@glentest is Owner"},
+			},
+		},
+		{
+			name: "bad token",
+			configure: func(s *glentest.Server) {
+				s.PersonalAccessToken.Scopes = []string{"read_user"}
+				s.PersonalAccessToken.ExpiresAt = "2020-01-31"
+				s.User.IsAdmin = true
+			},
+			want: []Check{
+				{Name: "API", OK: true},
+				{Name: "Token", OK: true, Detail: "belongs to @glentest, an administrator"},
+				{Name: "Token scopes", OK: false, Detail: "read_user, needs api or read_api"},
+				{Name: "Token expiry", OK: false, Detail: "glentest expired on 2020-01-31"},
+				{Name: "Group group", OK: true, Detail: "administrator"},
+				{Name: "Group group/sub", OK: true, Detail: "administrator"},
+				{Name: "Project group/sub/project", OK: true, Detail: "administrator"},
+			},
+		},
+		{
+			name: "not a personal access token",
+			configure: func(s *glentest.Server) {
+				s.PersonalAccessToken = nil
+				s.SetProjectAccess("group/sub/project", glentest.MaintainerAccess)
+				s.SetGroupAccess("group", glentest.OwnerAccess)
+			},
+			want: []Check{
+				{Name: "API", OK: true},
+				{Name: "Token", OK: true, Detail: "belongs to @glentest"},
+				{Name: "Token scopes", OK: true, Detail: "not a personal access token, scopes cannot be checked"},
+				{Name: "Group group", OK: true, Detail: "@glentest is Owner"},
+				{Name: "Group group/sub", OK: true, Detail: "@glentest is Owner"},
+				{Name: "Project group/sub/project", OK: true, Detail: "@glentest is Owner"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := glentest.NewServer(t)
+			tt.configure(s)
+
+			v := newTestVariables(t, s)
+			d := NewDoctor(v.Repo)
+			d.APIURL = s.URL
+			d.SetAPIKey(s.Token)
+			d.now = func() time.Time { return time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC) }
+
+			require.NoError(t, d.Init())
+
+			// The API check includes the URL of the test server
+			require.NotEmpty(t, d.Checks)
+			assert.Equal(t, "GitLab 17.0.0 at "+s.URL+"/", d.Checks[0].Detail)
+			d.Checks[0].Detail = ""
+
+			assert.Equal(t, tt.want, d.Checks)
+			assert.Equal(t, (&Doctor{Checks: tt.want}).OK(), d.OK())
+		})
+	}
+}
+
+func TestDoctorInitUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	s := glentest.NewServer(t)
+
+	v := newTestVariables(t, s)
+	d := NewDoctor(v.Repo)
+	d.APIURL = s.URL
+	d.SetAPIKey("wrong-token")
+
+	require.NoError(t, d.Init())
+	require.Len(t, d.Checks, 2)
+	assert.Equal(t, Check{Name: "API", OK: true, Detail: "reachable at " + s.URL + "/, the version needs a valid token"}, d.Checks[0])
+	assert.Equal(t, "Token", d.Checks[1].Name)
+	assert.False(t, d.Checks[1].OK)
+	assert.False(t, d.OK())
+}
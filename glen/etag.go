@@ -0,0 +1,101 @@
+package glen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// ETagTransport is an http.RoundTripper that remembers GET responses that carry an
+// ETag and revalidates them with If-None-Match. When GitLab answers 304 Not
+// Modified, the remembered response is returned instead, so that polling variables
+// that have not changed costs GitLab little. Set it as the transport of the
+// HTTPClient of Variables and reuse it between calls to Init. The zero value is
+// ready to use.
+type ETagTransport struct {
+	// Base makes the requests. Defaults to http.DefaultTransport.
+	Base http.RoundTripper
+
+	mu        sync.Mutex
+	responses map[string]etagResponse
+}
+
+// etagResponse is a remembered response and the ETag it was sent with.
+type etagResponse struct {
+	etag   string
+	status int
+	header http.Header
+	body   []byte
+}
+
+// RoundTrip makes the request, revalidating a remembered response to the same URL.
+func (t *ETagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Method != http.MethodGet {
+		return base.RoundTrip(req) //nolint:wrapcheck
+	}
+
+	key := req.URL.String()
+
+	t.mu.Lock()
+	cached, ok := t.responses[key]
+	t.mu.Unlock()
+
+	if ok {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if ok && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close() //nolint:errcheck,gosec
+
+		return cached.response(req), nil
+	}
+
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close() //nolint:errcheck,gosec
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	t.mu.Lock()
+	if t.responses == nil {
+		t.responses = make(map[string]etagResponse)
+	}
+	t.responses[key] = etagResponse{etag: etag, status: resp.StatusCode, header: resp.Header.Clone(), body: body}
+	t.mu.Unlock()
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	return resp, nil
+}
+
+// response returns a copy of the remembered response, as the response to req.
+func (r etagResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.status, http.StatusText(r.status)),
+		StatusCode:    r.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        r.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(r.body)),
+		ContentLength: int64(len(r.body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,99 @@
+package glen
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/lingrino/glen/glentest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// statusTransport records the status of every response made through it.
+type statusTransport struct {
+	mu       sync.Mutex
+	statuses []int
+}
+
+func (t *statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	t.mu.Lock()
+	t.statuses = append(t.statuses, resp.StatusCode)
+	t.mu.Unlock()
+
+	return resp, nil
+}
+
+// take returns the recorded statuses and forgets them.
+func (t *statusTransport) take() []int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	statuses := t.statuses
+	t.statuses = nil
+
+	return statuses
+}
+
+func TestETagTransport(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	statuses := &statusTransport{}
+	client := &http.Client{Transport: &ETagTransport{Base: statuses}}
+
+	poll := func() map[string]string {
+		t.Helper()
+
+		v := newTestVariables(t, s)
+		v.Recurse = true
+		v.HTTPClient = client
+		require.NoError(t, v.Init())
+
+		return v.Env
+	}
+
+	first := poll()
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusOK}, statuses.take())
+
+	assert.Equal(t, first, poll())
+	assert.Equal(t, []int{http.StatusNotModified, http.StatusNotModified, http.StatusNotModified}, statuses.take())
+
+	s.AddGroupVariables("group/sub", glentest.Variable{Key: "ADDED", Value: "added", EnvironmentScope: "*"})
+	assert.Equal(t, "added", poll()["ADDED"])
+	assert.Equal(t, []int{http.StatusNotModified, http.StatusOK, http.StatusNotModified}, statuses.take())
+}
+
+func TestETagTransportUncached(t *testing.T) {
+	t.Parallel()
+
+	var ifNoneMatch []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+		switch r.URL.Path {
+		case "/forbidden":
+			w.Header().Set("ETag", `"forbidden"`)
+			w.WriteHeader(http.StatusForbidden)
+		case "/untagged":
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	transport := &ETagTransport{}
+	for _, path := range []string{"/forbidden", "/forbidden", "/untagged", "/untagged"} {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		resp, err := transport.RoundTrip(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	assert.Equal(t, []string{"", "", "", ""}, ifNoneMatch)
+}
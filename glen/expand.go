@@ -0,0 +1,150 @@
+package glen
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrExpansionCycle is returned when variables reference each other in a cycle.
+var ErrExpansionCycle = errors.New("circular variable reference detected")
+
+// referenceRegexp matches '$$' escapes and '$VAR' or '${VAR}' references, the same
+// syntax GitLab supports in variable values.
+var referenceRegexp = regexp.MustCompile(`\$\$|\$([a-zA-Z_][a-zA-Z0-9_]*)|\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// LookupFunc resolves a variable that is referenced but not defined in the set
+// being expanded. os.LookupEnv is a valid LookupFunc.
+type LookupFunc func(key string) (string, bool)
+
+// Expand expands '$VAR' and '${VAR}' references inside the values of v.Env, the
+// same way GitLab does before passing variables to a job. Variables marked Raw are
+// left untouched. References to keys that are not in v.Env are resolved with each
+// of the lookups in order, and references that cannot be resolved are left as they
+// are and recorded in v.Unresolved. A '$$' escape expands to a literal '$'.
+// Variables whose values include a masked or hidden value are marked masked, so
+// that output redacts them like GitLab masks them in job logs.
+func (v *Variables) Expand(lookups ...LookupFunc) error {
+	e := &expander{
+		vars:       v.Vars,
+		env:        v.Env,
+		lookups:    lookups,
+		expanded:   make(map[string]string),
+		visiting:   make(map[string]bool),
+		unresolved: make(map[string]bool),
+		sensitive:  make(map[string]bool),
+	}
+
+	keys := make([]string, 0, len(v.Env))
+	for k := range v.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		_, err := e.expand(k, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	for k, value := range e.expanded {
+		v.Env[k] = value
+		if variable, ok := v.Vars[k]; ok {
+			variable.Value = value
+			variable.Masked = variable.Masked || e.sensitive[k]
+			v.Vars[k] = variable
+		}
+	}
+
+	v.Unresolved = make([]string, 0, len(e.unresolved))
+	for k := range e.unresolved {
+		v.Unresolved = append(v.Unresolved, k)
+	}
+	sort.Strings(v.Unresolved)
+
+	return nil
+}
+
+// expander holds the state of a single expansion pass.
+type expander struct {
+	vars       map[string]Variable
+	env        map[string]string
+	lookups    []LookupFunc
+	expanded   map[string]string
+	visiting   map[string]bool
+	unresolved map[string]bool
+	sensitive  map[string]bool // sensitive are the keys that include a sensitive value
+}
+
+// expand returns the fully expanded value of key, expanding any variables it
+// references first. path is the chain of keys that led here, used to report cycles.
+func (e *expander) expand(key string, path []string) (string, error) {
+	if value, ok := e.expanded[key]; ok {
+		return value, nil
+	}
+
+	value := e.env[key]
+	if e.vars[key].Raw {
+		e.expanded[key] = value
+
+		return value, nil
+	}
+
+	if e.visiting[key] {
+		return "", fmt.Errorf("%w: %s", ErrExpansionCycle, strings.Join(append(path, key), " -> "))
+	}
+	e.visiting[key] = true
+	defer delete(e.visiting, key)
+
+	var err error
+	result := referenceRegexp.ReplaceAllStringFunc(value, func(match string) string {
+		if err != nil {
+			return match
+		}
+		if match == "$$" {
+			return "$"
+		}
+
+		var resolved string
+		resolved, err = e.resolve(key, match, path)
+
+		return resolved
+	})
+	if err != nil {
+		return "", err
+	}
+
+	e.expanded[key] = result
+
+	return result, nil
+}
+
+// resolve returns what the reference match in the value of key expands to, or
+// match itself if it cannot be resolved.
+func (e *expander) resolve(key string, match string, path []string) (string, error) {
+	ref := strings.Trim(match, "${}")
+
+	// A variable referencing itself, like PATH="$PATH:/bin", refers to the
+	// value from the environment rather than to itself.
+	if _, ok := e.env[ref]; ok && ref != key {
+		expanded, err := e.expand(ref, append(path[:len(path):len(path)], key))
+		if e.vars[ref].Sensitive() || e.sensitive[ref] {
+			e.sensitive[key] = true
+		}
+
+		return expanded, err
+	}
+
+	for _, lookup := range e.lookups {
+		if resolved, ok := lookup(ref); ok {
+			return resolved, nil
+		}
+	}
+
+	e.unresolved[ref] = true
+
+	return match, nil
+}
@@ -0,0 +1,148 @@
+package glen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVariablesExpand(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		vars           []Variable
+		lookups        []LookupFunc
+		want           map[string]string
+		wantUnresolved []string
+		wantErr        error
+	}{
+		{
+			name: "no references",
+			vars: []Variable{{Key: "A", Value: "plain"}},
+			want: map[string]string{"A": "plain"},
+		},
+		{
+			name: "dollar and braced references",
+			vars: []Variable{
+				{Key: "DB_USER", Value: "admin"},
+				{Key: "DB_HOST", Value: "db.example.com"},
+				{Key: "DATABASE_URL", Value: "postgres://$DB_USER@${DB_HOST}/app"},
+			},
+			want: map[string]string{
+				"DB_USER":      "admin",
+				"DB_HOST":      "db.example.com",
+				"DATABASE_URL": "postgres://admin@db.example.com/app",
+			},
+		},
+		{
+			name: "nested references",
+			vars: []Variable{
+				{Key: "A", Value: "$B/a"},
+				{Key: "B", Value: "$C/b"},
+				{Key: "C", Value: "c"},
+			},
+			want: map[string]string{"A": "c/b/a", "B": "c/b", "C": "c"},
+		},
+		{
+			name: "raw variables are not expanded",
+			vars: []Variable{
+				{Key: "RAW", Value: "$B", Raw: true},
+				{Key: "B", Value: "b"},
+				{Key: "C", Value: "$RAW"},
+			},
+			want: map[string]string{"RAW": "$B", "B": "b", "C": "$B"},
+		},
+		{
+			name: "escaped dollar",
+			vars: []Variable{{Key: "A", Value: "cost: $$5"}},
+			want: map[string]string{"A": "cost: $5"},
+		},
+		{
+			name: "unresolved references are kept",
+			vars: []Variable{
+				{Key: "A", Value: "$MISSING-${ALSO_MISSING}"},
+				{Key: "B", Value: "$MISSING"},
+			},
+			want:           map[string]string{"A": "$MISSING-${ALSO_MISSING}", "B": "$MISSING"},
+			wantUnresolved: []string{"ALSO_MISSING", "MISSING"},
+		},
+		{
+			name: "lookups resolve in order",
+			vars: []Variable{{Key: "A", Value: "$CI_PROJECT_PATH:$HOME"}},
+			lookups: []LookupFunc{
+				func(k string) (string, bool) { return "group/project", k == "CI_PROJECT_PATH" },
+				func(k string) (string, bool) { return "/home/me", true },
+			},
+			want: map[string]string{"A": "group/project:/home/me"},
+		},
+		{
+			name: "self reference uses lookups",
+			vars: []Variable{{Key: "PATH", Value: "$PATH:/opt/bin"}},
+			lookups: []LookupFunc{
+				func(k string) (string, bool) { return "/usr/bin", k == "PATH" },
+			},
+			want: map[string]string{"PATH": "/usr/bin:/opt/bin"},
+		},
+		{
+			name: "cycle",
+			vars: []Variable{
+				{Key: "A", Value: "$B"},
+				{Key: "B", Value: "$C"},
+				{Key: "C", Value: "$A"},
+			},
+			wantErr: ErrExpansionCycle,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			v := NewVariables(NewRepo())
+			for _, variable := range tt.vars {
+				v.set(variable)
+			}
+
+			err := v.Expand(tt.lookups...)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, v.Env)
+			for k, value := range tt.want {
+				assert.Equal(t, value, v.Vars[k].Value)
+			}
+			if tt.wantUnresolved == nil {
+				assert.Empty(t, v.Unresolved)
+			} else {
+				assert.Equal(t, tt.wantUnresolved, v.Unresolved)
+			}
+		})
+	}
+}
+
+func TestVariablesExpandSensitive(t *testing.T) {
+	t.Parallel()
+
+	v := NewVariables(NewRepo())
+	v.set(Variable{Key: "DB_PASSWORD", Value: "secret", Masked: true})
+	v.set(Variable{Key: "DB_TOKEN", Value: "token", Hidden: true})
+	v.set(Variable{Key: "DB_HOST", Value: "db"})
+	v.set(Variable{Key: "DATABASE_URL", Value: "postgres://u:$DB_PASSWORD@$DB_HOST"})
+	v.set(Variable{Key: "DSN", Value: "$DATABASE_URL/app"})
+	v.set(Variable{Key: "AUTH", Value: "Bearer ${DB_TOKEN}"})
+	v.set(Variable{Key: "ESCAPED", Value: "$$DB_PASSWORD"})
+
+	require.NoError(t, v.Expand())
+	assert.Equal(t, "postgres://u:secret@db/app", v.Env["DSN"])
+	for key, want := range map[string]bool{
+		"DB_HOST": false, "DATABASE_URL": true, "DSN": true, "AUTH": true, "ESCAPED": false,
+	} {
+		assert.Equal(t, want, v.Vars[key].Sensitive(), key)
+	}
+}
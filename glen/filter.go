@@ -0,0 +1,93 @@
+package glen
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Filter removes every variable whose key does not match one of the Include globs
+// or IncludeRegex expressions, if there are any, or that matches one of the Exclude
+// globs or ExcludeRegex expressions. It then strips StripPrefix from every key that
+// has it and adds AddPrefix to every key. When a stripped key collides with an
+// existing key the stripped variable wins, and a key that is nothing but
+// StripPrefix is removed.
+//
+// Filter is meant to run after Init and Expand so that neither precedence nor
+// references between variables are affected.
+func (v *Variables) Filter() {
+	for key := range v.Vars {
+		if !v.keep(key) {
+			delete(v.Vars, key)
+			delete(v.Env, key)
+		}
+	}
+
+	if v.StripPrefix == "" && v.AddPrefix == "" {
+		return
+	}
+
+	renamed := make(map[string]Variable, len(v.Vars))
+	for key, variable := range v.Vars {
+		stripped := strings.TrimPrefix(key, v.StripPrefix)
+		if stripped == "" {
+			continue
+		}
+		if _, ok := renamed[v.AddPrefix+stripped]; ok && stripped == key {
+			continue
+		}
+
+		variable.Key = v.AddPrefix + stripped
+		renamed[variable.Key] = variable
+	}
+
+	v.Vars = renamed
+	v.Env = make(map[string]string, len(renamed))
+	for key, variable := range renamed {
+		v.Env[key] = variable.Value
+	}
+}
+
+// keep reports whether a key passes the include and exclude filters.
+func (v *Variables) keep(key string) bool {
+	if len(v.Include) > 0 || len(v.IncludeRegex) > 0 {
+		if !matchPatterns(key, v.Include) && !MatchRegex(key, v.IncludeRegex) {
+			return false
+		}
+	}
+
+	return !matchPatterns(key, v.Exclude) && !MatchRegex(key, v.ExcludeRegex)
+}
+
+// MatchKey reports whether key matches any of the glob patterns. An empty list
+// of patterns matches every key.
+func MatchKey(key string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		ok, err := path.Match(pattern, key)
+		if err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchRegex reports whether key matches any of the regular expressions.
+func MatchRegex(key string, expressions []*regexp.Regexp) bool {
+	for _, re := range expressions {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchPatterns is like MatchKey, except that an empty list matches nothing.
+func matchPatterns(key string, patterns []string) bool {
+	return len(patterns) > 0 && MatchKey(key, patterns)
+}
@@ -0,0 +1,147 @@
+package glen
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchKey(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		key      string
+		patterns []string
+		want     bool
+	}{
+		{name: "no patterns matches everything", key: "ANY", want: true},
+		{name: "exact match", key: "FOO", patterns: []string{"FOO"}, want: true},
+		{name: "glob match", key: "AWS_ACCESS_KEY_ID", patterns: []string{"AWS_*"}, want: true},
+		{name: "second pattern matches", key: "DB_HOST", patterns: []string{"AWS_*", "DB_*"}, want: true},
+		{name: "no match", key: "DEPLOY_TOKEN", patterns: []string{"AWS_*"}, want: false},
+		{name: "invalid pattern never matches", key: "FOO", patterns: []string{"["}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, MatchKey(tt.key, tt.patterns))
+		})
+	}
+}
+
+func TestVariablesFilter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		include      []string
+		exclude      []string
+		includeRegex []*regexp.Regexp
+		excludeRegex []*regexp.Regexp
+		stripPrefix  string
+		addPrefix    string
+		want         []string
+	}{
+		{name: "no filters", want: []string{"AWS_KEY", "AWS_SECRET", "DB_HOST", "DEPLOY_TOKEN"}},
+		{name: "include", include: []string{"AWS_*"}, want: []string{"AWS_KEY", "AWS_SECRET"}},
+		{name: "exclude", exclude: []string{"DEPLOY_*"}, want: []string{"AWS_KEY", "AWS_SECRET", "DB_HOST"}},
+		{
+			name:    "include and exclude",
+			include: []string{"AWS_*", "DB_*"},
+			exclude: []string{"*_SECRET"},
+			want:    []string{"AWS_KEY", "DB_HOST"},
+		},
+		{
+			name:         "include regex",
+			includeRegex: []*regexp.Regexp{regexp.MustCompile(`^(AWS|DB)_(KEY|HOST)$`)},
+			want:         []string{"AWS_KEY", "DB_HOST"},
+		},
+		{
+			name:         "glob or regex",
+			include:      []string{"DEPLOY_*"},
+			includeRegex: []*regexp.Regexp{regexp.MustCompile(`^DB_`)},
+			want:         []string{"DB_HOST", "DEPLOY_TOKEN"},
+		},
+		{
+			name:         "exclude regex",
+			excludeRegex: []*regexp.Regexp{regexp.MustCompile(`SECRET|TOKEN`)},
+			want:         []string{"AWS_KEY", "DB_HOST"},
+		},
+		{
+			name:        "strip prefix",
+			include:     []string{"AWS_*"},
+			stripPrefix: "AWS_",
+			want:        []string{"KEY", "SECRET"},
+		},
+		{
+			name:      "add prefix",
+			include:   []string{"DB_*"},
+			addPrefix: "APP_",
+			want:      []string{"APP_DB_HOST"},
+		},
+		{
+			name:        "strip and add prefix",
+			include:     []string{"AWS_*"},
+			stripPrefix: "AWS_",
+			addPrefix:   "TF_VAR_",
+			want:        []string{"TF_VAR_KEY", "TF_VAR_SECRET"},
+		},
+		{
+			name:        "strip entire key",
+			stripPrefix: "DB_HOST",
+			want:        []string{"AWS_KEY", "AWS_SECRET", "DEPLOY_TOKEN"},
+		},
+		{
+			name:        "strip entire key and add prefix",
+			stripPrefix: "DB_HOST",
+			addPrefix:   "APP_",
+			want:        []string{"APP_AWS_KEY", "APP_AWS_SECRET", "APP_DEPLOY_TOKEN"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			v := NewVariables(NewRepo())
+			for _, k := range []string{"AWS_KEY", "AWS_SECRET", "DB_HOST", "DEPLOY_TOKEN"} {
+				v.set(Variable{Key: k, Value: k})
+			}
+			v.Include = tt.include
+			v.Exclude = tt.exclude
+			v.IncludeRegex = tt.includeRegex
+			v.ExcludeRegex = tt.excludeRegex
+			v.StripPrefix = tt.stripPrefix
+			v.AddPrefix = tt.addPrefix
+
+			v.Filter()
+
+			keys := make([]string, 0, len(v.Env))
+			for k := range v.Env {
+				keys = append(keys, k)
+				assert.Equal(t, k, v.Vars[k].Key)
+			}
+			assert.ElementsMatch(t, tt.want, keys)
+			assert.Len(t, v.Vars, len(tt.want))
+		})
+	}
+}
+
+func TestVariablesFilterStripCollision(t *testing.T) {
+	t.Parallel()
+
+	v := NewVariables(NewRepo())
+	v.set(Variable{Key: "FOO", Value: "plain"})
+	v.set(Variable{Key: "APP_FOO", Value: "prefixed"})
+	v.set(Variable{Key: "BAR", Value: "bar"})
+	v.StripPrefix = "APP_"
+
+	v.Filter()
+
+	assert.Equal(t, map[string]string{"FOO": "prefixed", "BAR": "bar"}, v.Env)
+	assert.Equal(t, "prefixed", v.Vars["FOO"].Value)
+}
@@ -0,0 +1,125 @@
+package glen
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+)
+
+// Head describes the commit that is checked out in a local repo. Branch is empty
+// when HEAD is detached and Tag is empty when no tag points at the commit.
+type Head struct {
+	SHA       string
+	Branch    string
+	Tag       string
+	Title     string
+	Message   string
+	Author    string
+	Timestamp time.Time
+}
+
+// RefName returns the branch or tag name that the commit was checked out from,
+// falling back to the commit SHA when HEAD is detached and untagged.
+func (h *Head) RefName() string {
+	switch {
+	case h.Branch != "":
+		return h.Branch
+	case h.Tag != "":
+		return h.Tag
+	default:
+		return h.SHA
+	}
+}
+
+// Head reads the commit that is currently checked out in the repo at r.LocalPath.
+func (r *Repo) Head() (*Head, error) {
+	repo, err := git.PlainOpen(r.LocalPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open git repository (%s) with the following error: %w", r.LocalPath, err)
+	}
+
+	ref, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read HEAD of git repository (%s): %w", r.LocalPath, err)
+	}
+
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("unable to read commit %s: %w", ref.Hash(), err)
+	}
+
+	h := &Head{
+		SHA:       commit.Hash.String(),
+		Message:   commit.Message,
+		Title:     commitTitle(commit.Message),
+		Author:    fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email),
+		Timestamp: commit.Committer.When,
+	}
+
+	if ref.Name().IsBranch() {
+		h.Branch = ref.Name().Short()
+	}
+
+	h.Tag, err = tagForCommit(repo, commit.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// IsTag reports whether name is a tag of the local repo, and not also a branch.
+func (r *Repo) IsTag(name string) bool {
+	repo, err := git.PlainOpen(r.LocalPath)
+	if err != nil {
+		return false
+	}
+
+	_, err = repo.Reference(plumbing.NewBranchReferenceName(name), false)
+	if err == nil {
+		return false
+	}
+	_, err = repo.Reference(plumbing.NewTagReferenceName(name), false)
+
+	return err == nil
+}
+
+// tagForCommit returns the name of a tag pointing at hash, or an empty string if
+// there is none. Both lightweight and annotated tags are considered.
+func tagForCommit(repo *git.Repository, hash plumbing.Hash) (string, error) {
+	tags, err := repo.Tags()
+	if err != nil {
+		return "", fmt.Errorf("unable to list tags: %w", err)
+	}
+
+	var name string
+	err = tags.ForEach(func(t *plumbing.Reference) error {
+		target := t.Hash()
+		if tag, err := repo.TagObject(target); err == nil {
+			target = tag.Target
+		}
+		if target == hash {
+			name = t.Name().Short()
+
+			return storer.ErrStop
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to list tags: %w", err)
+	}
+
+	return name, nil
+}
+
+// commitTitle returns the first line of a commit message.
+func commitTitle(message string) string {
+	title, _, _ := strings.Cut(message, "\n")
+
+	return title
+}
@@ -0,0 +1,114 @@
+package glen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// initRepoWithCommit creates a git repo with a GitLab remote and a single commit on main.
+func initRepoWithCommit(t *testing.T, remoteURL string) (string, *git.Repository, plumbing.Hash) {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	repo, err := git.PlainInitWithOptions(tmpDir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")},
+	})
+	require.NoError(t, err)
+
+	_, err = repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{remoteURL}})
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(tmpDir, "README.md"), []byte("hello"), 0o600)
+	require.NoError(t, err)
+
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+	_, err = wt.Add("README.md")
+	require.NoError(t, err)
+
+	hash, err := wt.Commit("Add readme\n\nWith a longer description.", &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  "Jane Doe",
+			Email: "jane@example.com",
+			When:  time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC),
+		},
+	})
+	require.NoError(t, err)
+
+	return tmpDir, repo, hash
+}
+
+func TestRepoHead(t *testing.T) {
+	t.Parallel()
+
+	t.Run("branch", func(t *testing.T) {
+		t.Parallel()
+
+		dir, _, hash := initRepoWithCommit(t, "git@gitlab.com:group/project.git")
+
+		head, err := (&Repo{LocalPath: dir}).Head()
+		require.NoError(t, err)
+		assert.Equal(t, hash.String(), head.SHA)
+		assert.Equal(t, "main", head.Branch)
+		assert.Empty(t, head.Tag)
+		assert.Equal(t, "main", head.RefName())
+		assert.Equal(t, "Add readme", head.Title)
+		assert.Equal(t, "Jane Doe <jane@example.com>", head.Author)
+	})
+
+	t.Run("detached tag", func(t *testing.T) {
+		t.Parallel()
+
+		dir, repo, hash := initRepoWithCommit(t, "git@gitlab.com:group/project.git")
+		_, err := repo.CreateTag("v1.0.0", hash, &git.CreateTagOptions{
+			Tagger:  &object.Signature{Name: "Jane Doe", Email: "jane@example.com", When: time.Now()},
+			Message: "v1.0.0",
+		})
+		require.NoError(t, err)
+
+		wt, err := repo.Worktree()
+		require.NoError(t, err)
+		require.NoError(t, wt.Checkout(&git.CheckoutOptions{Hash: hash}))
+
+		head, err := (&Repo{LocalPath: dir}).Head()
+		require.NoError(t, err)
+		assert.Empty(t, head.Branch)
+		assert.Equal(t, "v1.0.0", head.Tag)
+		assert.Equal(t, "v1.0.0", head.RefName())
+	})
+
+	t.Run("empty repo", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		_, err := git.PlainInit(dir, false)
+		require.NoError(t, err)
+
+		_, err = (&Repo{LocalPath: dir}).Head()
+		require.Error(t, err)
+	})
+}
+
+func TestRepoIsTag(t *testing.T) {
+	t.Parallel()
+
+	dir, repo, hash := initRepoWithCommit(t, "git@gitlab.com:group/project.git")
+	_, err := repo.CreateTag("v1.0.0", hash, nil)
+	require.NoError(t, err)
+	_, err = repo.CreateTag("main", hash, nil)
+	require.NoError(t, err)
+
+	r := &Repo{LocalPath: dir}
+	assert.True(t, r.IsTag("v1.0.0"))
+	assert.False(t, r.IsTag("main"), "a branch wins over a tag with the same name")
+	assert.False(t, r.IsTag("feature"))
+}
@@ -0,0 +1,89 @@
+package glen
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/kevinburke/ssh_config"
+)
+
+// resolveHost returns the GitLab host to call the API on for host, the host of the
+// remote. An entry of HostAliases for host wins. Otherwise, for SSH remotes, a Host
+// alias in the SSH config at SSHConfigPath is replaced by its HostName, which may
+// itself be in HostAliases. Hosts that resolve to nothing are returned unchanged.
+func (r *Repo) resolveHost(host string, ssh bool) (string, error) {
+	if alias, ok := r.lookupAlias(host); ok {
+		return alias, nil
+	}
+	if !ssh || r.SSHConfigPath == "" {
+		return host, nil
+	}
+
+	hostName, err := sshHostName(r.SSHConfigPath, stripPort(host))
+	if err != nil {
+		return "", err
+	}
+	if hostName == "" {
+		return host, nil
+	}
+	if alias, ok := r.lookupAlias(hostName); ok {
+		return alias, nil
+	}
+
+	return hostName, nil
+}
+
+// lookupAlias returns the entry of HostAliases for host, with or without its port.
+func (r *Repo) lookupAlias(host string) (string, bool) {
+	if alias, ok := r.HostAliases[host]; ok {
+		return alias, true
+	}
+	alias, ok := r.HostAliases[stripPort(host)]
+
+	return alias, ok
+}
+
+// sshHostName returns the HostName of host in the SSH config at path, or an empty
+// string if the config does not exist or does not set one.
+func sshHostName(path string, host string) (string, error) {
+	f, err := os.Open(path) //nolint:gosec
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open SSH config: %w", err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	config, err := ssh_config.Decode(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse SSH config %s: %w", path, err)
+	}
+
+	hostName, err := config.Get(host, "HostName")
+	if err != nil {
+		return "", fmt.Errorf("failed to get HostName of %s from SSH config: %w", host, err)
+	}
+
+	return strings.ReplaceAll(hostName, "%h", host), nil
+}
+
+// stripPort returns host without its port, if it has one.
+func stripPort(host string) string {
+	h, _, err := net.SplitHostPort(host)
+	if err != nil {
+		return host
+	}
+
+	return h
+}
+
+// isSSHRemote reports whether a remote URL accepted by ParseRemoteURL is an SSH remote.
+func isSSHRemote(remoteURL string) bool {
+	remote := strings.TrimSpace(remoteURL)
+
+	return !strings.HasPrefix(remote, "http://") && !strings.HasPrefix(remote, "https://")
+}
@@ -0,0 +1,92 @@
+package glen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoResolveHost(t *testing.T) {
+	t.Parallel()
+
+	sshConfig := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(sshConfig, []byte(`Host gitlab-ssh.corp
+  HostName ssh.gitlab.corp
+  ProxyJump bastion.corp
+
+Host gitlab-mirror
+  HostName %h.corp
+
+Host *
+  User git
+`), 0o600))
+
+	aliases := map[string]string{
+		"gitlab-ssh.corp": "gitlab.corp",
+		"gitlab:2222":     "gitlab.example.com",
+		"ssh.gitlab.corp": "gitlab.corp",
+	}
+
+	tests := []struct {
+		name          string
+		host          string
+		ssh           bool
+		aliases       map[string]string
+		sshConfigPath string
+		want          string
+	}{
+		{name: "no aliases", host: "gitlab.com", ssh: true, want: "gitlab.com"},
+		{name: "alias", host: "gitlab-ssh.corp", ssh: true, aliases: aliases, want: "gitlab.corp"},
+		{name: "alias with port", host: "gitlab:2222", ssh: true, aliases: aliases, want: "gitlab.example.com"},
+		{name: "alias without port", host: "gitlab-ssh.corp:2222", ssh: true, aliases: aliases, want: "gitlab.corp"},
+		{name: "alias of https remote", host: "gitlab-ssh.corp", aliases: aliases, want: "gitlab.corp"},
+		{name: "ssh config", host: "gitlab-ssh.corp", ssh: true, sshConfigPath: sshConfig, want: "ssh.gitlab.corp"},
+		{name: "ssh config with port", host: "gitlab-ssh.corp:2222", ssh: true, sshConfigPath: sshConfig, want: "ssh.gitlab.corp"},
+		{name: "ssh config token", host: "gitlab-mirror", ssh: true, sshConfigPath: sshConfig, want: "gitlab-mirror.corp"},
+		{
+			name: "ssh config then alias", host: "gitlab-ssh.corp", ssh: true, sshConfigPath: sshConfig,
+			aliases: map[string]string{"ssh.gitlab.corp": "gitlab.corp"}, want: "gitlab.corp",
+		},
+		{name: "ssh config without host name", host: "gitlab.com", ssh: true, sshConfigPath: sshConfig, want: "gitlab.com"},
+		{name: "ssh config of https remote", host: "gitlab-ssh.corp", sshConfigPath: sshConfig, want: "gitlab-ssh.corp"},
+		{name: "missing ssh config", host: "gitlab-ssh.corp", ssh: true, sshConfigPath: sshConfig + ".missing", want: "gitlab-ssh.corp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r := &Repo{HostAliases: tt.aliases, SSHConfigPath: tt.sshConfigPath}
+			got, err := r.resolveHost(tt.host, tt.ssh)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRepoInitHostAliases(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{"git@gitlab-ssh.corp:group/project.git"},
+	})
+	require.NoError(t, err)
+
+	r := NewRepo()
+	r.LocalPath = dir
+	r.HostAliases = map[string]string{"gitlab-ssh.corp": "gitlab.corp"}
+	require.NoError(t, r.Init())
+
+	assert.Equal(t, "gitlab.corp", r.BaseURL)
+	assert.Equal(t, "gitlab.corp/group/project", r.HTTPURL)
+	assert.Equal(t, "git@gitlab-ssh.corp:group/project.git", r.RemoteURL)
+}
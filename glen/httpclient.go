@@ -0,0 +1,136 @@
+package glen
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+var (
+	// ErrNoCertificates is returned when a CA file holds no PEM certificates.
+	ErrNoCertificates = errors.New("no certificates found")
+	// ErrIncompleteClientCert is returned when only one of a client certificate and key is set.
+	ErrIncompleteClientCert = errors.New("client certificate and key must be set together")
+	// ErrUnsupportedProxy is returned when a proxy is not an HTTP, HTTPS or SOCKS5 URL.
+	ErrUnsupportedProxy = errors.New("unsupported proxy scheme")
+)
+
+// HTTPOptions configure the HTTP client that calls the GitLab API.
+type HTTPOptions struct {
+	// CAFile is a PEM file of certificate authorities that are trusted in addition
+	// to those of the system, for GitLab instances with a private CA.
+	CAFile string
+	// CertFile and KeyFile are a PEM client certificate and its key, for GitLab
+	// instances that require mutual TLS.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify accepts any server certificate. Only use it to debug.
+	InsecureSkipVerify bool
+	// Proxy is the URL of an HTTP, HTTPS or SOCKS5 proxy to call GitLab through,
+	// such as http://proxy.corp:3128 or socks5://127.0.0.1:1080. If it is empty,
+	// HTTPS_PROXY and HTTP_PROXY are used.
+	Proxy string
+	// NoProxy is a comma-separated list of hosts, domains and IP ranges to call
+	// directly, in the format of NO_PROXY. If it is empty, NO_PROXY is used.
+	NoProxy string
+}
+
+// NewHTTPClient returns an HTTP client configured by o, to be set as the
+// HTTPClient of Variables, Backup, Restore or Doctor. Unlike http.DefaultClient,
+// which reads the proxy environment variables once per process, it reads them
+// when it is created.
+func NewHTTPClient(o HTTPOptions) (*http.Client, error) {
+	config, err := o.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := o.proxy()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+	transport.TLSClientConfig = config
+	transport.Proxy = proxy
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// tlsConfig returns the TLS configuration of o.
+func (o HTTPOptions) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: o.InsecureSkipVerify, //nolint:gosec
+	}
+
+	if o.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w in CA file %s", ErrNoCertificates, o.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return nil, ErrIncompleteClientCert
+	}
+	if o.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// proxy returns the proxy function of o, which never proxies requests to localhost.
+func (o HTTPOptions) proxy() (func(*http.Request) (*url.URL, error), error) {
+	config := httpproxy.FromEnvironment()
+
+	if o.Proxy != "" {
+		proxy := o.Proxy
+		if !strings.Contains(proxy, "://") {
+			proxy = "http://" + proxy
+		}
+
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse proxy: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("%w %s, expected http, https or socks5", ErrUnsupportedProxy, u.Scheme)
+		}
+
+		config.HTTPProxy = proxy
+		config.HTTPSProxy = proxy
+	}
+	if o.NoProxy != "" {
+		config.NoProxy = o.NoProxy
+	}
+
+	proxyURL := config.ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyURL(req.URL) //nolint:wrapcheck
+	}, nil
+}
@@ -0,0 +1,223 @@
+package glen
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePEM writes a PEM block to a file in dir and returns its path.
+func writePEM(t *testing.T, dir string, name string, blockType string, der []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+
+	return path
+}
+
+// newClientCert creates a self-signed client certificate and returns it with the
+// paths of its certificate and key files.
+func newClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "glen"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return cert, writePEM(t, dir, "client.pem", "CERTIFICATE", der), writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	clientCert, certFile, keyFile := newClientCert(t, dir)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: clientCAs, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	emptyFile := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(emptyFile, nil, 0o600))
+
+	tests := []struct {
+		name       string
+		options    HTTPOptions
+		wantErr    error
+		wantGetErr bool
+	}{
+		{name: "untrusted", options: HTTPOptions{}, wantGetErr: true},
+		{name: "ca file", options: HTTPOptions{CAFile: caFile}},
+		{name: "insecure", options: HTTPOptions{InsecureSkipVerify: true}},
+		{name: "client cert", options: HTTPOptions{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}},
+		{name: "empty ca file", options: HTTPOptions{CAFile: emptyFile}, wantErr: ErrNoCertificates},
+		{name: "cert without key", options: HTTPOptions{CertFile: certFile}, wantErr: ErrIncompleteClientCert},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, err := NewHTTPClient(tt.options)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+
+			resp, err := client.Get(server.URL) //nolint:noctx
+			if tt.wantGetErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		})
+	}
+}
+
+func TestNewHTTPClientRequiredClientCert(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	clientCert, certFile, keyFile := newClientCert(t, dir)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	var peer string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer = r.TLS.PeerCertificates[0].Subject.CommonName
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	client, err := NewHTTPClient(HTTPOptions{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	_, err = client.Get(server.URL) //nolint:bodyclose,noctx
+	require.Error(t, err)
+
+	client, err = NewHTTPClient(HTTPOptions{InsecureSkipVerify: true, CertFile: certFile, KeyFile: keyFile})
+	require.NoError(t, err)
+	resp, err := client.Get(server.URL) //nolint:noctx
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "glen", peer)
+}
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	t.Parallel()
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proxied-Host", r.URL.Host)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(proxy.Close)
+
+	// socks is a SOCKS5 proxy that records the greeting of the client and hangs up
+	socks, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { socks.Close() })
+	greeting := make(chan byte, 1)
+	go func() {
+		conn, err := socks.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b := make([]byte, 1)
+		if _, err := conn.Read(b); err == nil {
+			greeting <- b[0]
+		}
+	}()
+
+	tests := []struct {
+		name        string
+		options     HTTPOptions
+		wantErr     error
+		wantProxied string
+	}{
+		{name: "http proxy", options: HTTPOptions{Proxy: proxy.URL}, wantProxied: "gitlab.test"},
+		{name: "proxy without scheme", options: HTTPOptions{Proxy: strings.TrimPrefix(proxy.URL, "http://")}, wantProxied: "gitlab.test"},
+		{name: "no proxy", options: HTTPOptions{Proxy: proxy.URL, NoProxy: "other.test,.test"}},
+		{name: "unsupported scheme", options: HTTPOptions{Proxy: "ftp://proxy.test"}, wantErr: ErrUnsupportedProxy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client, err := NewHTTPClient(tt.options)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+
+			resp, err := client.Get("http://gitlab.test/api/v4/version") //nolint:noctx
+			if tt.wantProxied == "" {
+				// gitlab.test does not resolve, so a direct request fails
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.wantProxied, resp.Header.Get("X-Proxied-Host"))
+		})
+	}
+
+	t.Run("socks5 proxy", func(t *testing.T) {
+		t.Parallel()
+
+		client, err := NewHTTPClient(HTTPOptions{Proxy: "socks5://" + socks.Addr().String()})
+		require.NoError(t, err)
+		_, err = client.Get("http://gitlab.test/api/v4/version") //nolint:bodyclose,noctx
+		require.Error(t, err)
+		assert.Equal(t, byte(5), <-greeting)
+	})
+}
@@ -0,0 +1,60 @@
+package glen
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// orDiscard returns logger, or a logger that discards every record if it is nil.
+func orDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+
+	return logger
+}
+
+// loggingTransport logs every request to the GitLab API at debug level with its
+// status and duration. Only the method and URL are logged, never headers or
+// bodies, so that tokens and variable values stay out of the logs.
+type loggingTransport struct {
+	base   http.RoundTripper
+	logger *slog.Logger
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	attrs := []any{"method", req.Method, "url", redactURL(req.URL), "duration", time.Since(start)}
+
+	if err != nil {
+		t.logger.DebugContext(req.Context(), "gitlab request failed", append(attrs, "error", err)...)
+
+		return resp, err //nolint:wrapcheck
+	}
+	t.logger.DebugContext(req.Context(), "gitlab request", append(attrs, "status", resp.StatusCode)...)
+
+	return resp, nil
+}
+
+// redactURL returns u without its user info, which may hold a token.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+
+	return redacted.String()
+}
+
+// redactRemote returns a git remote URL without its user info. SCP-like remotes
+// such as git@gitlab.com:group/project.git are returned as they are.
+func redactRemote(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil || u.User == nil {
+		return remote
+	}
+
+	return redactURL(u)
+}
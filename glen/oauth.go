@@ -0,0 +1,62 @@
+package glen
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// TokenRefresher is an oauth2.TokenSource that can refresh a token before it
+// expires, for example when GitLab revoked it or the clocks disagree. Refresh is
+// passed the access token that GitLab rejected, so that when several requests fail
+// at once the token is only refreshed for the first of them.
+type TokenRefresher interface {
+	oauth2.TokenSource
+	Refresh(rejected string) (*oauth2.Token, error)
+}
+
+// refreshTransport retries a request once with a refreshed token when GitLab
+// answers it with 401 Unauthorized.
+type refreshTransport struct {
+	base      http.RoundTripper
+	refresher TokenRefresher
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *refreshTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err //nolint:wrapcheck
+	}
+
+	// Requests with a body that cannot be replayed are not retried
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	rejected := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	token, err := t.refresher.Refresh(rejected)
+	if err != nil {
+		// The original 401 describes the problem better than a failed refresh
+		return resp, nil
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+	}
+	token.SetAuthHeader(retry)
+	defer resp.Body.Close() //nolint:errcheck
+
+	resp, err = t.base.RoundTrip(retry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retry with a refreshed token: %w", err)
+	}
+
+	return resp, nil
+}
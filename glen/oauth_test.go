@@ -0,0 +1,97 @@
+package glen
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+)
+
+// testRefresher starts with an access token and refreshes it to fresh.
+type testRefresher struct {
+	mu        sync.Mutex
+	token     string
+	fresh     string
+	err       error
+	refreshes int
+}
+
+func (r *testRefresher) Token() (*oauth2.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &oauth2.Token{AccessToken: r.token}, nil
+}
+
+func (r *testRefresher) Refresh(rejected string) (*oauth2.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	if rejected == r.token {
+		r.token = r.fresh
+		r.refreshes++
+	}
+
+	return &oauth2.Token{AccessToken: r.token}, nil
+}
+
+func TestVariablesInitTokenSource(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		source        oauth2.TokenSource
+		want          map[string]string
+		wantRefreshes int
+	}{
+		{
+			name:   "static",
+			source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "oauth-token"}),
+			want:   map[string]string{"ROOT": "root", "SUB": "sub", "PROJECT": "project", "SHARED": "project", "SECRET": "secret"},
+		},
+		{
+			name:          "refreshed on 401",
+			source:        &testRefresher{token: "expired", fresh: "oauth-token"},
+			want:          map[string]string{"ROOT": "root", "SUB": "sub", "PROJECT": "project", "SHARED": "project", "SECRET": "secret"},
+			wantRefreshes: 1,
+		},
+		{
+			name:   "refresh fails",
+			source: &testRefresher{token: "expired", err: errors.New("refresh token revoked")},
+			want:   map[string]string{},
+		},
+		{
+			name:   "static rejected",
+			source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "expired"}),
+			want:   map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newTestServer(t)
+			s.Token = "oauth-token"
+
+			v := newTestVariables(t, s)
+			v.SetAPIKey("")
+			v.TokenSource = tt.source
+			v.Recurse = true
+			v.Environment = "review"
+
+			require.NoError(t, v.Init())
+			assert.Equal(t, tt.want, v.Env)
+
+			if r, ok := tt.source.(*testRefresher); ok {
+				assert.Equal(t, tt.wantRefreshes, r.refreshes)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package glen
+
+import (
+	"errors"
+	"fmt"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go/v2"
+)
+
+// Gitlab list apis default to 20 per page with 100 being the max.
+// https://docs.gitlab.com/ee/api/README.html#offset-based-pagination
+// Set to max to reduce number of API calls required.
+const pageSize = 100
+
+// maxPages caps the number of pages a single list call fetches, so that a server
+// that always returns a next page cannot keep glen busy forever.
+const maxPages = 1000
+
+// ErrTooManyPages is returned when a list call has more than maxPages pages.
+var ErrTooManyPages = errors.New("too many pages")
+
+// listFunc fetches one page of a GitLab list API, with the pagination set by opts.
+type listFunc[T any] func(opts ...gitlab.RequestOptionFunc) ([]T, *gitlab.Response, error)
+
+// listAll returns the items of every page of a GitLab list API. It follows the
+// X-Next-Page header or, when that is missing, the 'next' link of the Link header,
+// so that it works with keyset pagination and does not depend on X-Total-Pages,
+// which GitLab leaves out for large collections and some proxies strip.
+// https://docs.gitlab.com/ee/api/rest/#pagination
+func listAll[T any](list listFunc[T]) ([]T, error) {
+	return listUntil(list, func([]T) bool { return false })
+}
+
+// listUntil is listAll, but stops after the first page that done returns true
+// for, so that searches do not fetch every page.
+func listUntil[T any](list listFunc[T], done func(page []T) bool) ([]T, error) {
+	var (
+		all  []T
+		opts []gitlab.RequestOptionFunc
+	)
+
+	for range maxPages {
+		items, response, err := list(opts...)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if done(items) {
+			return all, nil
+		}
+
+		switch {
+		case response.NextPage > 0:
+			opts = []gitlab.RequestOptionFunc{gitlab.WithOffsetPaginationParameters(response.NextPage)}
+		case response.NextLink != "":
+			opts = []gitlab.RequestOptionFunc{gitlab.WithKeysetPaginationParameters(response.NextLink)}
+		default:
+			return all, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: more than %d", ErrTooManyPages, maxPages)
+}
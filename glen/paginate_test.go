@@ -0,0 +1,139 @@
+package glen
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/lingrino/glen/glentest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gitlab "gitlab.com/gitlab-org/api/client-go/v2"
+)
+
+func TestListAll(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		responses []*gitlab.Response
+		want      []int
+	}{
+		{
+			name:      "single page",
+			responses: []*gitlab.Response{{}},
+			want:      []int{0},
+		},
+		{
+			name:      "next page without totals",
+			responses: []*gitlab.Response{{NextPage: 2}, {NextPage: 3}, {}},
+			want:      []int{0, 1, 2},
+		},
+		{
+			name:      "next link",
+			responses: []*gitlab.Response{{NextLink: "https://gitlab.example.com/api/v4/x?id_after=1"}, {}},
+			want:      []int{0, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			calls := 0
+			items, err := listAll(func(_ ...gitlab.RequestOptionFunc) ([]int, *gitlab.Response, error) {
+				calls++
+
+				return []int{calls - 1}, tt.responses[calls-1], nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, items)
+		})
+	}
+}
+
+func TestListAllErrors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+
+		errList := errors.New("list failed")
+		_, err := listAll(func(_ ...gitlab.RequestOptionFunc) ([]int, *gitlab.Response, error) {
+			return nil, nil, errList
+		})
+		require.ErrorIs(t, err, errList)
+	})
+
+	t.Run("too many pages", func(t *testing.T) {
+		t.Parallel()
+
+		calls := 0
+		_, err := listAll(func(_ ...gitlab.RequestOptionFunc) ([]int, *gitlab.Response, error) {
+			calls++
+
+			return []int{calls}, &gitlab.Response{NextPage: 2}, nil
+		})
+		require.ErrorIs(t, err, ErrTooManyPages)
+		assert.Equal(t, maxPages, calls)
+	})
+}
+
+func TestListUntil(t *testing.T) {
+	t.Parallel()
+
+	calls := 0
+	items, err := listUntil(func(_ ...gitlab.RequestOptionFunc) ([]int, *gitlab.Response, error) {
+		calls++
+
+		return []int{calls}, &gitlab.Response{NextPage: int64(calls + 1)}, nil
+	}, func(page []int) bool { return page[0] == 2 })
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, items)
+	assert.Equal(t, 2, calls)
+}
+
+func TestListProjectVariablesPagination(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		configure func(s *glentest.Server)
+	}{
+		{name: "totals", configure: func(_ *glentest.Server) {}},
+		{name: "no totals", configure: func(s *glentest.Server) { s.OmitTotals = true }},
+		{name: "link header only", configure: func(s *glentest.Server) {
+			s.OmitTotals = true
+			s.OmitPageHeaders = true
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := glentest.NewServer(t)
+			tt.configure(s)
+
+			want := make([]string, 0, 2*pageSize+1)
+			for i := range 2*pageSize + 1 {
+				key := "KEY_" + strconv.Itoa(i)
+				want = append(want, key)
+				s.AddProjectVariables("group/project", glentest.Variable{Key: key})
+			}
+
+			glc, err := newClient(clientConfig{apiURL: s.URL, apiKey: s.Token})
+			require.NoError(t, err)
+
+			vars, err := listProjectVariables(glc, "group/project")
+			require.NoError(t, err)
+
+			keys := make([]string, 0, len(vars))
+			for _, v := range vars {
+				keys = append(keys, v.Key)
+			}
+			assert.Equal(t, want, keys)
+			assert.Len(t, s.Requests(), 3)
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package glen
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go/v2"
+)
+
+// SourcePipeline is the prefix of the Variable.Source of the variables that a
+// pipeline was created with, such as "pipeline:1234".
+const SourcePipeline = "pipeline"
+
+// ErrJobNotInPipeline is returned when a job is selected along with a pipeline
+// that it does not belong to.
+var ErrJobNotInPipeline = errors.New("job is not in the pipeline")
+
+// Pipeline is the pipeline, and optionally the job, whose variables Variables
+// reproduces. Job fields are empty when only a pipeline was selected, and
+// Environment is empty when the job does not deploy to an environment.
+type Pipeline struct {
+	ID     int64
+	Ref    string
+	Tag    bool
+	SHA    string
+	Source string
+
+	JobID       int64
+	JobName     string
+	Stage       string
+	Environment string
+}
+
+// getPipeline looks up the pipeline and job selected by Variables.PipelineID and
+// Variables.JobID, if any, and simulates their ref and environment unless
+// Variables.Ref and Variables.Environment are set.
+func (v *Variables) getPipeline(glc *gitlab.Client) error {
+	if v.PipelineID == 0 && v.JobID == 0 {
+		return nil
+	}
+
+	p := &Pipeline{ID: v.PipelineID}
+	if v.JobID != 0 {
+		err := p.setJob(glc, v.Repo.Path, v.JobID)
+		if err != nil {
+			return err
+		}
+	}
+
+	pipeline, _, err := glc.Pipelines.GetPipeline(v.Repo.Path, p.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get pipeline %d of project %s: %w", p.ID, v.Repo.Path, err)
+	}
+	p.Ref = pipeline.Ref
+	p.Tag = pipeline.Tag
+	p.SHA = pipeline.SHA
+	p.Source = string(pipeline.Source)
+
+	v.Pipeline = p
+	v.SimulateRef = true
+	if v.Ref == "" {
+		v.Ref = p.Ref
+	}
+	if v.Environment == "" {
+		v.Environment = p.Environment
+	}
+	orDiscard(v.Logger).Debug("simulated pipeline", "pipeline", p.ID, "job", p.JobID, "ref", p.Ref,
+		"environment", p.Environment)
+
+	return nil
+}
+
+// setJob sets the job with id, and the pipeline it belongs to, on p.
+func (p *Pipeline) setJob(glc *gitlab.Client, project string, id int64) error {
+	job, _, err := glc.Jobs.GetJob(project, id)
+	if err != nil {
+		return fmt.Errorf("failed to get job %d of project %s: %w", id, project, err)
+	}
+	if p.ID != 0 && p.ID != job.Pipeline.ID {
+		return fmt.Errorf("%w: job %d is in pipeline %d", ErrJobNotInPipeline, id, job.Pipeline.ID)
+	}
+
+	p.ID = job.Pipeline.ID
+	p.JobID = job.ID
+	p.JobName = job.Name
+	p.Stage = job.Stage
+
+	p.Environment, err = jobEnvironment(glc, project, job.ID)
+
+	return err
+}
+
+// jobEnvironment returns the name of the environment that the job deploys to, or
+// an empty string if it deploys to none. The jobs API does not return it, so it
+// is found in the deployments of the project, from the newest. GitLab creates the
+// deployment of a job along with the job, so the search stops at the first
+// deployment of an older job.
+func jobEnvironment(glc *gitlab.Client, project string, job int64) (string, error) {
+	opt := &gitlab.ListProjectDeploymentsOptions{
+		ListOptions: gitlab.ListOptions{PerPage: pageSize},
+		OrderBy:     gitlab.Ptr("id"),
+		Sort:        gitlab.Ptr("desc"),
+	}
+
+	var environment string
+	found := func(deployments []*gitlab.Deployment) bool {
+		for _, d := range deployments {
+			switch {
+			case d.Deployable.ID == job && d.Environment != nil:
+				environment = d.Environment.Name
+
+				return true
+			case d.Deployable.ID != 0 && d.Deployable.ID < job:
+				return true
+			}
+		}
+
+		return false
+	}
+
+	_, err := listUntil(func(opts ...gitlab.RequestOptionFunc) ([]*gitlab.Deployment, *gitlab.Response, error) {
+		return glc.Deployments.ListProjectDeployments(project, opt, opts...)
+	}, found)
+	if err != nil {
+		return "", fmt.Errorf("failed to get deployments of project %s: %w", project, err)
+	}
+
+	return environment, nil
+}
+
+// getPipelineVariables adds the variables that the pipeline was created with, by
+// a trigger, a schedule or by hand. They take precedence over every other variable.
+func (v *Variables) getPipelineVariables(glc *gitlab.Client) error {
+	if v.Pipeline == nil {
+		return nil
+	}
+
+	pvs, _, err := glc.Pipelines.GetPipelineVariables(v.Repo.Path, v.Pipeline.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get variables of pipeline %d: %w", v.Pipeline.ID, err)
+	}
+
+	source := SourcePipeline + ":" + strconv.FormatInt(v.Pipeline.ID, 10)
+	for _, pv := range pvs {
+		v.set(Variable{
+			Key:              pv.Key,
+			Value:            pv.Value,
+			VariableType:     string(pv.VariableType),
+			EnvironmentScope: "*",
+			Source:           source,
+		})
+	}
+	orDiscard(v.Logger).Debug("got variables", "pipeline", v.Pipeline.ID, "count", len(pvs))
+
+	return nil
+}
+
+// setPredefinedVariables sets the predefined variables that describe the pipeline
+// and job in vars, replacing those derived from the local checkout. Variables that
+// describe the checked out commit are removed when the pipeline ran on another.
+// The ref of the pipeline is Variables.Ref, which setRefVariables sets.
+func (p *Pipeline) setPredefinedVariables(vars map[string]string) {
+	if p.SHA != "" && vars["CI_COMMIT_SHA"] != p.SHA {
+		for _, key := range []string{
+			"CI_COMMIT_BEFORE_SHA", "CI_COMMIT_MESSAGE", "CI_COMMIT_TITLE",
+			"CI_COMMIT_DESCRIPTION", "CI_COMMIT_AUTHOR", "CI_COMMIT_TIMESTAMP",
+		} {
+			delete(vars, key)
+		}
+		vars["CI_COMMIT_SHA"] = p.SHA
+		vars["CI_COMMIT_SHORT_SHA"] = p.SHA[:min(8, len(p.SHA))] //nolint:mnd
+	}
+
+	vars["CI_PIPELINE_ID"] = strconv.FormatInt(p.ID, 10)
+	vars["CI_PIPELINE_SOURCE"] = p.Source
+	if p.JobID != 0 {
+		vars["CI_JOB_ID"] = strconv.FormatInt(p.JobID, 10)
+		vars["CI_JOB_NAME"] = p.JobName
+		vars["CI_JOB_STAGE"] = p.Stage
+	}
+	if p.Environment != "" {
+		vars["CI_ENVIRONMENT_NAME"] = p.Environment
+	}
+}
@@ -0,0 +1,207 @@
+package glen
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/lingrino/glen/glentest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testProject = "group/sub/project"
+
+// newTestPipelineServer returns a test server with pipelines on an unprotected
+// branch and on a branch named like a protected tag, and a tag pipeline that
+// deploys to production.
+func newTestPipelineServer(t *testing.T) *glentest.Server {
+	t.Helper()
+
+	s := newTestServer(t)
+	s.AddProtectedTags(testProject, "v*")
+	s.AddPipeline(testProject, glentest.Pipeline{
+		ID: 10, Ref: "feature", SHA: "aaaaaaaaaaaa", Source: "trigger",
+		Variables: []glentest.Variable{{Key: "SHARED", Value: "trigger"}, {Key: "TRIGGER", Value: "trigger"}},
+	})
+	s.AddPipeline(testProject, glentest.Pipeline{ID: 20, Ref: "v1.0.0", Tag: true, SHA: "bbbbbbbbbbbb", Source: "push"})
+	s.AddPipeline(testProject, glentest.Pipeline{ID: 40, Ref: "v2", SHA: "cccccccccccc", Source: "push"})
+	s.AddJob(testProject, glentest.Job{ID: 100, PipelineID: 10, Name: "test", Stage: "test"})
+	s.AddJob(testProject, glentest.Job{ID: 200, PipelineID: 20, Name: "build", Stage: "build"})
+	s.AddJob(testProject, glentest.Job{
+		ID: 201, PipelineID: 20, Name: "deploy", Stage: "deploy", Environment: "production",
+	})
+	s.AddJob(testProject, glentest.Job{ID: 202, PipelineID: 20, Name: "review", Stage: "deploy", Environment: "staging"})
+
+	return s
+}
+
+func TestVariablesInitPipeline(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		configure func(v *Variables)
+		want      map[string]string
+		wantRef   string
+		wantEnv   string
+	}{
+		{
+			name:      "pipeline",
+			configure: func(v *Variables) { v.PipelineID = 10 },
+			want: map[string]string{
+				"PROJECT": "project", "SHARED": "trigger", "DEPLOY": "production", "TRIGGER": "trigger",
+			},
+			wantRef: "feature",
+		},
+		{
+			name:      "protected tag",
+			configure: func(v *Variables) { v.PipelineID = 20 },
+			want: map[string]string{
+				"PROJECT": "project", "SHARED": "project", "DEPLOY": "production", "SECRET": "secret",
+			},
+			wantRef: "v1.0.0",
+		},
+		{
+			name:      "branch named like a protected tag",
+			configure: func(v *Variables) { v.PipelineID = 40 },
+			want:      map[string]string{"PROJECT": "project", "SHARED": "project", "DEPLOY": "production"},
+			wantRef:   "v2",
+		},
+		{
+			name:      "job environment",
+			configure: func(v *Variables) { v.JobID = 201 },
+			want: map[string]string{
+				"PROJECT": "project", "SHARED": "project", "DEPLOY": "production", "SECRET": "secret",
+			},
+			wantRef: "v1.0.0",
+			wantEnv: "production",
+		},
+		{
+			name:      "job without environment",
+			configure: func(v *Variables) { v.JobID = 200 },
+			want:      map[string]string{"PROJECT": "project", "SHARED": "project", "SECRET": "secret"},
+			wantRef:   "v1.0.0",
+		},
+		{
+			name: "explicit ref and environment",
+			configure: func(v *Variables) {
+				v.JobID = 201
+				v.Ref = "feature"
+				v.Environment = "staging"
+			},
+			want:    map[string]string{"PROJECT": "project", "SHARED": "project", "DEPLOY": "staging"},
+			wantRef: "feature",
+			wantEnv: "staging",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newTestPipelineServer(t)
+			v := newTestVariables(t, s)
+			tt.configure(v)
+
+			require.NoError(t, v.Init())
+			assert.Equal(t, tt.want, v.Env)
+			assert.Equal(t, tt.wantRef, v.Ref)
+			assert.Equal(t, tt.wantEnv, v.Environment)
+		})
+	}
+}
+
+func TestVariablesInitPipelineSource(t *testing.T) {
+	t.Parallel()
+
+	s := newTestPipelineServer(t)
+	v := newTestVariables(t, s)
+	v.PipelineID = 10
+
+	require.NoError(t, v.Init())
+	assert.Equal(t, "pipeline:10", v.Vars["TRIGGER"].Source)
+	assert.Equal(t, "project:group/sub/project", v.Vars["PROJECT"].Source)
+	assert.Equal(t, &Pipeline{ID: 10, Ref: "feature", SHA: "aaaaaaaaaaaa", Source: "trigger"}, v.Pipeline)
+}
+
+func TestVariablesInitPipelineErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		configure func(v *Variables)
+		wantErr   error
+	}{
+		{
+			name:      "job not in pipeline",
+			configure: func(v *Variables) { v.PipelineID, v.JobID = 10, 201 },
+			wantErr:   ErrJobNotInPipeline,
+		},
+		{name: "missing pipeline", configure: func(v *Variables) { v.PipelineID = 30 }},
+		{name: "missing job", configure: func(v *Variables) { v.JobID = 300 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newTestPipelineServer(t)
+			v := newTestVariables(t, s)
+			tt.configure(v)
+
+			err := v.Init()
+			require.Error(t, err)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVariablesInitPipelineCIVars(t *testing.T) {
+	t.Parallel()
+
+	s := newTestPipelineServer(t)
+	v := newTestVariables(t, s)
+	glentest.Commit(t, v.Repo.LocalPath, map[string]string{"README.md": "hello"}, "Add readme")
+	v.CIVars = true
+	v.JobID = 201
+
+	require.NoError(t, v.Init())
+	assert.Equal(t, "bbbbbbbbbbbb", v.Env["CI_COMMIT_SHA"])
+	assert.Equal(t, "bbbbbbbb", v.Env["CI_COMMIT_SHORT_SHA"])
+	assert.Equal(t, "v1.0.0", v.Env["CI_COMMIT_TAG"])
+	assert.NotContains(t, v.Env, "CI_COMMIT_BRANCH")
+	assert.NotContains(t, v.Env, "CI_COMMIT_MESSAGE")
+	assert.Equal(t, "20", v.Env["CI_PIPELINE_ID"])
+	assert.Equal(t, "push", v.Env["CI_PIPELINE_SOURCE"])
+	assert.Equal(t, "201", v.Env["CI_JOB_ID"])
+	assert.Equal(t, "deploy", v.Env["CI_JOB_NAME"])
+	assert.Equal(t, "deploy", v.Env["CI_JOB_STAGE"])
+	assert.Equal(t, "production", v.Env["CI_ENVIRONMENT_NAME"])
+}
+
+func TestJobEnvironmentPagination(t *testing.T) {
+	t.Parallel()
+
+	s := glentest.NewServer(t)
+	s.OmitTotals = true
+	s.OmitPageHeaders = true
+	s.AddPipeline(testProject, glentest.Pipeline{ID: 1, Ref: "main", SHA: "aaaaaaaaaaaa", Source: "push"})
+	for id := 1; id <= pageSize+10; id++ {
+		s.AddJob(testProject, glentest.Job{ID: id, PipelineID: 1, Name: "deploy", Stage: "deploy", Environment: "env-" + strconv.Itoa(id)})
+	}
+
+	glc, err := newClient(clientConfig{apiURL: s.URL, apiKey: s.Token})
+	require.NoError(t, err)
+
+	env, err := jobEnvironment(glc, testProject, 5)
+	require.NoError(t, err)
+	assert.Equal(t, "env-5", env)
+	assert.Len(t, s.Requests(), 2)
+
+	env, err = jobEnvironment(glc, testProject, pageSize+5)
+	require.NoError(t, err)
+	assert.Equal(t, "env-"+strconv.Itoa(pageSize+5), env)
+	assert.Len(t, s.Requests(), 3)
+}
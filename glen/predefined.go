@@ -0,0 +1,206 @@
+package glen
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go/v2"
+)
+
+// SourcePredefined is the Variable.Source of GitLab predefined CI/CD variables.
+const SourcePredefined = "predefined"
+
+// maxSlugLength is the length GitLab shortens *_SLUG variables to.
+const maxSlugLength = 63
+
+// zeroSHA is the value of CI_COMMIT_BEFORE_SHA when there is no previous commit.
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+var slugRegexp = regexp.MustCompile(`[^a-z0-9]`)
+
+// PredefinedVariables returns the GitLab predefined CI/CD variables that can be
+// derived from the local repo alone, such as CI_PROJECT_PATH, CI_SERVER_URL and
+// CI_COMMIT_SHA. The repo must have been initialized with Init. Commit variables
+// are left out if the repo has no commits.
+// https://docs.gitlab.com/ee/ci/variables/predefined_variables.html
+func (r *Repo) PredefinedVariables() (map[string]string, error) {
+	serverHost, serverPort := splitHostPort(r.BaseURL)
+	serverURL := "https://" + r.BaseURL
+
+	absPath, err := filepath.Abs(r.LocalPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve path (%s): %w", r.LocalPath, err)
+	}
+
+	vars := map[string]string{
+		"CI":                        "true",
+		"GITLAB_CI":                 "true",
+		"CI_SERVER":                 "yes",
+		"CI_SERVER_URL":             serverURL,
+		"CI_SERVER_HOST":            serverHost,
+		"CI_SERVER_PORT":            serverPort,
+		"CI_SERVER_PROTOCOL":        "https",
+		"CI_SERVER_FQDN":            r.BaseURL,
+		"CI_API_V4_URL":             serverURL + "/api/v4",
+		"CI_PROJECT_DIR":            absPath,
+		"CI_PROJECT_PATH":           r.Path,
+		"CI_PROJECT_PATH_SLUG":      slugify(r.Path),
+		"CI_PROJECT_NAME":           path.Base(r.Path),
+		"CI_PROJECT_NAMESPACE":      path.Dir(r.Path),
+		"CI_PROJECT_ROOT_NAMESPACE": strings.SplitN(r.Path, "/", 2)[0], //nolint:mnd
+		"CI_PROJECT_URL":            serverURL + "/" + r.Path,
+		"CI_REPOSITORY_URL":         serverURL + "/" + r.Path + ".git",
+		"CI_PIPELINE_SOURCE":        "push",
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		//nolint:nilerr // an empty repo simply has no commit variables
+		return vars, nil
+	}
+
+	vars["CI_COMMIT_SHA"] = head.SHA
+	vars["CI_COMMIT_SHORT_SHA"] = head.SHA[:8]
+	vars["CI_COMMIT_BEFORE_SHA"] = zeroSHA
+	vars["CI_COMMIT_REF_NAME"] = head.RefName()
+	vars["CI_COMMIT_REF_SLUG"] = slugify(head.RefName())
+	vars["CI_COMMIT_MESSAGE"] = head.Message
+	vars["CI_COMMIT_TITLE"] = head.Title
+	vars["CI_COMMIT_DESCRIPTION"] = strings.TrimPrefix(strings.TrimPrefix(head.Message, head.Title), "\n")
+	vars["CI_COMMIT_AUTHOR"] = head.Author
+	vars["CI_COMMIT_TIMESTAMP"] = head.Timestamp.Format(time.RFC3339)
+
+	// GitLab sets CI_COMMIT_TAG only in tag pipelines, which run on a detached
+	// checkout of the tag, and CI_COMMIT_BRANCH only in branch pipelines.
+	if head.Branch != "" {
+		vars["CI_COMMIT_BRANCH"] = head.Branch
+	} else if head.Tag != "" {
+		vars["CI_COMMIT_TAG"] = head.Tag
+	}
+
+	return vars, nil
+}
+
+// getPredefinedVariables adds the predefined variables of the repo to v.Env,
+// including those that require the GitLab API like CI_PROJECT_ID and CI_DEFAULT_BRANCH.
+func (v *Variables) getPredefinedVariables(glc *gitlab.Client) error {
+	vars, err := v.Repo.PredefinedVariables()
+	if err != nil {
+		return err
+	}
+
+	project, _, err := glc.Projects.GetProject(v.Repo.Path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get project %s: %w", v.Repo.Path, err)
+	}
+
+	vars["CI_PROJECT_ID"] = strconv.FormatInt(project.ID, 10)
+	vars["CI_PROJECT_TITLE"] = project.Name
+	vars["CI_PROJECT_DESCRIPTION"] = project.Description
+	vars["CI_PROJECT_VISIBILITY"] = string(project.Visibility)
+	vars["CI_DEFAULT_BRANCH"] = project.DefaultBranch
+	if v.Pipeline != nil {
+		v.Pipeline.setPredefinedVariables(vars)
+	}
+	if v.PipelineSource != "" {
+		vars["CI_PIPELINE_SOURCE"] = v.PipelineSource
+	}
+	if v.SimulateRef {
+		vars["CI_COMMIT_REF_PROTECTED"] = strconv.FormatBool(!v.dropProtected)
+	}
+	if v.Ref != "" {
+		v.setRefVariables(vars)
+	}
+	if v.APIURL != "" {
+		v.setServerVariables(vars)
+	}
+	if project.Namespace != nil {
+		vars["CI_PROJECT_NAMESPACE_ID"] = strconv.FormatInt(project.Namespace.ID, 10)
+	}
+
+	for key, value := range vars {
+		v.set(Variable{
+			Key:              key,
+			Value:            value,
+			VariableType:     string(gitlab.EnvVariableType),
+			Raw:              true,
+			EnvironmentScope: "*",
+			Source:           SourcePredefined,
+		})
+	}
+
+	return nil
+}
+
+// setServerVariables sets the variables that describe the GitLab server in vars
+// to those of Variables.APIURL, which may differ from the host of the remote, for
+// example when the API is served on another port or under a relative URL root.
+func (v *Variables) setServerVariables(vars map[string]string) {
+	u, err := url.Parse(strings.TrimSuffix(v.APIURL, "/"))
+	if err != nil || u.Host == "" {
+		return
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+	serverURL := u.Scheme + "://" + u.Host + strings.TrimSuffix(u.Path, "/api/v4")
+
+	vars["CI_SERVER_URL"] = serverURL
+	vars["CI_SERVER_HOST"] = u.Hostname()
+	vars["CI_SERVER_PORT"] = port
+	vars["CI_SERVER_PROTOCOL"] = u.Scheme
+	vars["CI_SERVER_FQDN"] = u.Host
+	vars["CI_API_V4_URL"] = serverURL + "/api/v4"
+	vars["CI_PROJECT_URL"] = serverURL + "/" + v.Repo.Path
+	vars["CI_REPOSITORY_URL"] = serverURL + "/" + v.Repo.Path + ".git"
+}
+
+// setRefVariables sets the variables that name the ref in vars to Variables.Ref,
+// with CI_COMMIT_TAG if it is a tag and CI_COMMIT_BRANCH otherwise, so that rules
+// on either see the simulated ref.
+func (v *Variables) setRefVariables(vars map[string]string) {
+	tag := v.refIsTag()
+
+	vars["CI_COMMIT_REF_NAME"] = v.Ref
+	vars["CI_COMMIT_REF_SLUG"] = slugify(v.Ref)
+	delete(vars, "CI_COMMIT_BRANCH")
+	delete(vars, "CI_COMMIT_TAG")
+	if tag {
+		vars["CI_COMMIT_TAG"] = v.Ref
+	} else {
+		vars["CI_COMMIT_BRANCH"] = v.Ref
+	}
+}
+
+// slugify lowercases s, replaces everything except a-z and 0-9 with '-', shortens
+// it to 63 bytes and trims leading and trailing '-', like GitLab's *_SLUG variables.
+func slugify(s string) string {
+	slug := slugRegexp.ReplaceAllString(strings.ToLower(s), "-")
+	if len(slug) > maxSlugLength {
+		slug = slug[:maxSlugLength]
+	}
+
+	return strings.Trim(slug, "-")
+}
+
+// splitHostPort splits a host with an optional port, defaulting to the HTTPS port.
+func splitHostPort(hostport string) (string, string) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return hostport, "443"
+	}
+
+	return host, port
+}
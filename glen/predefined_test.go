@@ -0,0 +1,108 @@
+package glen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoPredefinedVariables(t *testing.T) {
+	t.Parallel()
+
+	dir, _, hash := initRepoWithCommit(t, "https://gitlab.example.com:8443/My-Group/sub/Project.git")
+
+	repo := &Repo{LocalPath: dir, RemoteName: "origin"}
+	require.NoError(t, repo.Init())
+
+	vars, err := repo.PredefinedVariables()
+	require.NoError(t, err)
+
+	assert.Equal(t, "true", vars["GITLAB_CI"])
+	assert.Equal(t, "https://gitlab.example.com:8443", vars["CI_SERVER_URL"])
+	assert.Equal(t, "gitlab.example.com", vars["CI_SERVER_HOST"])
+	assert.Equal(t, "8443", vars["CI_SERVER_PORT"])
+	assert.Equal(t, "https://gitlab.example.com:8443/api/v4", vars["CI_API_V4_URL"])
+	assert.Equal(t, "My-Group/sub/Project", vars["CI_PROJECT_PATH"])
+	assert.Equal(t, "my-group-sub-project", vars["CI_PROJECT_PATH_SLUG"])
+	assert.Equal(t, "Project", vars["CI_PROJECT_NAME"])
+	assert.Equal(t, "My-Group/sub", vars["CI_PROJECT_NAMESPACE"])
+	assert.Equal(t, "My-Group", vars["CI_PROJECT_ROOT_NAMESPACE"])
+	assert.Equal(t, hash.String(), vars["CI_COMMIT_SHA"])
+	assert.Equal(t, hash.String()[:8], vars["CI_COMMIT_SHORT_SHA"])
+	assert.Equal(t, "main", vars["CI_COMMIT_REF_NAME"])
+	assert.Equal(t, "main", vars["CI_COMMIT_BRANCH"])
+	assert.Equal(t, "Add readme", vars["CI_COMMIT_TITLE"])
+	assert.Equal(t, "2024-05-06T07:08:09Z", vars["CI_COMMIT_TIMESTAMP"])
+	assert.NotContains(t, vars, "CI_COMMIT_TAG")
+	assert.NotEmpty(t, vars["CI_PROJECT_DIR"])
+}
+
+func TestSlugify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "simple", input: "main", want: "main"},
+		{name: "slashes and case", input: "Feature/My_Branch", want: "feature-my-branch"},
+		{name: "leading and trailing", input: "/release/", want: "release"},
+		{
+			name:  "long",
+			input: "a-very-long-branch-name-that-goes-on-and-on-and-on-past-the-limit-of-63",
+			want:  "a-very-long-branch-name-that-goes-on-and-on-and-on-past-the-lim",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, slugify(tt.input))
+		})
+	}
+}
+
+func TestSetServerVariables(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		apiURL     string
+		wantURL    string
+		wantPort   string
+		wantAPIURL string
+	}{
+		{
+			name: "default port", apiURL: "https://gitlab.internal/api/v4",
+			wantURL: "https://gitlab.internal", wantPort: "443", wantAPIURL: "https://gitlab.internal/api/v4",
+		},
+		{
+			name: "http with port", apiURL: "http://localhost:8080/api/v4/",
+			wantURL: "http://localhost:8080", wantPort: "8080", wantAPIURL: "http://localhost:8080/api/v4",
+		},
+		{
+			name: "relative url root", apiURL: "https://example.com/gitlab/api/v4",
+			wantURL: "https://example.com/gitlab", wantPort: "443", wantAPIURL: "https://example.com/gitlab/api/v4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			v := NewVariables(&Repo{BaseURL: "gitlab.example.com", Path: "group/project"})
+			v.APIURL = tt.apiURL
+
+			vars := map[string]string{}
+			v.setServerVariables(vars)
+
+			assert.Equal(t, tt.wantURL, vars["CI_SERVER_URL"])
+			assert.Equal(t, tt.wantPort, vars["CI_SERVER_PORT"])
+			assert.Equal(t, tt.wantAPIURL, vars["CI_API_V4_URL"])
+			assert.Equal(t, tt.wantURL+"/group/project", vars["CI_PROJECT_URL"])
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package glen
+
+import (
+	"fmt"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go/v2"
+)
+
+// checkRef decides if protected variables are dropped, which they are unless the
+// simulated ref is a protected branch or tag.
+// https://docs.gitlab.com/ee/ci/variables/#protect-a-cicd-variable
+func (v *Variables) checkRef(glc *gitlab.Client) error {
+	ref, tag, err := v.resolveRef()
+	if err != nil {
+		return err
+	}
+
+	protected, err := isRefProtected(glc, v.Repo.Path, ref, tag)
+	if err != nil {
+		return err
+	}
+
+	v.dropProtected = !protected
+	orDiscard(v.Logger).Debug("simulated ref", "ref", ref, "tag", tag, "protected", protected)
+
+	return nil
+}
+
+// resolveRef returns the ref to simulate, which is Variables.Ref if set and the
+// currently checked out branch or tag otherwise, and whether it is a tag.
+func (v *Variables) resolveRef() (string, bool, error) {
+	if v.Ref != "" {
+		return v.Ref, v.refIsTag(), nil
+	}
+
+	head, err := v.Repo.Head()
+	if err != nil {
+		return "", false, err
+	}
+
+	return head.RefName(), head.Branch == "" && head.Tag != "", nil
+}
+
+// refIsTag reports whether Variables.Ref is a tag: the tag flag of the pipeline
+// if the ref is that of Variables.Pipeline, or else whether the local repo has a
+// tag and no branch of that name.
+func (v *Variables) refIsTag() bool {
+	if v.Pipeline != nil && v.Pipeline.Ref == v.Ref {
+		return v.Pipeline.Tag
+	}
+
+	return v.Repo.IsTag(v.Ref)
+}
+
+// isRefProtected checks if ref matches any of the project's protected tags if it
+// is a tag, or any of its protected branches otherwise. A branch is never
+// protected by a protected tag, and a tag never by a protected branch.
+func isRefProtected(glc *gitlab.Client, project string, ref string, tag bool) (bool, error) {
+	list := listProtectedBranches
+	if tag {
+		list = listProtectedTags
+	}
+
+	patterns, err := list(glc, project)
+	if err != nil {
+		return false, err
+	}
+
+	for _, pattern := range patterns {
+		if MatchProtectedRef(pattern, ref) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// MatchProtectedRef reports whether ref matches the name of a protected branch or
+// tag. GitLab protected ref names may contain '*' wildcards, which match any
+// sequence of characters including '/'.
+func MatchProtectedRef(pattern string, ref string) bool {
+	return matchWildcard(pattern, ref)
+}
+
+// listProtectedBranches returns the names of the protected branches of a project.
+func listProtectedBranches(glc *gitlab.Client, project string) ([]string, error) {
+	opt := &gitlab.ListProtectedBranchesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: pageSize},
+	}
+
+	pbs, err := listAll(func(opts ...gitlab.RequestOptionFunc) ([]*gitlab.ProtectedBranch, *gitlab.Response, error) {
+		return glc.ProtectedBranches.ListProtectedBranches(project, opt, opts...)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get protected branches of project %s: %w", project, err)
+	}
+
+	names := make([]string, 0, len(pbs))
+	for _, pb := range pbs {
+		names = append(names, pb.Name)
+	}
+
+	return names, nil
+}
+
+// listProtectedTags returns the names of the protected tags of a project.
+func listProtectedTags(glc *gitlab.Client, project string) ([]string, error) {
+	opt := &gitlab.ListProtectedTagsOptions{
+		ListOptions: gitlab.ListOptions{PerPage: pageSize},
+	}
+
+	pts, err := listAll(func(opts ...gitlab.RequestOptionFunc) ([]*gitlab.ProtectedTag, *gitlab.Response, error) {
+		return glc.ProtectedTags.ListProtectedTags(project, opt, opts...)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get protected tags of project %s: %w", project, err)
+	}
+
+	names := make([]string, 0, len(pts))
+	for _, pt := range pts {
+		names = append(names, pt.Name)
+	}
+
+	return names, nil
+}
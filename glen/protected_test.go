@@ -0,0 +1,37 @@
+package glen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchProtectedRef(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		pattern string
+		ref     string
+		want    bool
+	}{
+		{name: "exact match", pattern: "main", ref: "main", want: true},
+		{name: "exact mismatch", pattern: "main", ref: "feature", want: false},
+		{name: "prefix wildcard", pattern: "release/*", ref: "release/1.0", want: true},
+		{name: "wildcard crosses slashes", pattern: "release/*", ref: "release/2024/01", want: true},
+		{name: "prefix wildcard mismatch", pattern: "release/*", ref: "feature/release", want: false},
+		{name: "suffix wildcard", pattern: "*-stable", ref: "13-stable", want: true},
+		{name: "middle wildcards", pattern: "v*.*", ref: "v1.2", want: true},
+		{name: "middle wildcards mismatch", pattern: "v*.*", ref: "v12", want: false},
+		{name: "overlapping prefix and suffix", pattern: "a*a", ref: "a", want: false},
+		{name: "only wildcard", pattern: "*", ref: "anything", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, MatchProtectedRef(tt.pattern, tt.ref))
+		})
+	}
+}
@@ -3,6 +3,7 @@ package glen
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 	"path"
 	"strings"
 
@@ -27,6 +28,19 @@ type Repo struct {
 	RemoteURL string
 
 	Groups []string
+
+	// HostAliases maps the host of the remote, such as an SSH alias that differs from
+	// the web host, to the GitLab host that Init sets as BaseURL. Keys may include a
+	// port.
+	HostAliases map[string]string
+	// SSHConfigPath is an OpenSSH client config, such as ~/.ssh/config. If it is set,
+	// Init replaces the host of an SSH remote with its HostName from the config,
+	// unless the host is in HostAliases.
+	SSHConfigPath string
+
+	// Logger receives debug logs of the remote and how it was parsed, with any
+	// credentials in the remote URL removed. Nothing is logged if it is nil.
+	Logger *slog.Logger
 }
 
 // NewRepo creates a new repo struct with defaults that assume you have a remote named
@@ -58,16 +72,34 @@ func (r *Repo) Init() error {
 		return fmt.Errorf("your remote (%s), %s, is not an SSH or HTTP remote: %w", r.RemoteName, remoteURL, err)
 	}
 
-	r.BaseURL = baseURL
+	host, err := r.resolveHost(baseURL, isSSHRemote(remoteURL))
+	if err != nil {
+		return err
+	}
+	if host != baseURL {
+		orDiscard(r.Logger).Debug("resolved host", "host", baseURL, "baseURL", host)
+		httpURL = host + "/" + repoPath
+	}
+
+	r.BaseURL = host
 	r.Path = repoPath
 	r.HTTPURL = httpURL
 
 	// Build the list of parent groups
 	r.Groups = ExtractGroups(repoPath)
 
+	orDiscard(r.Logger).Debug("parsed remote", "remote", r.RemoteName, "url", r.RedactedRemoteURL(),
+		"baseURL", r.BaseURL, "path", r.Path, "groups", r.Groups)
+
 	return nil
 }
 
+// RedactedRemoteURL returns Repo.RemoteURL without any user name or password, which
+// HTTPS remotes may hold a token in.
+func (r *Repo) RedactedRemoteURL() string {
+	return redactRemote(r.RemoteURL)
+}
+
 // ParseRemoteURL parses a git remote URL and extracts GitLab components.
 // It supports HTTPS, HTTP, and SSH URL formats.
 // Returns baseURL (e.g., "gitlab.com"), repoPath (e.g., "group/project"),
@@ -0,0 +1,252 @@
+package glen
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go/v2"
+	"golang.org/x/oauth2"
+)
+
+// Restore actions, recorded in RestoreAction.Action.
+const (
+	RestoreCreate = "create"
+	RestoreUpdate = "update"
+	RestoreSkip   = "skip"
+)
+
+// RestoreAction describes what Restore did, or would do in a dry run, with a
+// single variable from the backup.
+type RestoreAction struct {
+	Kind             string
+	Path             string
+	Key              string
+	EnvironmentScope string
+	Action           string
+	Reason           string
+}
+
+// Restore replays a Backup into a GitLab instance, either into the namespace the
+// backup was taken from or into a different one.
+type Restore struct {
+	Backup  *Backup
+	BaseURL string
+	// APIURL overrides the GitLab API URL, which defaults to https://<BaseURL>/api/v4.
+	APIURL string
+	// Target is the group that replaces Backup.Root in every namespace path.
+	Target string
+	// Keys limits the restore to variables whose key matches one of these globs.
+	Keys   []string
+	DryRun bool
+
+	Actions []RestoreAction
+
+	// TokenSource authenticates with OAuth access tokens instead of the API key when set.
+	TokenSource oauth2.TokenSource
+	// HTTPClient is used to call the API instead of http.DefaultClient if it is set.
+	HTTPClient *http.Client
+
+	apiKey string
+}
+
+// NewRestore returns a Restore that replays b into the same GitLab instance and
+// group it was taken from. Set Restore.BaseURL and Restore.Target to restore
+// somewhere else, and Restore.DryRun=true to only record what would change.
+func NewRestore(b *Backup) *Restore {
+	r := &Restore{}
+
+	r.Backup = b
+	r.BaseURL = b.BaseURL
+	r.Target = b.Root
+	r.DryRun = false
+	r.apiKey = os.Getenv("GITLAB_TOKEN")
+
+	return r
+}
+
+// SetAPIKey takes a GitLab API key and adds it to the Restore struct.
+func (r *Restore) SetAPIKey(key string) {
+	r.apiKey = key
+}
+
+// Init restores every selected variable, creating variables that do not exist and
+// updating those that do. Every decision is recorded in Restore.Actions.
+func (r *Restore) Init() error {
+	glc, err := newClient(clientConfig{
+		baseURL: r.BaseURL, apiURL: r.APIURL, apiKey: r.apiKey, tokenSource: r.TokenSource,
+		httpClient: r.HTTPClient,
+	})
+	if err != nil {
+		return err
+	}
+
+	r.Actions = nil
+
+	for _, ns := range r.Backup.Namespaces {
+		target := mapNamespace(ns.Path, r.Backup.Root, r.Target)
+
+		for _, v := range ns.Variables {
+			if !MatchKey(v.Key, r.Keys) {
+				continue
+			}
+
+			action := RestoreAction{
+				Kind:             ns.Kind,
+				Path:             target,
+				Key:              v.Key,
+				EnvironmentScope: v.EnvironmentScope,
+			}
+
+			err = r.restoreVariable(glc, ns.Kind, target, v, &action)
+			if err != nil {
+				return err
+			}
+			r.Actions = append(r.Actions, action)
+		}
+	}
+
+	return nil
+}
+
+// restoreVariable restores a single variable into the namespace at target.
+func (r *Restore) restoreVariable(glc *gitlab.Client, kind string, target string, v Variable, action *RestoreAction) error {
+	if v.Hidden && v.Value == "" {
+		action.Action = RestoreSkip
+		action.Reason = "hidden variables have no value in the backup"
+
+		return nil
+	}
+
+	exists, err := variableExists(glc, kind, target, v)
+	if err != nil {
+		return err
+	}
+
+	action.Action = RestoreCreate
+	if exists {
+		action.Action = RestoreUpdate
+	}
+
+	if r.DryRun {
+		return nil
+	}
+
+	switch {
+	case kind == SourceGroup && exists:
+		_, _, err = glc.GroupVariables.UpdateVariable(target, v.Key, updateGroupVariableOptions(v))
+	case kind == SourceGroup:
+		_, _, err = glc.GroupVariables.CreateVariable(target, createGroupVariableOptions(v))
+	case exists:
+		_, _, err = glc.ProjectVariables.UpdateVariable(target, v.Key, updateProjectVariableOptions(v))
+	default:
+		_, _, err = glc.ProjectVariables.CreateVariable(target, createProjectVariableOptions(v))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s variable %s in %s %s: %w", action.Action, v.Key, kind, target, err)
+	}
+
+	return nil
+}
+
+// variableExists checks if a variable with the same key and environment scope exists.
+func variableExists(glc *gitlab.Client, kind string, target string, v Variable) (bool, error) {
+	filter := &gitlab.VariableFilter{EnvironmentScope: v.EnvironmentScope}
+
+	var err error
+	if kind == SourceGroup {
+		_, _, err = glc.GroupVariables.GetVariable(target, v.Key, &gitlab.GetGroupVariableOptions{Filter: filter})
+	} else {
+		_, _, err = glc.ProjectVariables.GetVariable(target, v.Key, &gitlab.GetProjectVariableOptions{Filter: filter})
+	}
+
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, gitlab.ErrNotFound):
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to get variable %s from %s %s: %w", v.Key, kind, target, err)
+	}
+}
+
+// mapNamespace moves a namespace path from under root to under target.
+func mapNamespace(nsPath string, root string, target string) string {
+	if target == "" || target == root {
+		return nsPath
+	}
+	if nsPath == root {
+		return target
+	}
+	if strings.HasPrefix(nsPath, root+"/") {
+		return target + strings.TrimPrefix(nsPath, root)
+	}
+
+	return nsPath
+}
+
+func createGroupVariableOptions(v Variable) *gitlab.CreateGroupVariableOptions {
+	opt := &gitlab.CreateGroupVariableOptions{
+		Key:              gitlab.Ptr(v.Key),
+		Value:            gitlab.Ptr(v.Value),
+		Description:      gitlab.Ptr(v.Description),
+		EnvironmentScope: gitlab.Ptr(v.EnvironmentScope),
+		Protected:        gitlab.Ptr(v.Protected),
+		Raw:              gitlab.Ptr(v.Raw),
+		VariableType:     gitlab.Ptr(gitlab.VariableTypeValue(v.VariableType)),
+	}
+	if v.Hidden {
+		opt.MaskedAndHidden = gitlab.Ptr(true)
+	} else {
+		opt.Masked = gitlab.Ptr(v.Masked)
+	}
+
+	return opt
+}
+
+func updateGroupVariableOptions(v Variable) *gitlab.UpdateGroupVariableOptions {
+	return &gitlab.UpdateGroupVariableOptions{
+		Value:            gitlab.Ptr(v.Value),
+		Description:      gitlab.Ptr(v.Description),
+		EnvironmentScope: gitlab.Ptr(v.EnvironmentScope),
+		Filter:           &gitlab.VariableFilter{EnvironmentScope: v.EnvironmentScope},
+		Masked:           gitlab.Ptr(v.Masked),
+		Protected:        gitlab.Ptr(v.Protected),
+		Raw:              gitlab.Ptr(v.Raw),
+		VariableType:     gitlab.Ptr(gitlab.VariableTypeValue(v.VariableType)),
+	}
+}
+
+func createProjectVariableOptions(v Variable) *gitlab.CreateProjectVariableOptions {
+	opt := &gitlab.CreateProjectVariableOptions{
+		Key:              gitlab.Ptr(v.Key),
+		Value:            gitlab.Ptr(v.Value),
+		Description:      gitlab.Ptr(v.Description),
+		EnvironmentScope: gitlab.Ptr(v.EnvironmentScope),
+		Protected:        gitlab.Ptr(v.Protected),
+		Raw:              gitlab.Ptr(v.Raw),
+		VariableType:     gitlab.Ptr(gitlab.VariableTypeValue(v.VariableType)),
+	}
+	if v.Hidden {
+		opt.MaskedAndHidden = gitlab.Ptr(true)
+	} else {
+		opt.Masked = gitlab.Ptr(v.Masked)
+	}
+
+	return opt
+}
+
+func updateProjectVariableOptions(v Variable) *gitlab.UpdateProjectVariableOptions {
+	return &gitlab.UpdateProjectVariableOptions{
+		Value:            gitlab.Ptr(v.Value),
+		Description:      gitlab.Ptr(v.Description),
+		EnvironmentScope: gitlab.Ptr(v.EnvironmentScope),
+		Filter:           &gitlab.VariableFilter{EnvironmentScope: v.EnvironmentScope},
+		Masked:           gitlab.Ptr(v.Masked),
+		Protected:        gitlab.Ptr(v.Protected),
+		Raw:              gitlab.Ptr(v.Raw),
+		VariableType:     gitlab.Ptr(gitlab.VariableTypeValue(v.VariableType)),
+	}
+}
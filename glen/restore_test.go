@@ -0,0 +1,203 @@
+package glen
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/lingrino/glen/glentest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapNamespace(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		path   string
+		root   string
+		target string
+		want   string
+	}{
+		{name: "same target", path: "group/sub", root: "group", target: "group", want: "group/sub"},
+		{name: "empty target", path: "group/sub", root: "group", target: "", want: "group/sub"},
+		{name: "root itself", path: "group", root: "group", target: "other", want: "other"},
+		{name: "nested path", path: "group/sub/project", root: "group", target: "other/copy", want: "other/copy/sub/project"},
+		{name: "similar prefix is not moved", path: "group2/project", root: "group", target: "other", want: "group2/project"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, mapNamespace(tt.path, tt.root, tt.target))
+		})
+	}
+}
+
+// testRestoreBackup returns a backup of a group and one of its projects.
+func testRestoreBackup() *Backup {
+	return &Backup{
+		Version: BackupVersion,
+		BaseURL: "gitlab.example.com",
+		Root:    "group",
+		Namespaces: []Namespace{
+			{Kind: SourceGroup, Path: "group", Variables: []Variable{
+				{Key: "EXISTING", Value: "new", VariableType: "env_var", EnvironmentScope: "*"},
+				{Key: "NEW", Value: "new", VariableType: "env_var", EnvironmentScope: "*"},
+				{Key: "HIDDEN", Hidden: true, Masked: true, VariableType: "env_var", EnvironmentScope: "*"},
+			}},
+			{Kind: SourceProject, Path: "group/project", Variables: []Variable{
+				{Key: "SECRET", Value: "s3cr3t", Masked: true, VariableType: "env_var", EnvironmentScope: "production"},
+			}},
+		},
+	}
+}
+
+// restoredValues backs up root on s and returns the value of every variable by
+// its namespace path, key and environment scope.
+func restoredValues(t *testing.T, s *glentest.Server, root string) map[string]string {
+	t.Helper()
+
+	b := NewBackup("gitlab.example.com", root)
+	b.APIURL = s.URL
+	b.SetAPIKey(s.Token)
+	b.Recurse = true
+	require.NoError(t, b.Init())
+
+	values := make(map[string]string)
+	for _, ns := range b.Namespaces {
+		for _, v := range ns.Variables {
+			values[ns.Path+" "+v.Key+" "+v.EnvironmentScope] = v.Value
+		}
+	}
+
+	return values
+}
+
+// newRestoreServer returns a server with the group and project of
+// testRestoreBackup, and an empty copy of both.
+func newRestoreServer(t *testing.T) *glentest.Server {
+	t.Helper()
+
+	s := glentest.NewServer(t)
+	s.AddGroupVariables("group", glentest.Variable{Key: "EXISTING", Value: "old", EnvironmentScope: "*"})
+	s.AddProjectVariables("group/project", glentest.Variable{Key: "SECRET", Value: "staging", EnvironmentScope: "staging"})
+	s.AddGroupVariables("copy")
+	s.AddProject(glentest.Project{Path: "copy/project"})
+
+	return s
+}
+
+func TestRestoreInit(t *testing.T) {
+	t.Parallel()
+
+	hidden := "hidden variables have no value in the backup"
+
+	tests := []struct {
+		name        string
+		target      string
+		keys        []string
+		dryRun      bool
+		wantActions []RestoreAction
+		wantValues  map[string]string
+	}{
+		{
+			name:   "restore in place",
+			target: "group",
+			wantActions: []RestoreAction{
+				{Kind: SourceGroup, Path: "group", Key: "EXISTING", EnvironmentScope: "*", Action: RestoreUpdate},
+				{Kind: SourceGroup, Path: "group", Key: "NEW", EnvironmentScope: "*", Action: RestoreCreate},
+				{Kind: SourceGroup, Path: "group", Key: "HIDDEN", EnvironmentScope: "*", Action: RestoreSkip, Reason: hidden},
+				{Kind: SourceProject, Path: "group/project", Key: "SECRET", EnvironmentScope: "production", Action: RestoreCreate},
+			},
+			wantValues: map[string]string{
+				"group EXISTING *":                "new",
+				"group NEW *":                     "new",
+				"group/project SECRET staging":    "staging",
+				"group/project SECRET production": "s3cr3t",
+			},
+		},
+		{
+			name:   "dry run",
+			target: "group",
+			dryRun: true,
+			wantActions: []RestoreAction{
+				{Kind: SourceGroup, Path: "group", Key: "EXISTING", EnvironmentScope: "*", Action: RestoreUpdate},
+				{Kind: SourceGroup, Path: "group", Key: "NEW", EnvironmentScope: "*", Action: RestoreCreate},
+				{Kind: SourceGroup, Path: "group", Key: "HIDDEN", EnvironmentScope: "*", Action: RestoreSkip, Reason: hidden},
+				{Kind: SourceProject, Path: "group/project", Key: "SECRET", EnvironmentScope: "production", Action: RestoreCreate},
+			},
+			wantValues: map[string]string{
+				"group EXISTING *":             "old",
+				"group/project SECRET staging": "staging",
+			},
+		},
+		{
+			name:   "key globs",
+			target: "group",
+			keys:   []string{"NEW", "SEC*"},
+			wantActions: []RestoreAction{
+				{Kind: SourceGroup, Path: "group", Key: "NEW", EnvironmentScope: "*", Action: RestoreCreate},
+				{Kind: SourceProject, Path: "group/project", Key: "SECRET", EnvironmentScope: "production", Action: RestoreCreate},
+			},
+			wantValues: map[string]string{
+				"group EXISTING *":                "old",
+				"group NEW *":                     "new",
+				"group/project SECRET staging":    "staging",
+				"group/project SECRET production": "s3cr3t",
+			},
+		},
+		{
+			name:   "other target",
+			target: "copy",
+			wantActions: []RestoreAction{
+				{Kind: SourceGroup, Path: "copy", Key: "EXISTING", EnvironmentScope: "*", Action: RestoreCreate},
+				{Kind: SourceGroup, Path: "copy", Key: "NEW", EnvironmentScope: "*", Action: RestoreCreate},
+				{Kind: SourceGroup, Path: "copy", Key: "HIDDEN", EnvironmentScope: "*", Action: RestoreSkip, Reason: hidden},
+				{Kind: SourceProject, Path: "copy/project", Key: "SECRET", EnvironmentScope: "production", Action: RestoreCreate},
+			},
+			wantValues: map[string]string{
+				"copy EXISTING *":                "new",
+				"copy NEW *":                     "new",
+				"copy/project SECRET production": "s3cr3t",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newRestoreServer(t)
+
+			r := NewRestore(testRestoreBackup())
+			r.APIURL = s.URL
+			r.SetAPIKey(s.Token)
+			r.Target = tt.target
+			r.Keys = tt.keys
+			r.DryRun = tt.dryRun
+
+			require.NoError(t, r.Init())
+			assert.Equal(t, tt.wantActions, r.Actions)
+			assert.Equal(t, tt.wantValues, restoredValues(t, s, tt.target))
+		})
+	}
+}
+
+func TestRestoreInitError(t *testing.T) {
+	t.Parallel()
+
+	s := newRestoreServer(t)
+	s.Fail("/groups/group/variables", http.StatusForbidden)
+
+	r := NewRestore(testRestoreBackup())
+	r.APIURL = s.URL
+	r.SetAPIKey(s.Token)
+
+	// The update of EXISTING succeeds, the creation of NEW fails and stops the restore
+	require.ErrorContains(t, r.Init(), "failed to create variable NEW in group group")
+	assert.Equal(t, []RestoreAction{
+		{Kind: SourceGroup, Path: "group", Key: "EXISTING", EnvironmentScope: "*", Action: RestoreUpdate},
+	}, r.Actions)
+}
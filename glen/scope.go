@@ -0,0 +1,58 @@
+package glen
+
+import (
+	"strings"
+)
+
+// Specificity of an environment scope, used to choose between variables with the
+// same key when more than one of their scopes matches the environment.
+const (
+	scopeAll = iota
+	scopeWildcard
+	scopeExact
+)
+
+// MatchEnvironmentScope reports whether a variable with the environment scope
+// scope is passed to jobs deploying to environment. Scopes may contain '*'
+// wildcards, and the scope '*' matches every environment.
+// https://docs.gitlab.com/ee/ci/environments/#limit-the-environment-scope-of-a-cicd-variable
+func MatchEnvironmentScope(scope string, environment string) bool {
+	return scope == "" || matchWildcard(scope, environment)
+}
+
+// scopeSpecificity returns how specific an environment scope is.
+func scopeSpecificity(scope string) int {
+	switch {
+	case scope == "" || scope == "*":
+		return scopeAll
+	case strings.Contains(scope, "*"):
+		return scopeWildcard
+	default:
+		return scopeExact
+	}
+}
+
+// matchWildcard reports whether s matches pattern, where '*' in pattern matches
+// any sequence of characters including '/'.
+func matchWildcard(pattern string, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
@@ -0,0 +1,53 @@
+package glen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchEnvironmentScope(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		scope       string
+		environment string
+		want        bool
+	}{
+		{name: "all environments", scope: "*", environment: "production", want: true},
+		{name: "empty scope", scope: "", environment: "production", want: true},
+		{name: "exact", scope: "production", environment: "production", want: true},
+		{name: "exact mismatch", scope: "production", environment: "staging", want: false},
+		{name: "wildcard", scope: "review/*", environment: "review/feature-1", want: true},
+		{name: "wildcard mismatch", scope: "review/*", environment: "production", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.want, MatchEnvironmentScope(tt.scope, tt.environment))
+		})
+	}
+}
+
+func TestVariablesSetEnvironment(t *testing.T) {
+	t.Parallel()
+
+	v := NewVariables(NewRepo())
+	v.Environment = "review/feature-1"
+
+	v.set(Variable{Key: "URL", Value: "exact", EnvironmentScope: "review/feature-1", Source: "project:p"})
+	v.set(Variable{Key: "URL", Value: "wildcard", EnvironmentScope: "review/*", Source: "project:p"})
+	v.set(Variable{Key: "URL", Value: "all", EnvironmentScope: "*", Source: "project:p"})
+	v.set(Variable{Key: "DB", Value: "all", EnvironmentScope: "*", Source: "project:p"})
+	v.set(Variable{Key: "DB", Value: "wildcard", EnvironmentScope: "review/*", Source: "project:p"})
+	v.set(Variable{Key: "PROD", Value: "prod", EnvironmentScope: "production", Source: "project:p"})
+
+	assert.Equal(t, map[string]string{"URL": "exact", "DB": "wildcard"}, v.Env)
+
+	// A variable from a source with higher precedence always wins
+	v.set(Variable{Key: "URL", Value: "group", EnvironmentScope: "*", Source: "group:g"})
+	assert.Equal(t, "group", v.Env["URL"])
+}
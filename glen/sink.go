@@ -0,0 +1,123 @@
+package glen
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultMapTemplate is the template of variables that match no MapRule.
+const DefaultMapTemplate = "{project}/{key}"
+
+// SkipTemplate is the template of a MapRule that leaves matching variables out.
+const SkipTemplate = "-"
+
+var (
+	// ErrInvalidMapRule is returned when a mapping rule is not PATTERN=TEMPLATE.
+	ErrInvalidMapRule = errors.New("mapping rule must be PATTERN=TEMPLATE")
+	// ErrInvalidSecretPath is returned when a variable maps to an empty or relative path.
+	ErrInvalidSecretPath = errors.New("invalid secret path")
+	// ErrDuplicateSecretPath is returned when two variables map to the same path.
+	ErrDuplicateSecretPath = errors.New("several variables map to the same secret path")
+)
+
+// Secret is a variable to write to a Sink, at a slash separated Path such as
+// "my-group/my-project/DB_PASSWORD".
+type Secret struct {
+	Path     string
+	Value    string
+	Variable Variable
+}
+
+// Sink is a secret store that variables can be written into. Write creates or
+// replaces the secret at the path of every secret, and leaves the other secrets
+// of the store untouched.
+type Sink interface {
+	Write(secrets []Secret) error
+}
+
+// MapRule maps the keys of variables that match the glob Pattern to a secret
+// path. Template may use the placeholders {key} and {project}, which are replaced
+// with the key of the variable and the path of its GitLab project. A Template of
+// "-" leaves matching variables out.
+type MapRule struct {
+	Pattern  string
+	Template string
+}
+
+// ParseMapRule parses a mapping rule written as PATTERN=TEMPLATE, for example
+// "AWS_*=aws/{key}".
+func ParseMapRule(rule string) (MapRule, error) {
+	pattern, template, ok := strings.Cut(rule, "=")
+	if !ok || pattern == "" || template == "" {
+		return MapRule{}, fmt.Errorf("%w: %q", ErrInvalidMapRule, rule)
+	}
+
+	_, err := path.Match(pattern, "")
+	if err != nil {
+		return MapRule{}, fmt.Errorf("%w: %q: %w", ErrInvalidMapRule, rule, err)
+	}
+
+	return MapRule{Pattern: pattern, Template: template}, nil
+}
+
+// MapSecrets maps the variables of project to secrets with the first rule whose
+// pattern matches each key, or with DefaultMapTemplate if none does. Secrets are
+// sorted by path. Paths are cleaned, and must be relative and unique.
+func MapSecrets(project string, vars map[string]Variable, rules []MapRule) ([]Secret, error) {
+	secrets := make([]Secret, 0, len(vars))
+	keys := make(map[string]string, len(vars))
+
+	names := make([]string, 0, len(vars))
+	for key := range vars {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+
+	for _, key := range names {
+		template := mapTemplate(key, rules)
+		if template == SkipTemplate {
+			continue
+		}
+
+		p := strings.NewReplacer("{key}", key, "{project}", project).Replace(template)
+		p = path.Clean(strings.Trim(p, "/"))
+		if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+			return nil, fmt.Errorf("%w for %s: %q", ErrInvalidSecretPath, key, p)
+		}
+		if other, ok := keys[p]; ok {
+			return nil, fmt.Errorf("%w: %s and %s map to %s", ErrDuplicateSecretPath, other, key, p)
+		}
+		keys[p] = key
+
+		secrets = append(secrets, Secret{Path: p, Value: vars[key].Value, Variable: vars[key]})
+	}
+
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Path < secrets[j].Path
+	})
+
+	return secrets, nil
+}
+
+// mapTemplate returns the template of the first rule whose pattern matches key, or
+// DefaultMapTemplate if none does.
+func mapTemplate(key string, rules []MapRule) string {
+	for _, rule := range rules {
+		ok, err := path.Match(rule.Pattern, key)
+		if err == nil && ok {
+			return rule.Template
+		}
+	}
+
+	return DefaultMapTemplate
+}
+
+// splitSecretPath returns the directory and the last element of a secret path.
+func splitSecretPath(p string) (string, string) {
+	dir, name := path.Split(p)
+
+	return strings.TrimSuffix(dir, "/"), name
+}
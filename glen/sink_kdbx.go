@@ -0,0 +1,184 @@
+package glen
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tobischo/gokeepasslib/v3"
+	w "github.com/tobischo/gokeepasslib/v3/wrappers"
+)
+
+// kdbxRootGroup is the name of the root group of KeePass databases created by KDBXSink.
+const kdbxRootGroup = "glen"
+
+// ErrNoKDBXPassword is returned when writing to a KeePass database without a password.
+var ErrNoKDBXPassword = errors.New("no KeePass database password")
+
+// KDBXSink is a Sink that writes secrets as entries of a KeePass (.kdbx) database.
+// The directories of a secret path are groups under the root group and its last
+// element is the title of the entry, whose password is the value. Entries with the
+// same title in the same group are updated, keeping their other fields. The file
+// is created as a KDBX 4 database if it does not exist.
+type KDBXSink struct {
+	File     string
+	Password string
+}
+
+// NewKDBXSink returns a KDBXSink that writes to the database at file, which
+// assumes you have the password of the database set as GLEN_KDBX_PASSWORD.
+func NewKDBXSink(file string) *KDBXSink {
+	return &KDBXSink{
+		File:     file,
+		Password: os.Getenv("GLEN_KDBX_PASSWORD"),
+	}
+}
+
+// Write implements Sink. The database is replaced atomically.
+func (s *KDBXSink) Write(secrets []Secret) error {
+	if s.Password == "" {
+		return ErrNoKDBXPassword
+	}
+
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+
+	if len(db.Content.Root.Groups) == 0 {
+		group := gokeepasslib.NewGroup()
+		group.Name = kdbxRootGroup
+		db.Content.Root.Groups = []gokeepasslib.Group{group}
+	}
+
+	root := &db.Content.Root.Groups[0]
+	for _, secret := range secrets {
+		dir, title := splitSecretPath(secret.Path)
+
+		group := root
+		if dir != "" {
+			for _, name := range strings.Split(dir, "/") {
+				group = kdbxSubgroup(group, name)
+			}
+		}
+		kdbxUpsertEntry(group, title, secret)
+	}
+
+	return s.save(db)
+}
+
+// open decodes the database, or returns one without groups if the file does not exist.
+func (s *KDBXSink) open() (*gokeepasslib.Database, error) {
+	f, err := os.Open(s.File)
+	if errors.Is(err, os.ErrNotExist) {
+		db := gokeepasslib.NewDatabase(gokeepasslib.WithDatabaseKDBXVersion4())
+		db.Credentials = gokeepasslib.NewPasswordCredentials(s.Password)
+		db.Content.Root.Groups = nil
+
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", s.File, err)
+	}
+	defer f.Close() //nolint:errcheck
+
+	db := gokeepasslib.NewDatabase()
+	db.Credentials = gokeepasslib.NewPasswordCredentials(s.Password)
+
+	err = gokeepasslib.NewDecoder(f).Decode(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.File, err)
+	}
+
+	err = db.UnlockProtectedEntries()
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock %s: %w", s.File, err)
+	}
+
+	return db, nil
+}
+
+// save encodes the database to a temporary file and renames it over the file.
+func (s *KDBXSink) save(db *gokeepasslib.Database) error {
+	// The encoder expects protected values to be locked, as they are after decoding
+	err := db.LockProtectedEntries()
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", s.File, err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.File), ".glen-*.kdbx")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.File, err)
+	}
+	defer os.Remove(f.Name()) //nolint:errcheck
+
+	err = gokeepasslib.NewEncoder(f).Encode(db)
+	if err != nil {
+		f.Close() //nolint:errcheck,gosec
+
+		return fmt.Errorf("failed to write %s: %w", s.File, err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", s.File, err)
+	}
+
+	err = os.Rename(f.Name(), s.File)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", s.File, err)
+	}
+
+	return nil
+}
+
+// kdbxSubgroup returns the child group of parent with name, adding it if needed.
+func kdbxSubgroup(parent *gokeepasslib.Group, name string) *gokeepasslib.Group {
+	for i := range parent.Groups {
+		if parent.Groups[i].Name == name {
+			return &parent.Groups[i]
+		}
+	}
+
+	group := gokeepasslib.NewGroup()
+	group.Name = name
+	parent.Groups = append(parent.Groups, group)
+
+	return &parent.Groups[len(parent.Groups)-1]
+}
+
+// kdbxUpsertEntry sets the password of the entry of group with title to the value
+// of the secret, adding the entry if needed.
+func kdbxUpsertEntry(group *gokeepasslib.Group, title string, secret Secret) {
+	for i := range group.Entries {
+		entry := &group.Entries[i]
+		if entry.GetTitle() != title {
+			continue
+		}
+
+		kdbxSetValue(entry, "Password", secret.Value, true)
+
+		return
+	}
+
+	entry := gokeepasslib.NewEntry()
+	kdbxSetValue(&entry, "Title", title, false)
+	kdbxSetValue(&entry, "Password", secret.Value, true)
+	kdbxSetValue(&entry, "Notes", secret.Variable.Source, false)
+	group.Entries = append(group.Entries, entry)
+}
+
+// kdbxSetValue sets a field of an entry, adding it if needed.
+func kdbxSetValue(entry *gokeepasslib.Entry, key string, value string, protected bool) {
+	v := gokeepasslib.V{Content: value, Protected: w.NewBoolWrapper(protected)}
+
+	i := entry.GetIndex(key)
+	if i < 0 {
+		entry.Values = append(entry.Values, gokeepasslib.ValueData{Key: key, Value: v})
+
+		return
+	}
+	entry.Values[i].Value = v
+}
@@ -0,0 +1,86 @@
+package glen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tobischo/gokeepasslib/v3"
+)
+
+// readKDBX returns the passwords of a KeePass database by the path of their entry.
+func readKDBX(t *testing.T, file string, password string) map[string]string {
+	t.Helper()
+
+	f, err := os.Open(file) //nolint:gosec
+	require.NoError(t, err)
+	defer f.Close() //nolint:errcheck
+
+	db := gokeepasslib.NewDatabase()
+	db.Credentials = gokeepasslib.NewPasswordCredentials(password)
+	require.NoError(t, gokeepasslib.NewDecoder(f).Decode(db))
+	require.NoError(t, db.UnlockProtectedEntries())
+
+	entries := make(map[string]string)
+
+	var walk func(prefix string, g gokeepasslib.Group)
+	walk = func(prefix string, g gokeepasslib.Group) {
+		for _, e := range g.Entries {
+			entries[prefix+e.GetTitle()] = e.GetPassword()
+		}
+		for _, sub := range g.Groups {
+			walk(prefix+sub.Name+"/", sub)
+		}
+	}
+	for _, g := range db.Content.Root.Groups {
+		walk("", g)
+	}
+
+	return entries
+}
+
+func TestKDBXSinkWrite(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "glen.kdbx")
+	sink := &KDBXSink{File: file, Password: "hunter2"}
+
+	require.NoError(t, sink.Write([]Secret{
+		{Path: "g/p/DB_PASS", Value: "one"},
+		{Path: "g/p/TOKEN", Value: "token"},
+		{Path: "TOP", Value: "top"},
+	}))
+	assert.Equal(t, map[string]string{"g/p/DB_PASS": "one", "g/p/TOKEN": "token", "TOP": "top"}, readKDBX(t, file, "hunter2"))
+
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	require.NoError(t, sink.Write([]Secret{
+		{Path: "g/p/DB_PASS", Value: "two"},
+		{Path: "g/q/DB_PASS", Value: "other"},
+	}))
+	assert.Equal(t, map[string]string{
+		"g/p/DB_PASS": "two",
+		"g/p/TOKEN":   "token",
+		"g/q/DB_PASS": "other",
+		"TOP":         "top",
+	}, readKDBX(t, file, "hunter2"))
+}
+
+func TestKDBXSinkWriteErrors(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "glen.kdbx")
+
+	err := (&KDBXSink{File: file}).Write([]Secret{{Path: "A", Value: "a"}})
+	require.ErrorIs(t, err, ErrNoKDBXPassword)
+
+	require.NoError(t, (&KDBXSink{File: file, Password: "right"}).Write([]Secret{{Path: "A", Value: "a"}}))
+
+	err = (&KDBXSink{File: file, Password: "wrong"}).Write([]Secret{{Path: "A", Value: "b"}})
+	require.Error(t, err)
+	assert.Equal(t, map[string]string{"A": "a"}, readKDBX(t, file, "right"))
+}
@@ -0,0 +1,130 @@
+package glen
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoGPGID is returned when a password store has no .gpg-id for a secret.
+var ErrNoGPGID = errors.New("no .gpg-id found in the password store")
+
+// PassSink is a Sink that writes secrets to a pass (https://passwordstore.org)
+// password store. Every secret is encrypted with gpg to <Dir>/<path>.gpg, for the
+// keys listed in the nearest .gpg-id file, like 'pass insert' does. A newline is
+// added to values that do not end with one, so that 'pass show' prints them cleanly.
+type PassSink struct {
+	Dir string
+	// GPG is the gpg binary to encrypt with. Defaults to gpg on the PATH.
+	GPG string
+}
+
+// NewPassSink returns a PassSink that writes to the password store at
+// PASSWORD_STORE_DIR, or ~/.password-store if it is not set.
+func NewPassSink() *PassSink {
+	dir := os.Getenv("PASSWORD_STORE_DIR")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			dir = filepath.Join(home, ".password-store")
+		}
+	}
+
+	return &PassSink{Dir: dir}
+}
+
+// Write implements Sink.
+func (s *PassSink) Write(secrets []Secret) error {
+	for _, secret := range secrets {
+		file := filepath.Join(s.Dir, filepath.FromSlash(secret.Path)+".gpg")
+
+		recipients, err := s.recipients(filepath.Dir(file))
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", secret.Path, err)
+		}
+
+		err = os.MkdirAll(filepath.Dir(file), 0o700) //nolint:mnd
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", secret.Path, err)
+		}
+
+		err = s.encrypt(file, secret.Value, recipients)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", secret.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// recipients returns the keys in the .gpg-id nearest to dir, searching up to the
+// root of the store.
+func (s *PassSink) recipients(dir string) ([]string, error) {
+	root := filepath.Clean(s.Dir)
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, ".gpg-id")) //nolint:gosec
+		if err == nil {
+			var ids []string
+			scanner := bufio.NewScanner(bytes.NewReader(data))
+			for scanner.Scan() {
+				id, _, _ := strings.Cut(scanner.Text(), "#")
+				if id = strings.TrimSpace(id); id != "" {
+					ids = append(ids, id)
+				}
+			}
+			if len(ids) == 0 {
+				return nil, fmt.Errorf("%w: %s is empty", ErrNoGPGID, filepath.Join(dir, ".gpg-id"))
+			}
+
+			return ids, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read .gpg-id: %w", err)
+		}
+
+		if dir == root || filepath.Dir(dir) == dir {
+			return nil, ErrNoGPGID
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// encrypt encrypts value with gpg to file for recipients. The file is readable only
+// by the current user.
+func (s *PassSink) encrypt(file string, value string, recipients []string) error {
+	gpg := s.GPG
+	if gpg == "" {
+		gpg = "gpg"
+	}
+
+	args := []string{"--batch", "--yes", "--quiet", "--compress-algo=none", "--no-encrypt-to", "--output", file, "--encrypt"}
+	for _, r := range recipients {
+		args = append(args, "--recipient", r)
+	}
+
+	if !strings.HasSuffix(value, "\n") {
+		value += "\n"
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(gpg, args...) //nolint:gosec,noctx
+	cmd.Stdin = strings.NewReader(value)
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to encrypt with gpg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	err = os.Chmod(file, 0o600) //nolint:mnd
+	if err != nil {
+		return fmt.Errorf("failed to restrict permissions: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package glen
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGPGHome creates a gpg home with a key for test@glen, and sets GNUPGHOME to it.
+func newGPGHome(t *testing.T) {
+	t.Helper()
+
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+
+	// gpg-agent sockets must fit in a short path, so avoid the long t.TempDir
+	home, err := os.MkdirTemp("", "gpg")
+	require.NoError(t, err)
+	t.Setenv("GNUPGHOME", home)
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--kill", "gpg-agent").Run() //nolint:errcheck,gosec,noctx
+		os.RemoveAll(home)                                   //nolint:errcheck,gosec
+	})
+
+	out, err := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", "test@glen", "default", "default", "never").CombinedOutput() //nolint:noctx
+	require.NoError(t, err, string(out))
+}
+
+// gpgDecrypt returns the decrypted contents of file.
+func gpgDecrypt(t *testing.T, file string) string {
+	t.Helper()
+
+	out, err := exec.Command("gpg", "--batch", "--quiet", "--decrypt", file).Output() //nolint:gosec,noctx
+	require.NoError(t, err)
+
+	return string(out)
+}
+
+func TestPassSinkWrite(t *testing.T) { //nolint:paralleltest // sets GNUPGHOME for gpg
+	newGPGHome(t)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".gpg-id"), []byte("test@glen\n"), 0o600))
+
+	sink := &PassSink{Dir: dir}
+	require.NoError(t, sink.Write([]Secret{
+		{Path: "g/p/DB_PASS", Value: "hunter2"},
+		{Path: "g/p/CERT", Value: "line1\nline2\n"},
+	}))
+
+	assert.Equal(t, "hunter2\n", gpgDecrypt(t, filepath.Join(dir, "g", "p", "DB_PASS.gpg")))
+	assert.Equal(t, "line1\nline2\n", gpgDecrypt(t, filepath.Join(dir, "g", "p", "CERT.gpg")))
+
+	info, err := os.Stat(filepath.Join(dir, "g", "p", "DB_PASS.gpg"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	require.NoError(t, sink.Write([]Secret{{Path: "g/p/DB_PASS", Value: "changed"}}))
+	assert.Equal(t, "changed\n", gpgDecrypt(t, filepath.Join(dir, "g", "p", "DB_PASS.gpg")))
+}
+
+func TestPassSinkRecipients(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "team", "app"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".gpg-id"), []byte("root@glen\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "team", ".gpg-id"), []byte("# the team\na@glen\n\nb@glen # lead\n"), 0o600))
+
+	sink := &PassSink{Dir: dir}
+
+	got, err := sink.recipients(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"root@glen"}, got)
+
+	got, err = sink.recipients(filepath.Join(dir, "team", "app"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a@glen", "b@glen"}, got)
+
+	empty := t.TempDir()
+	_, err = (&PassSink{Dir: empty}).recipients(filepath.Join(empty, "x"))
+	require.ErrorIs(t, err, ErrNoGPGID)
+}
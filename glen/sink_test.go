@@ -0,0 +1,91 @@
+package glen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMapRule(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		rule    string
+		want    MapRule
+		wantErr bool
+	}{
+		{name: "glob", rule: "AWS_*=aws/{key}", want: MapRule{Pattern: "AWS_*", Template: "aws/{key}"}},
+		{name: "skip", rule: "CI_*=-", want: MapRule{Pattern: "CI_*", Template: "-"}},
+		{name: "equals in template", rule: "A=x=y", want: MapRule{Pattern: "A", Template: "x=y"}},
+		{name: "no template", rule: "AWS_*", wantErr: true},
+		{name: "empty template", rule: "AWS_*=", wantErr: true},
+		{name: "empty pattern", rule: "=aws/{key}", wantErr: true},
+		{name: "invalid pattern", rule: "[=aws/{key}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseMapRule(tt.rule)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidMapRule)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMapSecrets(t *testing.T) {
+	t.Parallel()
+
+	vars := map[string]Variable{
+		"AWS_KEY":  {Key: "AWS_KEY", Value: "aws"},
+		"CI_DEBUG": {Key: "CI_DEBUG", Value: "true"},
+		"DB_PASS":  {Key: "DB_PASS", Value: "db"},
+	}
+
+	tests := []struct {
+		name    string
+		rules   []MapRule
+		want    []string
+		wantErr error
+	}{
+		{name: "default", want: []string{"g/p/AWS_KEY", "g/p/CI_DEBUG", "g/p/DB_PASS"}},
+		{
+			name:  "first matching rule wins",
+			rules: []MapRule{{Pattern: "AWS_*", Template: "aws/{key}"}, {Pattern: "*", Template: "all/{key}"}},
+			want:  []string{"all/CI_DEBUG", "all/DB_PASS", "aws/AWS_KEY"},
+		},
+		{name: "skip", rules: []MapRule{{Pattern: "CI_*", Template: "-"}}, want: []string{"g/p/AWS_KEY", "g/p/DB_PASS"}},
+		{name: "clean path", rules: []MapRule{{Pattern: "*", Template: "/{project}//x/../{key}/"}}, want: []string{"g/p/AWS_KEY", "g/p/CI_DEBUG", "g/p/DB_PASS"}},
+		{name: "escape", rules: []MapRule{{Pattern: "*", Template: "../{key}"}}, wantErr: ErrInvalidSecretPath},
+		{name: "duplicate", rules: []MapRule{{Pattern: "*", Template: "same"}}, wantErr: ErrDuplicateSecretPath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			secrets, err := MapSecrets("g/p", vars, tt.rules)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+
+			paths := make([]string, 0, len(secrets))
+			for _, s := range secrets {
+				paths = append(paths, s.Path)
+				assert.Equal(t, vars[s.Variable.Key].Value, s.Value)
+			}
+			assert.Equal(t, tt.want, paths)
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package glen
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// defaultVaultMount is the mount of the KV v2 secrets engine of a Vault dev server.
+const defaultVaultMount = "secret"
+
+var (
+	// ErrNoVaultAddress is returned when writing to Vault without an address.
+	ErrNoVaultAddress = errors.New("no Vault address")
+	// ErrNoVaultToken is returned when writing to Vault without a token.
+	ErrNoVaultToken = errors.New("no Vault token")
+	// ErrVaultRequest is returned when Vault answers a request with an error.
+	ErrVaultRequest = errors.New("vault request failed")
+)
+
+// VaultSink is a Sink that writes secrets to the KV v2 secrets engine of a
+// HashiCorp Vault server. The directories of a secret path are the path of the
+// Vault secret and its last element is the field that holds the value, so that
+// "my-group/my-project/DB_PASSWORD" is the field DB_PASSWORD of the Vault secret
+// my-group/my-project. Other fields of the Vault secret are kept, and each secret
+// is written as one new version with check-and-set, so that concurrent writes are
+// not lost.
+type VaultSink struct {
+	// Address is the URL of the Vault server, such as http://127.0.0.1:8200.
+	Address string
+	Token   string
+	// Mount is the path the KV v2 engine is mounted at. Defaults to "secret".
+	Mount string
+	// Namespace is the Vault Enterprise namespace to write to, if it is set.
+	Namespace string
+	// HTTPClient is used to call Vault instead of http.DefaultClient if it is set.
+	HTTPClient *http.Client
+}
+
+// NewVaultSink returns a VaultSink configured like the Vault CLI, with the
+// VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE environment variables.
+func NewVaultSink() *VaultSink {
+	return &VaultSink{
+		Address:   os.Getenv("VAULT_ADDR"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Mount:     defaultVaultMount,
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+	}
+}
+
+// vaultSecret is the body of KV v2 reads and writes.
+type vaultSecret struct {
+	Data struct {
+		Data     map[string]any `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+// Write implements Sink.
+func (s *VaultSink) Write(secrets []Secret) error {
+	if s.Address == "" {
+		return ErrNoVaultAddress
+	}
+	if s.Token == "" {
+		return ErrNoVaultToken
+	}
+
+	var paths []string
+	fields := make(map[string]map[string]string)
+	for _, secret := range secrets {
+		dir, field := splitSecretPath(secret.Path)
+		if dir == "" {
+			return fmt.Errorf("%w: %s has no Vault secret path before the field", ErrInvalidSecretPath, secret.Path)
+		}
+
+		if _, ok := fields[dir]; !ok {
+			paths = append(paths, dir)
+			fields[dir] = make(map[string]string)
+		}
+		fields[dir][field] = secret.Value
+	}
+
+	for _, p := range paths {
+		err := s.write(p, fields[p])
+		if err != nil {
+			return fmt.Errorf("failed to write %s to Vault: %w", p, err)
+		}
+	}
+
+	return nil
+}
+
+// write adds fields to the Vault secret at p.
+func (s *VaultSink) write(p string, fields map[string]string) error {
+	current, err := s.read(p)
+	if err != nil {
+		return err
+	}
+
+	data := current.Data.Data
+	if data == nil {
+		data = make(map[string]any, len(fields))
+	}
+	for k, v := range fields {
+		data[k] = v
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"options": map[string]int{"cas": current.Data.Metadata.Version},
+		"data":    data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode secret: %w", err)
+	}
+
+	_, err = s.do(http.MethodPost, p, body)
+
+	return err
+}
+
+// read returns the latest version of the Vault secret at p. Secrets that do not
+// exist, or whose latest version is deleted, have no data.
+func (s *VaultSink) read(p string) (*vaultSecret, error) {
+	body, err := s.do(http.MethodGet, p, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &vaultSecret{}
+	if len(body) == 0 {
+		return secret, nil
+	}
+
+	err = json.Unmarshal(body, secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode secret: %w", err)
+	}
+
+	return secret, nil
+}
+
+// do calls the KV v2 data endpoint of p. A 404 response returns its body without
+// an error, because Vault answers reads of missing and deleted secrets with 404.
+func (s *VaultSink) do(method string, p string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, s.url(p), bytes.NewReader(body)) //nolint:noctx
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+	if s.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call Vault: %w", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && method == http.MethodGet:
+		return respBody, nil
+	case resp.StatusCode >= http.StatusBadRequest:
+		return nil, fmt.Errorf("%w: %s %s: %s", ErrVaultRequest, method, resp.Status, vaultErrors(respBody))
+	}
+
+	return respBody, nil
+}
+
+// url returns the URL of the KV v2 data endpoint of p.
+func (s *VaultSink) url(p string) string {
+	mount := s.Mount
+	if mount == "" {
+		mount = defaultVaultMount
+	}
+
+	return strings.TrimSuffix(s.Address, "/") + "/v1/" + strings.Trim(mount, "/") + "/data/" + p
+}
+
+// vaultErrors returns the errors in a Vault error response.
+func vaultErrors(body []byte) string {
+	var resp struct {
+		Errors []string `json:"errors"`
+	}
+
+	err := json.Unmarshal(body, &resp)
+	if err != nil || len(resp.Errors) == 0 {
+		return strings.TrimSpace(string(body))
+	}
+
+	return strings.Join(resp.Errors, "; ")
+}
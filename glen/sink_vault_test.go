@@ -0,0 +1,140 @@
+package glen
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVault is a KV v2 secrets engine mounted at /v1/kv/ that enforces check-and-set.
+type fakeVault struct {
+	mu       sync.Mutex
+	secrets  map[string]map[string]any
+	versions map[string]int
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	t.Helper()
+
+	v := &fakeVault{secrets: make(map[string]map[string]any), versions: make(map[string]int)}
+	server := httptest.NewServer(v)
+	t.Cleanup(server.Close)
+
+	return v, server
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if r.Header.Get("X-Vault-Token") != "root" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors":["permission denied"]}`)) //nolint:errcheck,gosec
+
+		return
+	}
+
+	p, ok := strings.CutPrefix(r.URL.Path, "/v1/kv/data/")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":["no handler for route"]}`)) //nolint:errcheck,gosec
+
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		data, ok := v.secrets[p]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`)) //nolint:errcheck,gosec
+
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{ //nolint:errcheck,gosec
+			"data": map[string]any{"data": data, "metadata": map[string]any{"version": v.versions[p]}},
+		})
+
+		return
+	}
+
+	var body struct {
+		Options struct {
+			CAS int `json:"cas"`
+		} `json:"options"`
+		Data map[string]any `json:"data"`
+	}
+	if json.NewDecoder(r.Body).Decode(&body) != nil || body.Options.CAS != v.versions[p] {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errors":["check-and-set parameter did not match the current version"]}`)) //nolint:errcheck,gosec
+
+		return
+	}
+	v.secrets[p] = body.Data
+	v.versions[p]++
+	w.Write([]byte(`{"data":{"version":1}}`)) //nolint:errcheck,gosec
+}
+
+func TestVaultSinkWrite(t *testing.T) {
+	t.Parallel()
+
+	vault, server := newFakeVault(t)
+	vault.secrets["g/p"] = map[string]any{"KEEP": "kept", "PORT": float64(5432)}
+	vault.versions["g/p"] = 3
+
+	sink := &VaultSink{Address: server.URL + "/", Token: "root", Mount: "/kv/"}
+	require.NoError(t, sink.Write([]Secret{
+		{Path: "g/p/DB_PASS", Value: "hunter2"},
+		{Path: "g/p/TOKEN", Value: "token"},
+		{Path: "g/q/DB_PASS", Value: "other"},
+	}))
+
+	assert.Equal(t, map[string]any{"KEEP": "kept", "PORT": float64(5432), "DB_PASS": "hunter2", "TOKEN": "token"}, vault.secrets["g/p"])
+	assert.Equal(t, 4, vault.versions["g/p"])
+	assert.Equal(t, map[string]any{"DB_PASS": "other"}, vault.secrets["g/q"])
+	assert.Equal(t, 1, vault.versions["g/q"])
+}
+
+func TestVaultSinkWriteErrors(t *testing.T) {
+	t.Parallel()
+
+	_, server := newFakeVault(t)
+
+	tests := []struct {
+		name    string
+		sink    *VaultSink
+		secrets []Secret
+		wantErr error
+		message string
+	}{
+		{name: "no address", sink: &VaultSink{Token: "root"}, wantErr: ErrNoVaultAddress},
+		{name: "no token", sink: &VaultSink{Address: server.URL}, wantErr: ErrNoVaultToken},
+		{
+			name: "no secret path", sink: &VaultSink{Address: server.URL, Token: "root", Mount: "kv"},
+			secrets: []Secret{{Path: "DB_PASS"}}, wantErr: ErrInvalidSecretPath,
+		},
+		{
+			name: "permission denied", sink: &VaultSink{Address: server.URL, Token: "wrong", Mount: "kv"},
+			secrets: []Secret{{Path: "g/p/DB_PASS"}}, wantErr: ErrVaultRequest, message: "permission denied",
+		},
+		{
+			name: "wrong mount", sink: &VaultSink{Address: server.URL, Token: "root", Mount: "secret"},
+			secrets: []Secret{{Path: "g/p/DB_PASS"}}, wantErr: ErrVaultRequest, message: "no handler for route",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.sink.Write(tt.secrets)
+			require.ErrorIs(t, err, tt.wantErr)
+			assert.Contains(t, err.Error(), tt.message)
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package glen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// SnapshotVersion is the version of the format written by Snapshot.WriteAge.
+// ReadSnapshot refuses snapshots written with a newer version.
+const SnapshotVersion = 1
+
+var (
+	// ErrUnsupportedSnapshotVersion is returned when reading a snapshot written by a newer glen.
+	ErrUnsupportedSnapshotVersion = errors.New("unsupported snapshot version")
+	// ErrNoRecipients is returned when encrypting a snapshot without any recipients.
+	ErrNoRecipients = errors.New("no recipients to encrypt to")
+	// ErrNoIdentities is returned when decrypting a snapshot without any identities.
+	ErrNoIdentities = errors.New("no identities to decrypt with")
+	// ErrUnknownSnapshotFormat is returned when reading a file that is not a snapshot.
+	ErrUnknownSnapshotFormat = errors.New("not an age encrypted or SOPS file")
+)
+
+// Snapshot is a point in time copy of the variables of one or more projects, to
+// hand to someone that cannot reach GitLab. Snapshots are only ever written
+// encrypted, either as a single age encrypted file with full metadata or as a
+// SOPS file that holds keys and values.
+type Snapshot struct {
+	Version   int               `json:"version"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Projects  []SnapshotProject `json:"projects"`
+}
+
+// SnapshotProject holds the variables of a project, sorted by key. Project is
+// empty when it is not known, such as when the variables of several projects were
+// merged.
+type SnapshotProject struct {
+	Project   string     `json:"project"`
+	Variables []Variable `json:"variables"`
+}
+
+// NewSnapshot returns an empty Snapshot created now.
+func NewSnapshot() *Snapshot {
+	return &Snapshot{
+		Version:   SnapshotVersion,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// Add adds the variables of project to the snapshot.
+func (s *Snapshot) Add(project string, vars map[string]Variable) {
+	s.Projects = append(s.Projects, SnapshotProject{Project: project, Variables: SortVariables(vars, SortByKey)})
+}
+
+// Vars returns the variables of every project, keyed by name. Later projects
+// override earlier ones.
+func (s *Snapshot) Vars() map[string]Variable {
+	vars := make(map[string]Variable)
+	for _, p := range s.Projects {
+		for _, v := range p.Variables {
+			vars[v.Key] = v
+		}
+	}
+
+	return vars
+}
+
+// WriteAge writes the snapshot as JSON to w, encrypted with age to the
+// recipients and armored so that it can be pasted as text.
+func (s *Snapshot) WriteAge(w io.Writer, recipients ...age.Recipient) error {
+	if len(recipients) == 0 {
+		return ErrNoRecipients
+	}
+
+	aw := armor.NewWriter(w)
+
+	ew, err := age.Encrypt(aw, recipients...)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt snapshot: %w", err)
+	}
+
+	enc := json.NewEncoder(ew)
+	enc.SetIndent("", "  ")
+
+	err = enc.Encode(s)
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	err = ew.Close()
+	if err != nil {
+		return fmt.Errorf("failed to encrypt snapshot: %w", err)
+	}
+
+	err = aw.Close()
+	if err != nil {
+		return fmt.Errorf("failed to encrypt snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// ReadSnapshot reads a snapshot written by WriteAge, armored or not, or by
+// WriteSOPS, and decrypts it with the identities. SOPS files that were written by
+// sops itself can be read too, as long as their data key is encrypted with age and
+// they hold no more than a level of nesting. Variables read from SOPS files only
+// have a key and a value.
+func ReadSnapshot(r io.Reader, identities ...age.Identity) (*Snapshot, error) {
+	if len(identities) == 0 {
+		return nil, ErrNoIdentities
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte(armor.Header)):
+		return readAgeSnapshot(armor.NewReader(bytes.NewReader(trimmed)), identities)
+	case bytes.HasPrefix(data, []byte(ageHeader)):
+		return readAgeSnapshot(bytes.NewReader(data), identities)
+	case isSOPSDotenv(data):
+		return readSOPS(data, SOPSDotenv, identities)
+	case isSOPSYAML(data):
+		return readSOPS(data, SOPSYAML, identities)
+	default:
+		return nil, ErrUnknownSnapshotFormat
+	}
+}
+
+// readAgeSnapshot decrypts and parses a snapshot written by WriteAge.
+func readAgeSnapshot(r io.Reader, identities []age.Identity) (*Snapshot, error) {
+	src, err := age.Decrypt(r, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt snapshot: %w", err)
+	}
+
+	s := &Snapshot{}
+	err = json.NewDecoder(bufio.NewReader(src)).Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot: %w", err)
+	}
+
+	if s.Version < 1 || s.Version > SnapshotVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedSnapshotVersion, s.Version)
+	}
+
+	return s, nil
+}
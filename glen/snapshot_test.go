@@ -0,0 +1,81 @@
+package glen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSnapshot() *Snapshot {
+	s := NewSnapshot()
+	s.Add("group/project", map[string]Variable{
+		"DB_PASS": {Value: "s3cr3t", Masked: true, Source: "project:group/project"},
+		"CERT":    {Value: "line1\nline2", VariableType: "file"},
+		"EMPTY":   {Value: ""},
+	})
+
+	return s
+}
+
+func TestSnapshotAdd(t *testing.T) {
+	t.Parallel()
+
+	s := testSnapshot()
+	s.Add("group/other", map[string]Variable{"DB_PASS": {Value: "other"}})
+
+	require.Len(t, s.Projects, 2)
+	keys := make([]string, 0, len(s.Projects[0].Variables))
+	for _, v := range s.Projects[0].Variables {
+		keys = append(keys, v.Key)
+	}
+	assert.Equal(t, []string{"CERT", "DB_PASS", "EMPTY"}, keys)
+	assert.Equal(t, "other", s.Vars()["DB_PASS"].Value)
+	assert.Equal(t, "line1\nline2", s.Vars()["CERT"].Value)
+}
+
+func TestSnapshotAgeRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+
+	s := testSnapshot()
+
+	var buf bytes.Buffer
+	require.NoError(t, s.WriteAge(&buf, identity.Recipient()))
+	assert.NotContains(t, buf.String(), "s3cr3t")
+	assert.True(t, strings.HasPrefix(buf.String(), "-----BEGIN AGE ENCRYPTED FILE-----"))
+
+	got, err := ReadSnapshot(bytes.NewReader(buf.Bytes()), identity)
+	require.NoError(t, err)
+	assert.Equal(t, s.Projects, got.Projects)
+	assert.Equal(t, s.CreatedAt, got.CreatedAt)
+
+	other, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	_, err = ReadSnapshot(bytes.NewReader(buf.Bytes()), other)
+	require.Error(t, err)
+}
+
+func TestSnapshotWriteAgeNoRecipients(t *testing.T) {
+	t.Parallel()
+
+	require.ErrorIs(t, testSnapshot().WriteAge(&bytes.Buffer{}), ErrNoRecipients)
+}
+
+func TestReadSnapshotErrors(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+
+	_, err = ReadSnapshot(strings.NewReader("export A=1\n"), identity)
+	require.ErrorIs(t, err, ErrUnknownSnapshotFormat)
+
+	_, err = ReadSnapshot(strings.NewReader("export A=1\n"))
+	require.ErrorIs(t, err, ErrNoIdentities)
+}
@@ -0,0 +1,671 @@
+package glen
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+// SOPSFormat is the file format of a SOPS file.
+type SOPSFormat string
+
+// SOPS file formats.
+const (
+	SOPSYAML   SOPSFormat = "yaml"
+	SOPSDotenv SOPSFormat = "dotenv"
+)
+
+const (
+	// sopsVersion is the version of sops whose file format WriteSOPS writes.
+	sopsVersion = "3.9.0"
+	// sopsUnencryptedSuffix marks keys whose values sops leaves unencrypted.
+	sopsUnencryptedSuffix = "_unencrypted"
+	// sopsMetadataKey is the key of the metadata in SOPS files.
+	sopsMetadataKey = "sops"
+	// sopsDotenvPrefix is the prefix of the flattened metadata keys of SOPS dotenv files.
+	sopsDotenvPrefix = sopsMetadataKey + "_"
+	// sopsKeySize is the size of the AES-256 data key of a SOPS file.
+	sopsKeySize = 32
+	// sopsNonceSize is the size of the AES-GCM nonces that sops uses.
+	sopsNonceSize = 32
+	// sopsYAMLIndent is the indentation of the YAML that sops writes.
+	sopsYAMLIndent = 4
+)
+
+// The types that sops records for encrypted values.
+const (
+	sopsTypeString = "str"
+	sopsTypeInt    = "int"
+	sopsTypeFloat  = "float"
+	sopsTypeBool   = "bool"
+)
+
+var (
+	// ErrSOPSMAC is returned when the MAC of a SOPS file does not match its values.
+	ErrSOPSMAC = errors.New("SOPS file MAC does not match, the file was modified")
+	// ErrSOPSDataKey is returned when none of the identities can decrypt a SOPS file.
+	ErrSOPSDataKey = errors.New("no identity can decrypt the SOPS data key")
+	// ErrSOPSDotenvProjects is returned when writing several projects to a SOPS dotenv file.
+	ErrSOPSDotenvProjects = errors.New("SOPS dotenv files can only hold the variables of one project")
+	// ErrInvalidSOPSFile is returned when a SOPS file cannot be parsed.
+	ErrInvalidSOPSFile = errors.New("invalid SOPS file")
+)
+
+var (
+	// sopsValueRegexp matches a value encrypted by sops.
+	sopsValueRegexp = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.*),iv:(.+),tag:(.+),type:(.+)\]$`)
+	// sopsYAMLRegexp matches the metadata key of a SOPS YAML file.
+	sopsYAMLRegexp = regexp.MustCompile(`(?m)^` + sopsMetadataKey + `:\s*$`)
+	// sopsDotenvRegexp matches the MAC of a SOPS dotenv file.
+	sopsDotenvRegexp = regexp.MustCompile(`(?m)^` + sopsDotenvPrefix + `mac=`)
+	// sopsDotenvAgeKey matches the flattened keys of the age keys of a SOPS dotenv file.
+	sopsDotenvAgeKey = regexp.MustCompile(`^` + sopsDotenvPrefix + `age__list_(\d+)__map_(recipient|enc)$`)
+)
+
+// sopsItem is a value of a SOPS file at a path of keys, with the sops type of an
+// unencrypted value.
+type sopsItem struct {
+	path     []string
+	value    string
+	datatype string
+}
+
+// sopsAgeKey is the data key of a SOPS file, encrypted with age to a recipient.
+type sopsAgeKey struct {
+	Recipient string `yaml:"recipient"`
+	Enc       string `yaml:"enc"`
+}
+
+// sopsMetadata is the metadata of a SOPS file that glen reads and writes.
+type sopsMetadata struct {
+	Age               []sopsAgeKey `yaml:"age"`
+	LastModified      string       `yaml:"lastmodified"`
+	MAC               string       `yaml:"mac"`
+	UnencryptedSuffix string       `yaml:"unencrypted_suffix"` //nolint:tagliatelle
+	Version           string       `yaml:"version"`
+}
+
+// WriteSOPS writes the snapshot to w as a SOPS file in format, which sops can
+// decrypt with the age identities of the recipients. The values of a single
+// project are written at the top level, and those of several projects under the
+// path of each project, which dotenv files cannot hold. Like in sops, values whose
+// key ends with "_unencrypted" are not encrypted.
+func (s *Snapshot) WriteSOPS(w io.Writer, format SOPSFormat, recipients ...*age.X25519Recipient) error {
+	if len(recipients) == 0 {
+		return ErrNoRecipients
+	}
+
+	items := s.sopsItems()
+	if format == SOPSDotenv && len(s.Projects) > 1 {
+		return ErrSOPSDotenvProjects
+	}
+
+	key := make([]byte, sopsKeySize)
+	_, err := rand.Read(key)
+	if err != nil {
+		return fmt.Errorf("failed to generate SOPS data key: %w", err)
+	}
+
+	meta := sopsMetadata{
+		LastModified:      s.CreatedAt.UTC().Format(time.RFC3339),
+		UnencryptedSuffix: sopsUnencryptedSuffix,
+		Version:           sopsVersion,
+	}
+
+	meta.MAC, err = sopsEncryptItems(items, key, meta.LastModified)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range recipients {
+		enc, err := sopsEncryptKey(key, r)
+		if err != nil {
+			return err
+		}
+		meta.Age = append(meta.Age, sopsAgeKey{Recipient: r.String(), Enc: enc})
+	}
+
+	if format == SOPSDotenv {
+		return writeSOPSDotenv(w, items, meta)
+	}
+
+	return writeSOPSYAML(w, items, meta)
+}
+
+// sopsItems returns the values of the snapshot, at the top level for a single
+// project and under the path of each project otherwise.
+func (s *Snapshot) sopsItems() []sopsItem {
+	var items []sopsItem
+	for _, p := range s.Projects {
+		for _, v := range p.Variables {
+			path := []string{v.Key}
+			if len(s.Projects) > 1 {
+				path = []string{p.Project, v.Key}
+			}
+			items = append(items, sopsItem{path: path, value: v.Value, datatype: sopsTypeString})
+		}
+	}
+
+	return items
+}
+
+// sopsEncryptItems encrypts the values of items in place, and returns the MAC of
+// their plain values encrypted with lastModified, like sops.
+func sopsEncryptItems(items []sopsItem, key []byte, lastModified string) (string, error) {
+	hash := sha512.New()
+	for i, item := range items {
+		hash.Write([]byte(item.value))
+		if !sopsEncrypted(item.path) {
+			continue
+		}
+
+		var err error
+
+		items[i].value, err = sopsEncrypt(item.value, key, sopsAAD(item.path))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return sopsEncrypt(fmt.Sprintf("%X", hash.Sum(nil)), key, lastModified)
+}
+
+// sopsDecryptItems decrypts the values of items in place, and returns the MAC of
+// their plain values, like sops.
+func sopsDecryptItems(items []sopsItem, key []byte) (string, error) {
+	hash := sha512.New()
+	for i, item := range items {
+		if sopsEncrypted(item.path) {
+			var err error
+
+			items[i].value, items[i].datatype, err = sopsDecrypt(item.value, key, sopsAAD(item.path))
+			if err != nil {
+				return "", err
+			}
+		}
+		hash.Write(sopsMACBytes(items[i].value, items[i].datatype))
+
+		// sops encrypts booleans as True and False, but writes them as YAML booleans
+		if b, err := strconv.ParseBool(items[i].value); err == nil && items[i].datatype == sopsTypeBool {
+			items[i].value = strconv.FormatBool(b)
+		}
+	}
+
+	return fmt.Sprintf("%X", hash.Sum(nil)), nil
+}
+
+// sopsEncrypted reports whether sops encrypts the value at path.
+func sopsEncrypted(path []string) bool {
+	for _, key := range path {
+		if strings.HasSuffix(key, sopsUnencryptedSuffix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sopsAAD returns the additional data that the value at path is encrypted with.
+func sopsAAD(path []string) string {
+	return strings.Join(path, ":") + ":"
+}
+
+// sopsEncrypt encrypts a string value like sops, with AES-GCM and a 32 byte
+// nonce. Empty values are not encrypted.
+func sopsEncrypt(value string, key []byte, aad string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	gcm, err := sopsCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, sopsNonceSize)
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := gcm.Seal(nil, nonce, []byte(value), []byte(aad))
+	data, tag := out[:len(out)-gcm.Overhead()], out[len(out)-gcm.Overhead():]
+
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:str]",
+		base64.StdEncoding.EncodeToString(data),
+		base64.StdEncoding.EncodeToString(nonce),
+		base64.StdEncoding.EncodeToString(tag)), nil
+}
+
+// sopsDecrypt decrypts a value encrypted by sops, returning its text and its sops type.
+func sopsDecrypt(value string, key []byte, aad string) (string, string, error) {
+	if value == "" {
+		return "", sopsTypeString, nil
+	}
+
+	m := sopsValueRegexp.FindStringSubmatch(value)
+	if m == nil {
+		return "", "", fmt.Errorf("%w: value at %s is not encrypted", ErrInvalidSOPSFile, strings.TrimSuffix(aad, ":"))
+	}
+
+	parts := make([][]byte, 3) //nolint:mnd
+	for i := range parts {
+		var err error
+
+		parts[i], err = base64.StdEncoding.DecodeString(m[i+1])
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %w", ErrInvalidSOPSFile, err)
+		}
+	}
+
+	gcm, err := sopsCipher(key)
+	if err != nil {
+		return "", "", err
+	}
+	if len(parts[1]) != gcm.NonceSize() {
+		return "", "", fmt.Errorf("%w: nonce at %s is not %d bytes", ErrInvalidSOPSFile, strings.TrimSuffix(aad, ":"), sopsNonceSize)
+	}
+
+	plain, err := gcm.Open(nil, parts[1], append(parts[0], parts[2]...), []byte(aad))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decrypt value at %s: %w", strings.TrimSuffix(aad, ":"), err)
+	}
+
+	return string(plain), m[4], nil
+}
+
+// sopsCipher returns the AES-GCM cipher of a SOPS data key.
+func sopsCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCMWithNonceSize(block, sopsNonceSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return gcm, nil
+}
+
+// sopsMACBytes returns the bytes that sops adds to the MAC for a value of datatype,
+// which for numbers and booleans is how sops formats the parsed value.
+func sopsMACBytes(value string, datatype string) []byte {
+	switch datatype {
+	case sopsTypeInt:
+		if i, err := strconv.Atoi(value); err == nil {
+			return []byte(strconv.Itoa(i))
+		}
+	case sopsTypeFloat:
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return []byte(strconv.FormatFloat(f, 'f', -1, 64))
+		}
+	case sopsTypeBool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			if b {
+				return []byte("True")
+			}
+
+			return []byte("False")
+		}
+	}
+
+	return []byte(value)
+}
+
+// sopsEncryptKey encrypts the data key of a SOPS file to an age recipient, armored.
+func sopsEncryptKey(key []byte, recipient age.Recipient) (string, error) {
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+
+	w, err := age.Encrypt(aw, recipient)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt SOPS data key: %w", err)
+	}
+
+	_, err = w.Write(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt SOPS data key: %w", err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt SOPS data key: %w", err)
+	}
+
+	err = aw.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt SOPS data key: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// dataKey decrypts the data key of a SOPS file with the first identity that can.
+func (m sopsMetadata) dataKey(identities []age.Identity) ([]byte, error) {
+	for _, k := range m.Age {
+		r, err := age.Decrypt(armor.NewReader(strings.NewReader(strings.TrimSpace(k.Enc))), identities...)
+		if err != nil {
+			continue
+		}
+
+		key, err := io.ReadAll(r)
+		if err != nil || len(key) != sopsKeySize {
+			continue
+		}
+
+		return key, nil
+	}
+
+	return nil, ErrSOPSDataKey
+}
+
+// readSOPS parses and decrypts a SOPS file and checks its MAC.
+func readSOPS(data []byte, format SOPSFormat, identities []age.Identity) (*Snapshot, error) {
+	parse := parseSOPSYAML
+	if format == SOPSDotenv {
+		parse = parseSOPSDotenv
+	}
+
+	items, meta, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := meta.dataKey(identities)
+	if err != nil {
+		return nil, err
+	}
+
+	sum, err := sopsDecryptItems(items, key)
+	if err != nil {
+		return nil, err
+	}
+
+	mac, _, err := sopsDecrypt(meta.MAC, key, meta.LastModified)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt MAC: %w", err)
+	}
+	if mac != sum {
+		return nil, ErrSOPSMAC
+	}
+
+	return snapshotFromSOPS(items, meta), nil
+}
+
+// snapshotFromSOPS returns the decrypted values of a SOPS file as a snapshot, with
+// a project for every top level key that holds values.
+func snapshotFromSOPS(items []sopsItem, meta sopsMetadata) *Snapshot {
+	s := &Snapshot{Version: SnapshotVersion}
+	createdAt, err := time.Parse(time.RFC3339, meta.LastModified)
+	if err == nil {
+		s.CreatedAt = createdAt
+	}
+
+	index := make(map[string]int)
+	for _, item := range items {
+		project, key := "", item.path[0]
+		if len(item.path) > 1 {
+			project, key = item.path[0], item.path[1]
+		}
+
+		i, ok := index[project]
+		if !ok {
+			i = len(s.Projects)
+			index[project] = i
+			s.Projects = append(s.Projects, SnapshotProject{Project: project})
+		}
+		s.Projects[i].Variables = append(s.Projects[i].Variables, Variable{Key: key, Value: item.value})
+	}
+
+	return s
+}
+
+// isSOPSYAML reports whether data looks like a SOPS YAML file.
+func isSOPSYAML(data []byte) bool {
+	return sopsYAMLRegexp.Match(data)
+}
+
+// isSOPSDotenv reports whether data looks like a SOPS dotenv file.
+func isSOPSDotenv(data []byte) bool {
+	return sopsDotenvRegexp.Match(data)
+}
+
+// writeSOPSYAML writes the values and metadata of a SOPS file as YAML.
+func writeSOPSYAML(w io.Writer, items []sopsItem, meta sopsMetadata) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := make(map[string]*yaml.Node)
+
+	for _, item := range items {
+		parent := root
+		if len(item.path) > 1 {
+			section, ok := sections[item.path[0]]
+			if !ok {
+				section = &yaml.Node{Kind: yaml.MappingNode}
+				sections[item.path[0]] = section
+				root.Content = append(root.Content, yamlString(item.path[0]), section)
+			}
+			parent = section
+		}
+		parent.Content = append(parent.Content, yamlString(item.path[len(item.path)-1]), yamlString(item.value))
+	}
+
+	keys := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, k := range meta.Age {
+		enc := yamlString(k.Enc)
+		enc.Style = yaml.LiteralStyle
+		keys.Content = append(keys.Content, &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			yamlString("recipient"), yamlString(k.Recipient),
+			yamlString("enc"), enc,
+		}})
+	}
+
+	lastModified := yamlString(meta.LastModified)
+	lastModified.Style = yaml.DoubleQuotedStyle
+
+	root.Content = append(root.Content, yamlString(sopsMetadataKey), &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		yamlString("age"), keys,
+		yamlString("lastmodified"), lastModified,
+		yamlString("mac"), yamlString(meta.MAC),
+		yamlString("unencrypted_suffix"), yamlString(meta.UnencryptedSuffix),
+		yamlString("version"), yamlString(meta.Version),
+	}})
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(sopsYAMLIndent)
+
+	err := enc.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}})
+	if err != nil {
+		return fmt.Errorf("failed to write SOPS file: %w", err)
+	}
+
+	err = enc.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write SOPS file: %w", err)
+	}
+
+	return nil
+}
+
+// yamlString returns a YAML string scalar.
+func yamlString(s string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s}
+}
+
+// parseSOPSYAML parses the values and metadata of a SOPS YAML file, in the order
+// of the file. Values may be nested under a single level of keys.
+func parseSOPSYAML(data []byte) ([]sopsItem, sopsMetadata, error) {
+	var doc yaml.Node
+
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, sopsMetadata{}, fmt.Errorf("%w: %w", ErrInvalidSOPSFile, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, sopsMetadata{}, fmt.Errorf("%w: not a mapping", ErrInvalidSOPSFile)
+	}
+
+	var (
+		items []sopsItem
+		meta  sopsMetadata
+	)
+
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i].Value, root.Content[i+1]
+		switch {
+		case key == sopsMetadataKey:
+			err = value.Decode(&meta)
+			if err != nil {
+				return nil, sopsMetadata{}, fmt.Errorf("%w: %w", ErrInvalidSOPSFile, err)
+			}
+		case value.Kind == yaml.ScalarNode:
+			items = append(items, sopsItem{path: []string{key}, value: value.Value, datatype: yamlType(value)})
+		case value.Kind == yaml.MappingNode:
+			items, err = appendSOPSYAMLSection(items, key, value)
+			if err != nil {
+				return nil, sopsMetadata{}, err
+			}
+		default:
+			return nil, sopsMetadata{}, fmt.Errorf("%w: %s is not a value or a mapping", ErrInvalidSOPSFile, key)
+		}
+	}
+
+	return items, meta, nil
+}
+
+// appendSOPSYAMLSection appends the values of the mapping at key to items.
+func appendSOPSYAMLSection(items []sopsItem, key string, mapping *yaml.Node) ([]sopsItem, error) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		value := mapping.Content[i+1]
+		if value.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("%w: %s is nested too deep", ErrInvalidSOPSFile, key)
+		}
+		items = append(items, sopsItem{path: []string{key, mapping.Content[i].Value}, value: value.Value, datatype: yamlType(value)})
+	}
+
+	return items, nil
+}
+
+// yamlType returns the sops type of an unencrypted YAML scalar.
+func yamlType(n *yaml.Node) string {
+	switch n.ShortTag() {
+	case "!!int":
+		return sopsTypeInt
+	case "!!float":
+		return sopsTypeFloat
+	case "!!bool":
+		return sopsTypeBool
+	default:
+		return sopsTypeString
+	}
+}
+
+// writeSOPSDotenv writes the values and metadata of a SOPS file as dotenv, with
+// the metadata flattened like sops does.
+func writeSOPSDotenv(w io.Writer, items []sopsItem, meta sopsMetadata) error {
+	bw := bufio.NewWriter(w)
+
+	line := func(key, value string) {
+		fmt.Fprintf(bw, "%s=%s\n", key, strings.ReplaceAll(value, "\n", `\n`)) //nolint:errcheck
+	}
+
+	for _, item := range items {
+		line(item.path[0], item.value)
+	}
+	for i, k := range meta.Age {
+		prefix := fmt.Sprintf("%sage__list_%d__map_", sopsDotenvPrefix, i)
+		line(prefix+"enc", k.Enc)
+		line(prefix+"recipient", k.Recipient)
+	}
+	line(sopsDotenvPrefix+"lastmodified", meta.LastModified)
+	line(sopsDotenvPrefix+"mac", meta.MAC)
+	line(sopsDotenvPrefix+"unencrypted_suffix", meta.UnencryptedSuffix)
+	line(sopsDotenvPrefix+"version", meta.Version)
+
+	err := bw.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write SOPS file: %w", err)
+	}
+
+	return nil
+}
+
+// parseSOPSDotenv parses the values and metadata of a SOPS dotenv file, in the
+// order of the file. Comments are skipped.
+func parseSOPSDotenv(data []byte) ([]sopsItem, sopsMetadata, error) {
+	var (
+		items []sopsItem
+		meta  sopsMetadata
+	)
+	keys := make(map[string]*sopsAgeKey)
+
+	for n, l := range strings.Split(string(data), "\n") {
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(l, "=")
+		if !ok {
+			return nil, sopsMetadata{}, fmt.Errorf("%w: line %d is not KEY=VALUE", ErrInvalidSOPSFile, n+1)
+		}
+		value = strings.ReplaceAll(value, `\n`, "\n")
+
+		if !strings.HasPrefix(key, sopsDotenvPrefix) {
+			items = append(items, sopsItem{path: []string{key}, value: value, datatype: sopsTypeString})
+
+			continue
+		}
+
+		meta.setDotenv(key, value, keys)
+	}
+
+	for _, k := range keys {
+		meta.Age = append(meta.Age, *k)
+	}
+
+	return items, meta, nil
+}
+
+// setDotenv sets the metadata of a flattened key of a SOPS dotenv file. The age
+// keys are collected in keys, by their index.
+func (m *sopsMetadata) setDotenv(key string, value string, keys map[string]*sopsAgeKey) {
+	switch key {
+	case sopsDotenvPrefix + "lastmodified":
+		m.LastModified = value
+	case sopsDotenvPrefix + "mac":
+		m.MAC = value
+	default:
+		match := sopsDotenvAgeKey.FindStringSubmatch(key)
+		if match == nil {
+			return
+		}
+
+		k, ok := keys[match[1]]
+		if !ok {
+			k = &sopsAgeKey{}
+			keys[match[1]] = k
+		}
+		if match[2] == "enc" {
+			k.Enc = value
+		} else {
+			k.Recipient = value
+		}
+	}
+}
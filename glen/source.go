@@ -0,0 +1,110 @@
+package glen
+
+import (
+	"fmt"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go/v2"
+)
+
+// SourceInstance is the Variable.Source of instance variables.
+const SourceInstance = "instance"
+
+// VariableSource lists CI/CD variables with full metadata. Variables reads the
+// variables of the instance, of groups and of projects from a VariableSource, which
+// by default calls the GitLab API. Set Variables.Source to read them from somewhere
+// else, or to test code built on Variables without a network.
+type VariableSource interface {
+	InstanceVariables() ([]Variable, error)
+	GroupVariables(group string) ([]Variable, error)
+	ProjectVariables(project string) ([]Variable, error)
+}
+
+// gitlabSource is a VariableSource that calls the GitLab API.
+type gitlabSource struct {
+	glc *gitlab.Client
+}
+
+// NewGitLabSource returns a VariableSource that lists variables with a GitLab API
+// client, for example one created with custom client options.
+func NewGitLabSource(glc *gitlab.Client) VariableSource {
+	return &gitlabSource{glc: glc}
+}
+
+// InstanceVariables implements VariableSource. Only administrators can list
+// instance variables.
+func (s *gitlabSource) InstanceVariables() ([]Variable, error) {
+	return listInstanceVariables(s.glc)
+}
+
+// GroupVariables implements VariableSource.
+func (s *gitlabSource) GroupVariables(group string) ([]Variable, error) {
+	return listGroupVariables(s.glc, group)
+}
+
+// ProjectVariables implements VariableSource.
+func (s *gitlabSource) ProjectVariables(project string) ([]Variable, error) {
+	return listProjectVariables(s.glc, project)
+}
+
+// listInstanceVariables returns every instance variable with full metadata.
+func listInstanceVariables(glc *gitlab.Client) ([]Variable, error) {
+	opt := &gitlab.ListInstanceVariablesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: pageSize},
+	}
+
+	ivs, err := listAll(func(opts ...gitlab.RequestOptionFunc) ([]*gitlab.InstanceVariable, *gitlab.Response, error) {
+		return glc.InstanceVariables.ListVariables(opt, opts...)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance variables: %w", err)
+	}
+
+	vars := make([]Variable, 0, len(ivs))
+	for _, iv := range ivs {
+		vars = append(vars, variableFromInstance(iv))
+	}
+
+	return vars, nil
+}
+
+// listGroupVariables returns every variable of a group with full metadata.
+func listGroupVariables(glc *gitlab.Client, group string) ([]Variable, error) {
+	opt := &gitlab.ListGroupVariablesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: pageSize},
+	}
+
+	gvs, err := listAll(func(opts ...gitlab.RequestOptionFunc) ([]*gitlab.GroupVariable, *gitlab.Response, error) {
+		return glc.GroupVariables.ListVariables(group, opt, opts...)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variables from group %s: %w", group, err)
+	}
+
+	vars := make([]Variable, 0, len(gvs))
+	for _, gv := range gvs {
+		vars = append(vars, variableFromGroup(gv, group))
+	}
+
+	return vars, nil
+}
+
+// listProjectVariables returns every variable of a project with full metadata.
+func listProjectVariables(glc *gitlab.Client, project string) ([]Variable, error) {
+	opt := &gitlab.ListProjectVariablesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: pageSize},
+	}
+
+	pvs, err := listAll(func(opts ...gitlab.RequestOptionFunc) ([]*gitlab.ProjectVariable, *gitlab.Response, error) {
+		return glc.ProjectVariables.ListVariables(project, opt, opts...)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variables from project %s: %w", project, err)
+	}
+
+	vars := make([]Variable, 0, len(pvs))
+	for _, pv := range pvs {
+		vars = append(vars, variableFromProject(pv, project))
+	}
+
+	return vars, nil
+}
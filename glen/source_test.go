@@ -0,0 +1,153 @@
+package glen
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lingrino/glen/glentest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errTestForbidden = errors.New("403 Forbidden")
+
+// testSource is a VariableSource that serves variables from memory. Namespaces
+// without variables fail like GitLab does without the Maintainer role.
+type testSource struct {
+	instance []Variable
+	groups   map[string][]Variable
+	projects map[string][]Variable
+}
+
+func (s *testSource) InstanceVariables() ([]Variable, error) {
+	if s.instance == nil {
+		return nil, errTestForbidden
+	}
+
+	return s.instance, nil
+}
+
+func (s *testSource) GroupVariables(group string) ([]Variable, error) {
+	vars, ok := s.groups[group]
+	if !ok {
+		return nil, errTestForbidden
+	}
+
+	return vars, nil
+}
+
+func (s *testSource) ProjectVariables(project string) ([]Variable, error) {
+	vars, ok := s.projects[project]
+	if !ok {
+		return nil, errTestForbidden
+	}
+
+	return vars, nil
+}
+
+func TestVariablesInitVariableSource(t *testing.T) {
+	t.Parallel()
+
+	source := &testSource{
+		instance: []Variable{
+			{Key: "INSTANCE", Value: "instance"},
+			{Key: "SHARED", Value: "instance"},
+		},
+		groups: map[string][]Variable{
+			"group":     {{Key: "SHARED", Value: "group"}},
+			"group/sub": {{Key: "SUB", Value: "sub", Protected: true}},
+		},
+		projects: map[string][]Variable{
+			"group/sub/project": {{Key: "PROJECT", Value: "project"}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		configure func(v *Variables)
+		want      map[string]string
+	}{
+		{
+			name:      "project",
+			configure: func(_ *Variables) {},
+			want:      map[string]string{"PROJECT": "project"},
+		},
+		{
+			name: "instance and groups",
+			configure: func(v *Variables) {
+				v.Instance = true
+				v.Recurse = true
+			},
+			want: map[string]string{"INSTANCE": "instance", "SHARED": "group", "SUB": "sub", "PROJECT": "project"},
+		},
+		{
+			name: "unreadable namespaces",
+			configure: func(v *Variables) {
+				v.Instance = true
+				v.Recurse = true
+				v.Source = &testSource{groups: map[string][]Variable{"group/sub": {{Key: "SUB", Value: "sub"}}}}
+			},
+			want: map[string]string{"SUB": "sub"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			// No API is called, so the repo does not need a remote
+			v := NewVariables(&Repo{Path: "group/sub/project", Groups: []string{"group/sub", "group"}})
+			v.APIURL = "http://127.0.0.1:1/api/v4"
+			v.Source = source
+			tt.configure(v)
+
+			require.NoError(t, v.Init())
+			assert.Equal(t, tt.want, v.Env)
+		})
+	}
+}
+
+func TestGitLabSourceInstanceVariables(t *testing.T) {
+	t.Parallel()
+
+	s := glentest.NewServer(t)
+	s.AddInstanceVariables(glentest.Variable{Key: "INSTANCE", Value: "instance", Masked: true})
+
+	glc, err := newClient(clientConfig{apiURL: s.URL, apiKey: s.Token})
+	require.NoError(t, err)
+
+	vars, err := NewGitLabSource(glc).InstanceVariables()
+	require.NoError(t, err)
+	assert.Equal(t, []Variable{{
+		Key: "INSTANCE", Value: "instance", Masked: true, EnvironmentScope: "*", Source: SourceInstance,
+	}}, vars)
+}
+
+// countingTransport counts the requests made through it.
+type countingTransport struct {
+	requests atomic.Int64
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+
+	return http.DefaultTransport.RoundTrip(req) //nolint:wrapcheck
+}
+
+func TestVariablesInitHTTPClient(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	transport := &countingTransport{}
+
+	v := newTestVariables(t, s)
+	v.Recurse = true
+	v.HTTPClient = &http.Client{Transport: transport}
+
+	require.NoError(t, v.Init())
+	assert.Equal(t, "project", v.Env["SHARED"])
+	assert.Equal(t, int64(len(s.Requests())), transport.requests.Load())
+	assert.Equal(t, int64(3), transport.requests.Load())
+}
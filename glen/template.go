@@ -0,0 +1,158 @@
+package glen
+
+import (
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+var (
+	// ErrUnknownTemplate is returned when a template is neither a file nor a built-in template.
+	ErrUnknownTemplate = errors.New("not a template file or a built-in template")
+	// ErrSystemdNewline is returned when quoting a value with a newline for systemd.
+	ErrSystemdNewline = errors.New("systemd environment files cannot hold values with newlines")
+)
+
+// builtinTemplates are the templates that ship with glen, by file name.
+//
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// TemplateData is the data that output templates are executed with.
+type TemplateData struct {
+	// Project and Repo are those of the variables. They are empty when the
+	// variables are from several projects or the project is not known.
+	Project string
+	Repo    *Repo
+	// Variables are the variables of every project, in order.
+	Variables []Variable
+	// Projects holds every project with its own variables, in order.
+	Projects []TemplateProject
+}
+
+// TemplateProject is a project and its variables in TemplateData. Repo is nil
+// when the git repo of the project is not known.
+type TemplateProject struct {
+	Project   string
+	Repo      *Repo
+	Variables []Variable
+}
+
+// NewTemplateData returns the data to execute output templates with for projects.
+func NewTemplateData(projects ...TemplateProject) *TemplateData {
+	data := &TemplateData{Projects: projects}
+	for _, p := range projects {
+		data.Variables = append(data.Variables, p.Variables...)
+	}
+	if len(projects) == 1 {
+		data.Project = projects[0].Project
+		data.Repo = projects[0].Repo
+	}
+
+	return data
+}
+
+// TemplateFuncs returns the helper functions that output templates can use:
+//
+//	quote        single quotes a string for POSIX shells
+//	systemdQuote double quotes a string for systemd environment files
+//	base64       encodes a string with standard base64
+//	json         encodes any value as compact JSON, which quotes strings
+//	indent       indents every line of a string by a number of spaces
+//	nindent      is indent with a newline before the string
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"quote": func(s string) string {
+			return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+		},
+		"systemdQuote": systemdQuote,
+		"base64": func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		},
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return "", fmt.Errorf("failed to encode JSON: %w", err)
+			}
+
+			return string(b), nil
+		},
+		"indent":  indent,
+		"nindent": func(n int, s string) string { return "\n" + indent(n, s) },
+	}
+}
+
+// systemdQuote double quotes s for a systemd EnvironmentFile. Inside double quotes
+// systemd only unescapes \\, \", \` and \$, and keeps any other backslash as it is,
+// so only those characters are escaped. Values with newlines are rejected, so that
+// the file has one variable per line.
+func systemdQuote(s string) (string, error) {
+	if strings.ContainsAny(s, "\n\r") {
+		return "", ErrSystemdNewline
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '\\', '"', '`', '$':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+
+	return b.String(), nil
+}
+
+// indent indents every line of s by n spaces.
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// BuiltinTemplates returns the names of the templates that ship with glen, sorted.
+func BuiltinTemplates() []string {
+	files, _ := fs.Glob(builtinTemplates, "templates/*.tmpl") //nolint:errcheck
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, strings.TrimSuffix(path.Base(f), ".tmpl"))
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ParseTemplate parses the output template in the file name, or the built-in
+// template called name if there is no such file. Templates are text/template
+// templates with TemplateFuncs, executed with TemplateData.
+func ParseTemplate(name string) (*template.Template, error) {
+	text, err := os.ReadFile(name) //nolint:gosec
+	if errors.Is(err, os.ErrNotExist) {
+		text, err = builtinTemplates.ReadFile("templates/" + name + ".tmpl")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s, built-in templates are %s",
+				ErrUnknownTemplate, name, strings.Join(BuiltinTemplates(), ", "))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+
+	tmpl, err := template.New(path.Base(name)).Funcs(TemplateFuncs()).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	return tmpl, nil
+}
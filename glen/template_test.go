@@ -0,0 +1,205 @@
+package glen
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// executeTemplate parses the template name and executes it with data.
+func executeTemplate(t *testing.T, name string, data *TemplateData) string {
+	t.Helper()
+
+	tmpl, err := ParseTemplate(name)
+	require.NoError(t, err)
+
+	var out strings.Builder
+	require.NoError(t, tmpl.Execute(&out, data))
+
+	return out.String()
+}
+
+func TestNewTemplateData(t *testing.T) {
+	t.Parallel()
+
+	repo := &Repo{Path: "g/p"}
+	a := TemplateProject{Project: "g/p", Repo: repo, Variables: []Variable{{Key: "A"}, {Key: "B"}}}
+	b := TemplateProject{Project: "g/q", Variables: []Variable{{Key: "C"}}}
+
+	single := NewTemplateData(a)
+	assert.Equal(t, "g/p", single.Project)
+	assert.Same(t, repo, single.Repo)
+	assert.Equal(t, a.Variables, single.Variables)
+
+	several := NewTemplateData(a, b)
+	assert.Empty(t, several.Project)
+	assert.Nil(t, several.Repo)
+	assert.Equal(t, []Variable{{Key: "A"}, {Key: "B"}, {Key: "C"}}, several.Variables)
+	assert.Equal(t, []TemplateProject{a, b}, several.Projects)
+}
+
+func TestBuiltinTemplates(t *testing.T) {
+	t.Parallel()
+
+	data := NewTemplateData(TemplateProject{
+		Project: "g/p",
+		Variables: []Variable{
+			{Key: "CERT", Value: "line1\nline2"},
+			{Key: "QUOTED", Value: `it's "$HOME"`},
+		},
+	})
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{
+			name: "helm",
+			want: "env:\n" +
+				"  - name: \"CERT\"\n    value: \"line1\\nline2\"\n" +
+				"  - name: \"QUOTED\"\n    value: \"it's \\\"$HOME\\\"\"\n",
+		},
+		{
+			name: "shell",
+			want: "export CERT='line1\nline2'\nexport QUOTED='it'\\''s \"$HOME\"'\n",
+		},
+	}
+
+	assert.Len(t, BuiltinTemplates(), len(tests)+1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Contains(t, BuiltinTemplates(), tt.name)
+			assert.Equal(t, tt.want, executeTemplate(t, tt.name, data))
+		})
+	}
+}
+
+// systemdUnquote reads a double quoted value of a systemd EnvironmentFile the way
+// systemd does, unescaping only \\, \", \` and \$.
+func systemdUnquote(t *testing.T, quoted string) string {
+	t.Helper()
+
+	require.True(t, len(quoted) >= 2 && quoted[0] == '"' && quoted[len(quoted)-1] == '"', quoted)
+
+	var b strings.Builder
+	escaped := false
+	for _, r := range quoted[1 : len(quoted)-1] {
+		switch {
+		case escaped && strings.ContainsRune("\\\"`$", r):
+			b.WriteRune(r)
+		case escaped:
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == '\\':
+			escaped = true
+
+			continue
+		default:
+			require.NotEqual(t, '"', r, "unescaped quote in %s", quoted)
+			b.WriteRune(r)
+		}
+		escaped = false
+	}
+	require.False(t, escaped, "trailing backslash in %s", quoted)
+
+	return b.String()
+}
+
+func TestSystemdTemplate(t *testing.T) {
+	t.Parallel()
+
+	values := map[string]string{
+		"PLAIN":     "value",
+		"QUOTED":    `it's "$HOME"`,
+		"BACKSLASH": `C:\new\table \\ \n`,
+		"HTML":      "a&b <c> `id`",
+		"UNICODE":   "caf\u00e9 \u2603",
+	}
+
+	variables := make([]Variable, 0, len(values))
+	for _, key := range []string{"BACKSLASH", "HTML", "PLAIN", "QUOTED", "UNICODE"} {
+		variables = append(variables, Variable{Key: key, Value: values[key]})
+	}
+
+	out := executeTemplate(t, "systemd", NewTemplateData(TemplateProject{Project: "g/p", Variables: variables}))
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	require.Len(t, lines, len(values))
+
+	for _, line := range lines {
+		key, quoted, ok := strings.Cut(line, "=")
+		require.True(t, ok, line)
+		assert.Equal(t, values[key], systemdUnquote(t, quoted), key)
+	}
+
+	tmpl, err := ParseTemplate("systemd")
+	require.NoError(t, err)
+
+	data := NewTemplateData(TemplateProject{Variables: []Variable{{Key: "CERT", Value: "line1\nline2"}}})
+	require.ErrorIs(t, tmpl.Execute(io.Discard, data), ErrSystemdNewline)
+}
+
+func TestBuiltinTemplatesEmpty(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "env: []\n", executeTemplate(t, "helm", NewTemplateData()))
+	assert.Empty(t, executeTemplate(t, "shell", NewTemplateData()))
+	assert.Empty(t, executeTemplate(t, "systemd", NewTemplateData()))
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "quote", text: `{{ quote "it's" }}`, want: `'it'\''s'`},
+		{name: "systemdQuote", text: `{{ systemdQuote "a&b $x \\n" }}`, want: `"a&b \$x \\n"`},
+		{name: "base64", text: `{{ base64 "secret" }}`, want: "c2VjcmV0"},
+		{name: "json string", text: `{{ json "a\"b" }}`, want: `"a\"b"`},
+		{name: "json variable", text: `{{ json (index .Variables 0) | printf "%.20s" }}`, want: `{"key":"A","value":"`},
+		{name: "indent", text: `{{ indent 2 "a\nb" }}`, want: "  a\n  b"},
+		{name: "nindent", text: `x:{{ nindent 4 "a" }}`, want: "x:\n    a"},
+		{name: "repo", text: `{{ .Repo.Path }} {{ .Project }}`, want: "g/p g/p"},
+	}
+
+	data := NewTemplateData(TemplateProject{
+		Project:   "g/p",
+		Repo:      &Repo{Path: "g/p"},
+		Variables: []Variable{{Key: "A", Value: "a"}},
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			file := filepath.Join(t.TempDir(), "test.tmpl")
+			require.NoError(t, os.WriteFile(file, []byte(tt.text), 0o600))
+
+			assert.Equal(t, tt.want, executeTemplate(t, file, data))
+		})
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := ParseTemplate("does-not-exist")
+	require.ErrorIs(t, err, ErrUnknownTemplate)
+	assert.Contains(t, err.Error(), "helm, shell, systemd")
+
+	file := filepath.Join(t.TempDir(), "bad.tmpl")
+	require.NoError(t, os.WriteFile(file, []byte("{{ .Variables"), 0o600))
+
+	_, err = ParseTemplate(file)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrUnknownTemplate)
+}
@@ -0,0 +1,161 @@
+package glen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+
+	gitlab "gitlab.com/gitlab-org/api/client-go/v2"
+)
+
+// fingerprintLength is the number of hex characters in a value fingerprint.
+const fingerprintLength = 12
+
+// SortOrder is the order that SortVariables sorts variables in.
+type SortOrder string
+
+// Orders that variables can be sorted in. Variables are always sorted by key last,
+// so that every order is deterministic.
+const (
+	SortByKey    SortOrder = "key"
+	SortBySource SortOrder = "source"
+	SortByScope  SortOrder = "scope"
+)
+
+var (
+	// ErrUnknownSortOrder is returned when parsing a sort order that is not supported.
+	ErrUnknownSortOrder = errors.New("unknown sort order, use one of 'key', 'source', 'scope'")
+	// ErrInvalidVariableName is returned when a variable name is not a valid
+	// environment variable name.
+	ErrInvalidVariableName = errors.New("invalid variable name, names may only contain letters, digits and '_'")
+)
+
+// variableNameRegexp matches the names that GitLab accepts for variables, which
+// are also the names that every shell accepts.
+var variableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidVariableName reports whether name is a valid variable name, that can be
+// written into shell code as it is.
+func ValidVariableName(name string) bool {
+	return variableNameRegexp.MatchString(name)
+}
+
+// Variable is a single GitLab CI/CD variable along with all of the metadata
+// that GitLab stores for it. Source records where the variable came from, for
+// example "group:my-group" or "project:my-group/my-project".
+type Variable struct {
+	Key              string `json:"key"`
+	Value            string `json:"value"`
+	VariableType     string `json:"variableType"`
+	Protected        bool   `json:"protected"`
+	Masked           bool   `json:"masked"`
+	Hidden           bool   `json:"hidden"`
+	Raw              bool   `json:"raw"`
+	EnvironmentScope string `json:"environmentScope"`
+	Description      string `json:"description"`
+	Source           string `json:"source"`
+}
+
+// Variable sources, used as the prefix of Variable.Source.
+const (
+	SourceGroup   = "group"
+	SourceProject = "project"
+)
+
+// Sensitive reports whether GitLab masks or hides the value of the variable.
+func (v Variable) Sensitive() bool {
+	return v.Masked || v.Hidden
+}
+
+// Fingerprint returns a short hash of the value of the variable. Fingerprints can
+// be compared to check if two variables have the same value without showing it.
+func (v Variable) Fingerprint() string {
+	sum := sha256.Sum256([]byte(v.Value))
+
+	return hex.EncodeToString(sum[:])[:fingerprintLength]
+}
+
+func variableFromGroup(gv *gitlab.GroupVariable, group string) Variable {
+	return Variable{
+		Key:              gv.Key,
+		Value:            gv.Value,
+		VariableType:     string(gv.VariableType),
+		Protected:        gv.Protected,
+		Masked:           gv.Masked,
+		Hidden:           gv.Hidden,
+		Raw:              gv.Raw,
+		EnvironmentScope: gv.EnvironmentScope,
+		Description:      gv.Description,
+		Source:           SourceGroup + ":" + group,
+	}
+}
+
+// variableFromInstance converts an instance variable. Instance variables apply to
+// every environment.
+func variableFromInstance(iv *gitlab.InstanceVariable) Variable {
+	return Variable{
+		Key:              iv.Key,
+		Value:            iv.Value,
+		VariableType:     string(iv.VariableType),
+		Protected:        iv.Protected,
+		Masked:           iv.Masked,
+		Raw:              iv.Raw,
+		EnvironmentScope: "*",
+		Description:      iv.Description,
+		Source:           SourceInstance,
+	}
+}
+
+func variableFromProject(pv *gitlab.ProjectVariable, project string) Variable {
+	return Variable{
+		Key:              pv.Key,
+		Value:            pv.Value,
+		VariableType:     string(pv.VariableType),
+		Protected:        pv.Protected,
+		Masked:           pv.Masked,
+		Hidden:           pv.Hidden,
+		Raw:              pv.Raw,
+		EnvironmentScope: pv.EnvironmentScope,
+		Description:      pv.Description,
+		Source:           SourceProject + ":" + project,
+	}
+}
+
+// ParseSortOrder parses the name of a sort order. An empty name sorts by key.
+func ParseSortOrder(name string) (SortOrder, error) {
+	switch order := SortOrder(name); order {
+	case "":
+		return SortByKey, nil
+	case SortByKey, SortBySource, SortByScope:
+		return order, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownSortOrder, name)
+	}
+}
+
+// SortVariables returns the variables in vars sorted by order and then by key, with
+// each Key set to its key in vars.
+func SortVariables(vars map[string]Variable, order SortOrder) []Variable {
+	sorted := make([]Variable, 0, len(vars))
+	for key, v := range vars {
+		v.Key = key
+		sorted = append(sorted, v)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		switch {
+		case order == SortBySource && a.Source != b.Source:
+			return a.Source < b.Source
+		case order == SortByScope && a.EnvironmentScope != b.EnvironmentScope:
+			return a.EnvironmentScope < b.EnvironmentScope
+		default:
+			return a.Key < b.Key
+		}
+	})
+
+	return sorted
+}
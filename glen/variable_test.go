@@ -0,0 +1,103 @@
+package glen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVariableSensitive(t *testing.T) {
+	t.Parallel()
+
+	assert.False(t, Variable{Key: "A", Value: "a"}.Sensitive())
+	assert.True(t, Variable{Key: "A", Value: "a", Masked: true}.Sensitive())
+	assert.True(t, Variable{Key: "A", Hidden: true}.Sensitive())
+}
+
+func TestVariableFingerprint(t *testing.T) {
+	t.Parallel()
+
+	a := Variable{Key: "A", Value: "secret"}
+	b := Variable{Key: "B", Value: "secret", Masked: true}
+	c := Variable{Key: "A", Value: "other"}
+
+	assert.Len(t, a.Fingerprint(), fingerprintLength)
+	assert.Equal(t, a.Fingerprint(), b.Fingerprint())
+	assert.NotEqual(t, a.Fingerprint(), c.Fingerprint())
+	assert.NotContains(t, a.Fingerprint(), "secret")
+}
+
+func TestParseSortOrder(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		want    SortOrder
+		wantErr error
+	}{
+		{name: "", want: SortByKey},
+		{name: "key", want: SortByKey},
+		{name: "source", want: SortBySource},
+		{name: "scope", want: SortByScope},
+		{name: "value", wantErr: ErrUnknownSortOrder},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseSortOrder(tt.name)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSortVariables(t *testing.T) {
+	t.Parallel()
+
+	vars := map[string]Variable{
+		"B":      {Value: "b", EnvironmentScope: "*", Source: "project:g/p"},
+		"A":      {Value: "a", EnvironmentScope: "production", Source: "project:g/p"},
+		"C":      {Value: "c", EnvironmentScope: "*", Source: "group:g"},
+		"PREFIX": {Key: "OLD", Value: "d", EnvironmentScope: "production", Source: "group:g"},
+	}
+
+	tests := []struct {
+		order SortOrder
+		want  []string
+	}{
+		{order: SortByKey, want: []string{"A", "B", "C", "PREFIX"}},
+		{order: SortBySource, want: []string{"C", "PREFIX", "A", "B"}},
+		{order: SortByScope, want: []string{"B", "C", "A", "PREFIX"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.order), func(t *testing.T) {
+			t.Parallel()
+
+			var keys []string
+			for _, v := range SortVariables(vars, tt.order) {
+				keys = append(keys, v.Key)
+			}
+			assert.Equal(t, tt.want, keys)
+		})
+	}
+}
+
+func TestValidVariableName(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"A", "_A", "a_b_1", "CI_COMMIT_SHA"} {
+		assert.True(t, ValidVariableName(name), name)
+	}
+	for _, name := range []string{"", "1A", "A-B", "A B", "A;id", "$(id)", "A=B", "Ä"} {
+		assert.False(t, ValidVariableName(name), name)
+	}
+}
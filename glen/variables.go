@@ -2,26 +2,93 @@ package glen
 
 import (
 	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+	"regexp"
 
 	gitlab "gitlab.com/gitlab-org/api/client-go/v2"
+	"golang.org/x/oauth2"
 )
 
 // Variables represents a set of CI/CD environment variables and
 // the repo that those variables were collected from.
 type Variables struct {
 	Env       map[string]string
+	Vars      map[string]Variable
 	GroupOnly bool
 	Recurse   bool
+	CIVars    bool
 	Repo      *Repo
 
-	apiKey string
-}
+	// PipelineID and JobID reproduce the variables of a pipeline, or of a job and
+	// its pipeline. Ref is set to the ref of the pipeline and protected variables
+	// are dropped unless it is protected, Environment is set to the environment of
+	// the job, or only variables for all environments are kept if the job has none,
+	// and the variables the pipeline was created with are included with
+	// the highest precedence. Ref and Environment are kept if they are set. Init
+	// sets Pipeline to the pipeline and job that were found.
+	PipelineID int64
+	JobID      int64
+	Pipeline   *Pipeline
+
+	// CIConfigPath is the pipeline configuration to read variables from, relative
+	// to the repo root. Variables from the pipeline configuration are only included
+	// when it is set. Job selects a job whose variables are included as well.
+	CIConfigPath string
+	Job          string
+
+	// SimulateRef drops protected variables unless Ref is a protected branch or tag
+	// of the project, the same as GitLab does for pipelines. If Ref is empty the
+	// currently checked out branch or tag is used.
+	SimulateRef bool
+	Ref         string
+
+	// PipelineSource is the CI_PIPELINE_SOURCE of predefined variables, such as
+	// "merge_request_event" or "schedule". It defaults to "push", or to the source
+	// of the pipeline when reproducing one.
+	PipelineSource string
+
+	// Environment drops variables whose environment scope does not match it. When
+	// several variables with the same key match, the most specific scope wins.
+	Environment string
+
+	// Include and Exclude select variables by key with globs or regular expressions,
+	// and StripPrefix and AddPrefix rename them. All of them are applied by Filter.
+	Include      []string
+	Exclude      []string
+	IncludeRegex []*regexp.Regexp
+	ExcludeRegex []*regexp.Regexp
+	StripPrefix  string
+	AddPrefix    string
+
+	// Instance includes the instance variables, which only administrators can read,
+	// with a lower precedence than group variables.
+	Instance bool
 
-// Gitlab list apis default to 20 per page with 100 being the max.
-// https://docs.gitlab.com/ee/api/README.html#offset-based-pagination
-// Set to max to reduce number of API calls required.
-const pageSize = 100
+	// Source lists the instance, group and project variables. It defaults to the
+	// GitLab API at APIURL, which defaults to https://<Repo.BaseURL>/api/v4.
+	// HTTPClient is used to call the API instead of http.DefaultClient if it is set.
+	// The API is still called for predefined variables and to simulate refs.
+	Source     VariableSource
+	APIURL     string
+	HTTPClient *http.Client
+
+	// TokenSource authenticates with OAuth access tokens instead of the API key when
+	// set. If it is a TokenRefresher, requests that GitLab rejects with 401
+	// Unauthorized are retried once with a refreshed token.
+	TokenSource oauth2.TokenSource
+
+	// Logger receives debug logs of every API request and of the groups and projects
+	// whose variables could not be read. Nothing is logged if it is nil.
+	Logger *slog.Logger
+
+	// Unresolved lists the references that Expand could not resolve.
+	Unresolved []string
+
+	apiKey        string
+	dropProtected bool
+}
 
 // NewVariables takes a *Repo and returns an empty Variables struct. This
 // assumes that you have a GitLab API key set as GITLAB_TOKEN. If not, make
@@ -32,8 +99,10 @@ func NewVariables(r *Repo) *Variables {
 	v := &Variables{}
 
 	v.Env = make(map[string]string)
+	v.Vars = make(map[string]Variable)
 	v.GroupOnly = false
 	v.Recurse = false
+	v.CIVars = false
 	v.Repo = r
 	v.apiKey = os.Getenv("GITLAB_TOKEN")
 
@@ -52,87 +121,191 @@ func (v *Variables) IsAPIKeySet() bool {
 	return v.apiKey != ""
 }
 
-// Get the group variables and add them to v.Env.
-func (v *Variables) getGroupVariables(glc *gitlab.Client, group string) error {
-	groupVariablesOpt := &gitlab.ListGroupVariablesOptions{
-		ListOptions: gitlab.ListOptions{
-			PerPage: pageSize,
-			Page:    1,
-		},
+// clientConfig configures the GitLab API client created by newClient.
+type clientConfig struct {
+	// baseURL is the GitLab instance, and apiURL overrides its API URL if set.
+	baseURL string
+	apiURL  string
+	// The client authenticates with tokenSource if it is set, and with apiKey otherwise.
+	apiKey      string
+	tokenSource oauth2.TokenSource
+	// httpClient replaces http.DefaultClient if it is set.
+	httpClient *http.Client
+	// logger logs every request if it is set.
+	logger *slog.Logger
+}
+
+// newClient creates a GitLab API client for the GitLab instance at c.baseURL, or for
+// the API at c.apiURL if it is set.
+func newClient(c clientConfig) (*gitlab.Client, error) {
+	glURL := c.apiURL
+	if glURL == "" {
+		glURL = fmt.Sprintf("https://%s/api/v4", c.baseURL)
 	}
 
-	for {
-		gvs, response, err := glc.GroupVariables.ListVariables(group, groupVariablesOpt)
-		if err != nil {
-			return fmt.Errorf("failed to get variables from group %s: %w", group, err)
-		}
-		for _, gv := range gvs {
-			v.Env[gv.Key] = gv.Value
-		}
+	client := &http.Client{}
+	if c.httpClient != nil {
+		*client = *c.httpClient
+	}
+	if client.Transport == nil {
+		client.Transport = http.DefaultTransport
+	}
 
-		if response.CurrentPage >= response.TotalPages {
-			break
+	var auth gitlab.AuthSource = gitlab.AccessTokenAuthSource{Token: c.apiKey}
+	if c.logger != nil {
+		client.Transport = &loggingTransport{base: client.Transport, logger: c.logger}
+	}
+	if c.tokenSource != nil {
+		auth = gitlab.OAuthTokenSource{TokenSource: c.tokenSource}
+		if refresher, ok := c.tokenSource.(TokenRefresher); ok {
+			client.Transport = &refreshTransport{base: client.Transport, refresher: refresher}
 		}
+	}
 
-		groupVariablesOpt.Page = response.NextPage
+	opts := []gitlab.ClientOptionFunc{gitlab.WithBaseURL(glURL)}
+	if c.httpClient != nil || client.Transport != http.DefaultTransport {
+		opts = append(opts, gitlab.WithHTTPClient(client))
 	}
 
-	return nil
+	glc, err := gitlab.NewAuthSourceClient(auth, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gitlab client: %w", err)
+	}
+
+	return glc, nil
 }
 
-// Get the project variables and add them to v.Env.
-func (v *Variables) getProjectVariables(glc *gitlab.Client) error {
-	projectVariablesOpt := &gitlab.ListProjectVariablesOptions{
-		ListOptions: gitlab.ListOptions{
-			PerPage: pageSize,
-			Page:    1,
-		},
+// add adds variables listed from a namespace to v.Vars and v.Env, dropping protected
+// variables if the simulated ref is not protected. If the variables could not be
+// listed, usually for lack of the Maintainer role, the namespace is skipped.
+func (v *Variables) add(vars []Variable, err error, namespace ...any) {
+	logger := orDiscard(v.Logger)
+	if err != nil {
+		logger.Info("skipped variables", append(namespace, "error", err)...)
+
+		return
 	}
+	logger.Debug("got variables", append(namespace, "count", len(vars))...)
 
-	for {
-		pvs, response, err := glc.ProjectVariables.ListVariables(v.Repo.Path, projectVariablesOpt)
-		if err != nil {
-			return fmt.Errorf("failed to get variables from project %s: %w", v.Repo.Path, err)
+	for _, variable := range vars {
+		if variable.Protected && v.dropProtected {
+			continue
 		}
-		for _, pv := range pvs {
-			v.Env[pv.Key] = pv.Value
+		v.set(variable)
+	}
+}
+
+// getVariables adds the variables of the instance, if Variables.Instance=true, of
+// the parent groups, if recursing, and of the project from source, in order of
+// precedence.
+func (v *Variables) getVariables(source VariableSource) {
+	if v.Instance {
+		vars, err := source.InstanceVariables()
+		v.add(vars, err, "instance", true)
+	}
+
+	// Groups are ordered from the immediate parent to the root group, and subgroups
+	// override their parents.
+	if v.Recurse || v.GroupOnly {
+		for i := len(v.Repo.Groups) - 1; i >= 0; i-- {
+			vars, err := source.GroupVariables(v.Repo.Groups[i])
+			v.add(vars, err, "group", v.Repo.Groups[i])
 		}
+	}
+
+	if !v.GroupOnly {
+		vars, err := source.ProjectVariables(v.Repo.Path)
+		v.add(vars, err, "project", v.Repo.Path)
+	}
+}
 
-		if response.CurrentPage >= response.TotalPages {
-			break
+// set adds a variable to v.Vars and v.Env, replacing any variable with the same key.
+// If Variables.Environment is set, or a job that deploys to no environment is
+// reproduced, variables scoped to other environments are skipped and a variable
+// never replaces one from the same source with a more specific scope.
+func (v *Variables) set(variable Variable) {
+	if v.Environment != "" || v.Pipeline != nil && v.Pipeline.JobID != 0 {
+		if !MatchEnvironmentScope(variable.EnvironmentScope, v.Environment) {
+			return
 		}
 
-		projectVariablesOpt.Page = response.NextPage
+		existing, ok := v.Vars[variable.Key]
+		if ok && existing.Source == variable.Source &&
+			scopeSpecificity(existing.EnvironmentScope) > scopeSpecificity(variable.EnvironmentScope) {
+			return
+		}
 	}
 
-	return nil
+	v.Vars[variable.Key] = variable
+	v.Env[variable.Key] = variable.Value
 }
 
-// Init collects GitLab variables from the repo, and optionally from the parent groups
-// if Variables.Recurse=true. Variable precedence respects
+// Init collects the GitLab variables of the repo into Variables.Vars and
+// Variables.Env. Variable precedence respects
 // https://docs.gitlab.com/ee/ci/variables/#priority-of-environment-variables
+//
+// These fields of Variables change what is collected:
+//   - Recurse and Instance add the variables of the parent groups and the instance.
+//   - GroupOnly leaves out the variables of the project.
+//   - CIVars adds the GitLab predefined variables.
+//   - CIConfigPath and Job add the variables declared in the pipeline configuration.
+//   - SimulateRef and Ref drop protected variables unless the ref is protected.
+//   - Environment drops variables scoped to other environments.
+//   - PipelineID and JobID reproduce the variables of a pipeline or job.
 func (v *Variables) Init() error {
 	var err error
 
 	// Initialize the GitLab client
-	glURL := fmt.Sprintf("https://%s/api/v4", v.Repo.BaseURL)
-	glc, err := gitlab.NewClient(v.apiKey, gitlab.WithBaseURL(glURL))
+	glc, err := newClient(clientConfig{
+		baseURL: v.Repo.BaseURL, apiURL: v.APIURL, apiKey: v.apiKey, tokenSource: v.TokenSource,
+		httpClient: v.HTTPClient, logger: v.Logger,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create gitlab client: %w", err)
+		return err
 	}
 
-	// Get variables from the parent groups, if recurse
-	if v.Recurse || v.GroupOnly {
-		for _, group := range v.Repo.Groups {
-			//nolint:errcheck,gosec
-			v.getGroupVariables(glc, group)
+	// A pipeline decides the ref and environment to simulate
+	err = v.getPipeline(glc)
+	if err != nil {
+		return err
+	}
+
+	// Decide whether protected variables are dropped before collecting any
+	if v.SimulateRef {
+		err = v.checkRef(glc)
+		if err != nil {
+			return err
 		}
 	}
 
-	if !v.GroupOnly {
-		//nolint:errcheck,gosec
-		v.getProjectVariables(glc)
+	// Predefined variables have the lowest precedence
+	if v.CIVars {
+		err = v.getPredefinedVariables(glc)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Variables from the pipeline configuration come next
+	if v.CIConfigPath != "" {
+		err = v.getCIConfigVariables()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Variables from the instance, groups and project come next
+	v.getVariables(v.source(glc))
+
+	// Variables that the pipeline was created with come last
+	return v.getPipelineVariables(glc)
+}
+
+// source returns Variables.Source, or the GitLab API if it is not set.
+func (v *Variables) source(glc *gitlab.Client) VariableSource { //nolint:ireturn
+	if v.Source != nil {
+		return v.Source
 	}
 
-	return nil
+	return NewGitLabSource(glc)
 }
@@ -0,0 +1,299 @@
+package glen
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/lingrino/glen/glentest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRemote = "https://gitlab.example.com/group/sub/project.git"
+
+// newTestVariables returns Variables for a repo with testRemote that call the API of s.
+func newTestVariables(t *testing.T, s *glentest.Server) *Variables {
+	t.Helper()
+
+	repo := NewRepo()
+	repo.LocalPath = glentest.NewRepo(t, map[string]string{"origin": testRemote})
+	require.NoError(t, repo.Init())
+
+	v := NewVariables(repo)
+	v.APIURL = s.URL
+	v.SetAPIKey(s.Token)
+
+	return v
+}
+
+// newTestServer returns a Server with variables in the project and both of its parent groups.
+func newTestServer(t *testing.T) *glentest.Server {
+	t.Helper()
+
+	s := glentest.NewServer(t)
+	s.AddGroupVariables("group",
+		glentest.Variable{Key: "ROOT", Value: "root", EnvironmentScope: "*"},
+		glentest.Variable{Key: "SHARED", Value: "root", EnvironmentScope: "*"},
+	)
+	s.AddGroupVariables("group/sub",
+		glentest.Variable{Key: "SUB", Value: "sub", EnvironmentScope: "*"},
+		glentest.Variable{Key: "SHARED", Value: "sub", EnvironmentScope: "*"},
+	)
+	s.AddProjectVariables("group/sub/project",
+		glentest.Variable{Key: "PROJECT", Value: "project", EnvironmentScope: "*"},
+		glentest.Variable{Key: "SHARED", Value: "project", EnvironmentScope: "*"},
+		glentest.Variable{Key: "DEPLOY", Value: "staging", EnvironmentScope: "staging"},
+		glentest.Variable{Key: "DEPLOY", Value: "production", EnvironmentScope: "production"},
+		glentest.Variable{Key: "SECRET", Value: "secret", EnvironmentScope: "*", Protected: true},
+	)
+
+	return s
+}
+
+func TestVariablesInit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		configure func(s *glentest.Server, v *Variables)
+		want      map[string]string
+	}{
+		{
+			name:      "project",
+			configure: func(_ *glentest.Server, v *Variables) { v.Environment = "staging" },
+			want:      map[string]string{"PROJECT": "project", "SHARED": "project", "DEPLOY": "staging", "SECRET": "secret"},
+		},
+		{
+			name: "recurse",
+			configure: func(_ *glentest.Server, v *Variables) {
+				v.Recurse = true
+				v.Environment = "production"
+			},
+			want: map[string]string{
+				"ROOT": "root", "SUB": "sub", "PROJECT": "project", "SHARED": "project",
+				"DEPLOY": "production", "SECRET": "secret",
+			},
+		},
+		{
+			name:      "group only",
+			configure: func(_ *glentest.Server, v *Variables) { v.GroupOnly = true },
+			want:      map[string]string{"ROOT": "root", "SUB": "sub", "SHARED": "sub"},
+		},
+		{
+			name: "paginated",
+			configure: func(s *glentest.Server, v *Variables) {
+				s.PerPage = 1
+				v.Recurse = true
+				v.Environment = "staging"
+			},
+			want: map[string]string{
+				"ROOT": "root", "SUB": "sub", "PROJECT": "project", "SHARED": "project",
+				"DEPLOY": "staging", "SECRET": "secret",
+			},
+		},
+		{
+			name: "rate limited",
+			configure: func(s *glentest.Server, v *Variables) {
+				s.RateLimit(1)
+				v.GroupOnly = true
+			},
+			want: map[string]string{"ROOT": "root", "SUB": "sub", "SHARED": "sub"},
+		},
+		{
+			name: "failed group",
+			configure: func(s *glentest.Server, v *Variables) {
+				s.Fail("/groups/group/sub/variables", http.StatusForbidden)
+				v.GroupOnly = true
+			},
+			want: map[string]string{"ROOT": "root", "SHARED": "root"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newTestServer(t)
+			v := newTestVariables(t, s)
+			tt.configure(s, v)
+
+			require.NoError(t, v.Init())
+			assert.Equal(t, tt.want, v.Env)
+		})
+	}
+}
+
+func TestVariablesInitSource(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	v := newTestVariables(t, s)
+	v.Recurse = true
+
+	require.NoError(t, v.Init())
+	assert.Equal(t, "group:group", v.Vars["ROOT"].Source)
+	assert.Equal(t, "group:group/sub", v.Vars["SUB"].Source)
+	assert.Equal(t, "project:group/sub/project", v.Vars["SHARED"].Source)
+	assert.True(t, v.Vars["SECRET"].Protected)
+}
+
+func TestVariablesInitGroupPrecedence(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	v := newTestVariables(t, s)
+	v.GroupOnly = true
+
+	// SHARED is set in both groups, and like in GitLab the subgroup wins
+	require.NoError(t, v.Init())
+	assert.Equal(t, "sub", v.Env["SHARED"])
+	assert.Equal(t, "group:group/sub", v.Vars["SHARED"].Source)
+}
+
+func TestVariablesInitSimulateRef(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		ref        string
+		tags       []string
+		wantSecret bool
+	}{
+		{name: "protected branch", ref: "main", wantSecret: true},
+		{name: "protected wildcard", ref: "release/1.0", wantSecret: true},
+		{name: "unprotected branch", ref: "feature", wantSecret: false},
+		{name: "protected tag", ref: "v1.0", tags: []string{"v1.0"}, wantSecret: true},
+		{name: "branch matching a protected tag", ref: "v1.0", wantSecret: false},
+		{name: "tag matching a protected branch", ref: "release/1.0", tags: []string{"release/1.0"}, wantSecret: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newTestServer(t)
+			s.AddProtectedBranches("group/sub/project", "main", "release/*")
+			s.AddProtectedTags("group/sub/project", "v*")
+
+			v := newTestVariables(t, s)
+			sha := glentest.Commit(t, v.Repo.LocalPath, map[string]string{"README.md": "hello"}, "Add readme")
+			repo, err := git.PlainOpen(v.Repo.LocalPath)
+			require.NoError(t, err)
+			for _, tag := range tt.tags {
+				_, err = repo.CreateTag(tag, plumbing.NewHash(sha), nil)
+				require.NoError(t, err)
+			}
+			v.SimulateRef = true
+			v.Ref = tt.ref
+
+			require.NoError(t, v.Init())
+			assert.Equal(t, "project", v.Env["PROJECT"])
+			if tt.wantSecret {
+				assert.Contains(t, v.Env, "SECRET")
+			} else {
+				assert.NotContains(t, v.Env, "SECRET")
+			}
+		})
+	}
+}
+
+func TestVariablesInitCIVars(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	s.AddProject(glentest.Project{
+		ID:            42,
+		Path:          "group/sub/project",
+		Visibility:    "private",
+		DefaultBranch: "main",
+		NamespaceID:   7,
+	})
+	s.AddProjectVariables("group/sub/project", glentest.Variable{Key: "CI_DEFAULT_BRANCH", Value: "override"})
+
+	v := newTestVariables(t, s)
+	sha := glentest.Commit(t, v.Repo.LocalPath, map[string]string{"README.md": "hello"}, "Add readme")
+	v.CIVars = true
+
+	require.NoError(t, v.Init())
+	assert.Equal(t, "42", v.Env["CI_PROJECT_ID"])
+	assert.Equal(t, "project", v.Env["CI_PROJECT_TITLE"])
+	assert.Equal(t, "private", v.Env["CI_PROJECT_VISIBILITY"])
+	assert.Equal(t, "7", v.Env["CI_PROJECT_NAMESPACE_ID"])
+	assert.Equal(t, sha, v.Env["CI_COMMIT_SHA"])
+	assert.Equal(t, "override", v.Env["CI_DEFAULT_BRANCH"])
+	assert.Equal(t, SourcePredefined, v.Vars["CI_PROJECT_ID"].Source)
+}
+
+func TestVariablesInitCIVarsAPIURL(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+
+	v := newTestVariables(t, s)
+	v.CIVars = true
+
+	require.NoError(t, v.Init())
+	assert.Equal(t, "http://"+u.Host, v.Env["CI_SERVER_URL"])
+	assert.Equal(t, s.URL, v.Env["CI_API_V4_URL"])
+	assert.Equal(t, "http", v.Env["CI_SERVER_PROTOCOL"])
+	assert.Equal(t, u.Hostname(), v.Env["CI_SERVER_HOST"])
+	assert.Equal(t, u.Port(), v.Env["CI_SERVER_PORT"])
+	assert.Equal(t, "http://"+u.Host+"/group/sub/project", v.Env["CI_PROJECT_URL"])
+}
+
+func TestVariablesInitCIVarsRef(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		ref        string
+		source     string
+		wantBranch string
+		wantTag    string
+		wantSource string
+	}{
+		{name: "checked out branch", wantBranch: glentest.DefaultBranch, wantSource: "push"},
+		{name: "branch", ref: "feature", wantBranch: "feature", wantSource: "push"},
+		{name: "tag", ref: "v1.0.0", wantTag: "v1.0.0", wantSource: "push"},
+		{name: "source", source: "merge_request_event", wantBranch: glentest.DefaultBranch, wantSource: "merge_request_event"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newTestServer(t)
+			v := newTestVariables(t, s)
+			sha := glentest.Commit(t, v.Repo.LocalPath, map[string]string{"README.md": "hello"}, "Add readme")
+			repo, err := git.PlainOpen(v.Repo.LocalPath)
+			require.NoError(t, err)
+			_, err = repo.CreateTag("v1.0.0", plumbing.NewHash(sha), nil)
+			require.NoError(t, err)
+			v.CIVars = true
+			v.Ref = tt.ref
+			v.PipelineSource = tt.source
+
+			require.NoError(t, v.Init())
+			assert.Equal(t, tt.wantBranch, v.Env["CI_COMMIT_BRANCH"])
+			assert.Equal(t, tt.wantTag, v.Env["CI_COMMIT_TAG"])
+			assert.Equal(t, tt.wantSource, v.Env["CI_PIPELINE_SOURCE"])
+		})
+	}
+}
+
+func TestVariablesInitUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	s := newTestServer(t)
+	v := newTestVariables(t, s)
+	v.SetAPIKey("wrong")
+	v.CIVars = true
+	glentest.Commit(t, v.Repo.LocalPath, nil, "Empty")
+
+	require.Error(t, v.Init())
+}
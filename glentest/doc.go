@@ -0,0 +1,18 @@
+/*
+Package glentest provides helpers for testing code that uses the GitLab API, such as the glen
+package and tools built on it.
+
+# Server
+
+Server is an in-process stand-in for the GitLab REST API, built on net/http/httptest. It serves
+project, group and instance CI/CD variables along with the few project endpoints that glen calls,
+such as protected refs, pipelines, jobs and deployments, and describes the user, personal access token and memberships that its token belongs to.
+Responses are paginated the same way GitLab paginates them and carry an ETag that is honored by
+If-None-Match, and requests can be made to fail or to be rate limited.
+
+# Repos
+
+NewRepo and Commit create git repos in temporary directories, with any remotes, so that code that
+reads a local repo can be tested without a real checkout.
+*/
+package glentest
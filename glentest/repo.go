@@ -0,0 +1,89 @@
+package glentest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// DefaultBranch is the branch that NewRepo checks out.
+const DefaultBranch = "main"
+
+// NewRepo creates a git repo in a temporary directory, with remotes keyed by name,
+// and returns its path. The repo has no commits until Commit is called.
+func NewRepo(t testing.TB, remotes map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	repo, err := git.PlainInitWithOptions(dir, &git.PlainInitOptions{
+		InitOptions: git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName(DefaultBranch)},
+	})
+	if err != nil {
+		t.Fatalf("failed to init repo: %v", err)
+	}
+
+	for name, remoteURL := range remotes {
+		_, err = repo.CreateRemote(&config.RemoteConfig{Name: name, URLs: []string{remoteURL}})
+		if err != nil {
+			t.Fatalf("failed to create remote %s: %v", name, err)
+		}
+	}
+
+	return dir
+}
+
+// Commit writes files, keyed by their path relative to the repo at dir, and
+// commits them with message. It returns the SHA of the commit.
+func Commit(t testing.TB, dir string, files map[string]string, message string) string {
+	t.Helper()
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatalf("failed to open repo: %v", err)
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+
+		err = os.MkdirAll(filepath.Dir(path), 0o750) //nolint:mnd
+		if err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+
+		err = os.WriteFile(path, []byte(content), 0o600) //nolint:mnd
+		if err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+
+		_, err = wt.Add(name)
+		if err != nil {
+			t.Fatalf("failed to add %s: %v", name, err)
+		}
+	}
+
+	hash, err := wt.Commit(message, &git.CommitOptions{
+		AllowEmptyCommits: true,
+		Author: &object.Signature{
+			Name:  "glentest",
+			Email: "glentest@example.com",
+			When:  time.Now(),
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	return hash.String()
+}
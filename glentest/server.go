@@ -0,0 +1,871 @@
+package glentest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Token is the API token that a new Server accepts.
+const Token = "glentest-token" //nolint:gosec
+
+// GitLab returns 20 items per page by default, and at most 100.
+// https://docs.gitlab.com/ee/api/rest/#pagination
+const (
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// variablesPath is the path segment of variables endpoints.
+const variablesPath = "variables"
+
+// Variable is a CI/CD variable as the GitLab API returns it.
+//
+//nolint:tagliatelle // The GitLab API uses snake case.
+type Variable struct {
+	Key              string `json:"key"`
+	Value            string `json:"value"`
+	VariableType     string `json:"variable_type"`
+	Protected        bool   `json:"protected"`
+	Masked           bool   `json:"masked"`
+	Hidden           bool   `json:"hidden"`
+	Raw              bool   `json:"raw"`
+	EnvironmentScope string `json:"environment_scope"`
+	Description      string `json:"description"`
+}
+
+// Project is a GitLab project. Only the fields that glen reads are served.
+type Project struct {
+	ID            int
+	Path          string
+	Description   string
+	Visibility    string
+	DefaultBranch string
+	NamespaceID   int
+
+	variables         []Variable
+	protectedBranches []string
+	protectedTags     []string
+	pipelines         []Pipeline
+	jobs              []Job
+}
+
+// Pipeline is a pipeline of a project. Variables are the variables that it was
+// created with, by a trigger, a schedule or by hand. Only their keys, values and
+// types are served.
+type Pipeline struct {
+	ID        int
+	Ref       string
+	Tag       bool
+	SHA       string
+	Source    string
+	Variables []Variable
+}
+
+// Job is a job of a pipeline. A job with an Environment has a deployment to it.
+type Job struct {
+	ID          int
+	PipelineID  int
+	Name        string
+	Stage       string
+	Environment string
+}
+
+// User is the GitLab user that Server.Token belongs to.
+type User struct {
+	ID       int
+	Username string
+	IsAdmin  bool
+}
+
+// PersonalAccessToken describes Server.Token as a personal access token. ExpiresAt
+// is a date such as 2030-01-31, or empty if the token does not expire.
+type PersonalAccessToken struct {
+	Name      string
+	Scopes    []string
+	ExpiresAt string
+	Active    bool
+	Revoked   bool
+}
+
+// Access levels of members, as the GitLab API returns them.
+// https://docs.gitlab.com/ee/api/members.html#roles
+const (
+	GuestAccess      = 10
+	ReporterAccess   = 20
+	DeveloperAccess  = 30
+	MaintainerAccess = 40
+	OwnerAccess      = 50
+)
+
+// Request is a request that the Server received.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+}
+
+// Server is an in-process GitLab API. Point a GitLab client at Server.URL and
+// authenticate with Server.Token.
+//
+// Requests that fail with a 5xx status are retried by most GitLab clients, with a
+// backoff, so use 4xx statuses to test errors quickly.
+type Server struct {
+	// URL is the base URL of the API, for example http://127.0.0.1:1234/api/v4.
+	URL string
+	// Token is the token that requests must send in the PRIVATE-TOKEN header, or as
+	// an OAuth bearer token in the Authorization header. If it is empty every request
+	// is accepted.
+	Token string
+	// PerPage is the page size of requests that do not set per_page. Defaults to 20.
+	PerPage int
+	// OmitTotals leaves out the X-Total and X-Total-Pages headers and the 'last'
+	// link, as GitLab does for large collections.
+	OmitTotals bool
+	// OmitPageHeaders leaves out every X-* pagination header, as some proxies do,
+	// so that clients have to follow the Link header.
+	OmitPageHeaders bool
+	// Version is the GitLab version that the Server reports. Defaults to 17.0.0.
+	Version string
+	// User is the user that Token belongs to. Defaults to user 1, glentest.
+	User User
+	// PersonalAccessToken describes Token. If it is nil, the token is not a personal
+	// access token, as with OAuth tokens. Defaults to an active token with the api scope.
+	PersonalAccessToken *PersonalAccessToken
+
+	server      *httptest.Server
+	mu          sync.Mutex
+	projects    map[string]*Project
+	groups      map[string][]Variable
+	access      map[string]int
+	instance    []Variable
+	failures    map[string]int
+	rateLimited int
+	requests    []Request
+}
+
+// NewServer starts a Server that is closed when the test finishes.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{}
+
+	s.Token = Token
+	s.PerPage = defaultPerPage
+	s.Version = "17.0.0"
+	s.User = User{ID: 1, Username: "glentest"}
+	s.PersonalAccessToken = &PersonalAccessToken{Name: "glentest", Scopes: []string{"api"}, Active: true}
+	s.projects = make(map[string]*Project)
+	s.groups = make(map[string][]Variable)
+	s.access = make(map[string]int)
+	s.failures = make(map[string]int)
+
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL + "/api/v4"
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+// AddProject adds a project, replacing any project with the same path but keeping
+// its variables, protected refs, pipelines and jobs. Projects are also added by AddProjectVariables.
+func (s *Server) AddProject(p Project) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := s.project(p.Path)
+	p.variables = existing.variables
+	p.protectedBranches = existing.protectedBranches
+	p.protectedTags = existing.protectedTags
+	p.pipelines = existing.pipelines
+	p.jobs = existing.jobs
+	if p.ID == 0 {
+		p.ID = existing.ID
+	}
+	*existing = p
+}
+
+// AddProjectVariables adds variables to a project.
+func (s *Server) AddProjectVariables(project string, vars ...Variable) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.project(project)
+	p.variables = append(p.variables, vars...)
+}
+
+// AddPipeline adds a pipeline to a project.
+func (s *Server) AddPipeline(project string, pipeline Pipeline) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.project(project)
+	p.pipelines = append(p.pipelines, pipeline)
+}
+
+// AddJob adds a job, and its deployment if it has an Environment, to a project.
+func (s *Server) AddJob(project string, job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.project(project)
+	p.jobs = append(p.jobs, job)
+}
+
+// AddGroupVariables adds variables to a group, adding the group if it does not exist.
+func (s *Server) AddGroupVariables(group string, vars ...Variable) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.groups[group] = append(s.groups[group], vars...)
+}
+
+// AddInstanceVariables adds instance variables.
+func (s *Server) AddInstanceVariables(vars ...Variable) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.instance = append(s.instance, vars...)
+}
+
+// AddProtectedBranches protects branches of a project. Names may contain '*' wildcards.
+func (s *Server) AddProtectedBranches(project string, names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.project(project)
+	p.protectedBranches = append(p.protectedBranches, names...)
+}
+
+// AddProtectedTags protects tags of a project. Names may contain '*' wildcards.
+func (s *Server) AddProtectedTags(project string, names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.project(project)
+	p.protectedTags = append(p.protectedTags, names...)
+}
+
+// SetGroupAccess makes Server.User a member of a group with an access level, such
+// as MaintainerAccess. Members of a group are members of its subgroups and projects.
+func (s *Server) SetGroupAccess(group string, level int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.access["groups/"+group] = level
+}
+
+// SetProjectAccess makes Server.User a member of a project with an access level.
+func (s *Server) SetProjectAccess(project string, level int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.project(project)
+	s.access["projects/"+project] = level
+}
+
+// Fail makes every request for path, relative to Server.URL and unescaped, fail
+// with status. For example Fail("/projects/group/project/variables", 403).
+func (s *Server) Fail(path string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[path] = status
+}
+
+// RateLimit rejects the next n requests with 429 Too Many Requests.
+func (s *Server) RateLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rateLimited = n
+}
+
+// Requests returns every request the Server received, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// project returns the project at path, adding it if it does not exist. s.mu must be held.
+func (s *Server) project(path string) *Project {
+	p, ok := s.projects[path]
+	if !ok {
+		p = &Project{ID: len(s.projects) + 1, Path: path}
+		s.projects[path] = p
+	}
+
+	return p
+}
+
+// serveHTTP records, rate limits, fails or authenticates a request before routing it.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	segments := splitPath(strings.TrimPrefix(r.URL.EscapedPath(), "/api/v4"))
+	path := "/" + strings.Join(segments, "/")
+	s.requests = append(s.requests, Request{Method: r.Method, Path: path, Query: r.URL.Query()})
+
+	if s.rateLimited > 0 {
+		s.rateLimited--
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusTooManyRequests, "Retry later")
+
+		return
+	}
+	if status, ok := s.failures[path]; ok {
+		writeError(w, status, http.StatusText(status))
+
+		return
+	}
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+
+		return
+	}
+	if r.Method != http.MethodGet && !writable(r.Method, segments) {
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+
+		return
+	}
+
+	rec := httptest.NewRecorder()
+	s.route(rec, r, segments)
+	writeWithETag(w, r, rec)
+}
+
+// writeWithETag writes a recorded response, with a weak ETag of its body on
+// successful responses. Like GitLab, it answers 304 Not Modified without a body
+// when the request sends the same ETag in If-None-Match.
+func writeWithETag(w http.ResponseWriter, r *http.Request, rec *httptest.ResponseRecorder) {
+	for key, values := range rec.Header() {
+		w.Header()[key] = values
+	}
+	if rec.Code != http.StatusOK {
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes()) //nolint:errcheck,gosec
+
+		return
+	}
+
+	sum := sha256.Sum256(rec.Body.Bytes())
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(rec.Body.Bytes()) //nolint:errcheck,gosec
+}
+
+// route serves the endpoint at segments, the unescaped parts of the request path.
+func (s *Server) route(w http.ResponseWriter, r *http.Request, segments []string) {
+	switch path := strings.Join(segments, "/"); {
+	case path == "version":
+		writeJSON(w, map[string]any{"version": s.Version, "revision": "glentest"})
+	case path == "user":
+		writeJSON(w, map[string]any{"id": s.User.ID, "username": s.User.Username, "is_admin": s.User.IsAdmin})
+	case path == "personal_access_tokens/self":
+		s.serveToken(w)
+	case path == "admin/ci/variables" || strings.HasPrefix(path, "admin/ci/variables/"):
+		s.serveVariables(w, r, &s.instance, segments[3:])
+	case len(segments) < 2:
+		writeError(w, http.StatusNotFound, "Not Found")
+	case len(segments) >= 4 && segments[2] == "members" && segments[3] == "all":
+		s.serveMember(w, segments[0]+"/"+segments[1], segments[4:])
+	case segments[0] == "groups":
+		s.serveGroup(w, r, segments[1], segments[2:])
+	case segments[0] == "projects":
+		p, ok := s.projects[segments[1]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Project Not Found")
+
+			return
+		}
+		s.serveProject(w, r, p, segments[2:])
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// serveGroup serves the variables, subgroups or projects of a group.
+func (s *Server) serveGroup(w http.ResponseWriter, r *http.Request, group string, segments []string) {
+	vars, ok := s.groups[group]
+	if !ok || len(segments) == 0 {
+		writeError(w, http.StatusNotFound, "Group Not Found")
+
+		return
+	}
+
+	switch segments[0] {
+	case variablesPath:
+		s.serveVariables(w, r, &vars, segments[1:])
+		s.groups[group] = vars
+	case "descendant_groups":
+		s.servePage(w, r, s.descendantGroups(group))
+	case "projects":
+		s.servePage(w, r, s.groupProjects(group))
+	default:
+		writeError(w, http.StatusNotFound, "Group Not Found")
+	}
+}
+
+// descendantGroups returns every subgroup of group, at any depth, sorted by path.
+func (s *Server) descendantGroups(group string) []any {
+	var paths []string
+	for path := range s.groups {
+		if strings.HasPrefix(path, group+"/") {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	items := make([]any, 0, len(paths))
+	for _, path := range paths {
+		items = append(items, map[string]any{"full_path": path})
+	}
+
+	return items
+}
+
+// groupProjects returns every project of group and its subgroups, sorted by path.
+func (s *Server) groupProjects(group string) []any {
+	var paths []string
+	for path := range s.projects {
+		if strings.HasPrefix(path, group+"/") {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	items := make([]any, 0, len(paths))
+	for _, path := range paths {
+		items = append(items, projectJSON(s.projects[path]))
+	}
+
+	return items
+}
+
+// serveToken serves Server.PersonalAccessToken.
+func (s *Server) serveToken(w http.ResponseWriter) {
+	t := s.PersonalAccessToken
+	if t == nil {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+
+		return
+	}
+
+	var expiresAt any
+	if t.ExpiresAt != "" {
+		expiresAt = t.ExpiresAt
+	}
+	writeJSON(w, map[string]any{
+		"id": 1, "name": t.Name, "scopes": t.Scopes, "user_id": s.User.ID,
+		"active": t.Active, "revoked": t.Revoked, "expires_at": expiresAt,
+	})
+}
+
+// serveMember serves the membership of Server.User in a group or project, including
+// memberships inherited from parent groups. namespace is "groups/<path>" or
+// "projects/<path>".
+func (s *Server) serveMember(w http.ResponseWriter, namespace string, segments []string) {
+	if len(segments) != 1 || segments[0] != strconv.Itoa(s.User.ID) {
+		writeError(w, http.StatusNotFound, "404 Not found")
+
+		return
+	}
+
+	// Members of a parent group are members with at least the same access level
+	level := s.access[namespace]
+	_, parent, _ := strings.Cut(namespace, "/")
+	for strings.Contains(parent, "/") {
+		parent = parent[:strings.LastIndex(parent, "/")]
+		level = max(level, s.access["groups/"+parent])
+	}
+	if level == 0 {
+		writeError(w, http.StatusNotFound, "404 Not found")
+
+		return
+	}
+
+	writeJSON(w, map[string]any{"id": s.User.ID, "username": s.User.Username, "access_level": level})
+}
+
+// serveProject serves a project or one of its sub resources.
+func (s *Server) serveProject(w http.ResponseWriter, r *http.Request, p *Project, segments []string) {
+	if len(segments) == 0 {
+		writeJSON(w, projectJSON(p))
+
+		return
+	}
+
+	switch segments[0] {
+	case variablesPath:
+		s.serveVariables(w, r, &p.variables, segments[1:])
+	case "protected_branches":
+		s.servePage(w, r, namedJSON(p.protectedBranches))
+	case "protected_tags":
+		s.servePage(w, r, namedJSON(p.protectedTags))
+	case "pipelines":
+		servePipeline(w, p, segments[1:])
+	case "jobs":
+		serveJob(w, p, segments[1:])
+	case "deployments":
+		s.servePage(w, r, deploymentsJSON(p, r.URL.Query().Get("sort")))
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// servePipeline serves a pipeline of a project or, if segments ends with
+// "variables", the variables it was created with.
+func servePipeline(w http.ResponseWriter, p *Project, segments []string) {
+	for _, pipeline := range p.pipelines {
+		switch {
+		case len(segments) == 0 || strconv.Itoa(pipeline.ID) != segments[0]:
+			continue
+		case len(segments) == 1:
+			writeJSON(w, map[string]any{
+				"id": pipeline.ID, "ref": pipeline.Ref, "tag": pipeline.Tag,
+				"sha": pipeline.SHA, "source": pipeline.Source,
+			})
+
+			return
+		case len(segments) == 2 && segments[1] == variablesPath:
+			vars := make([]any, 0, len(pipeline.Variables))
+			for _, v := range pipeline.Variables {
+				vars = append(vars, map[string]any{"key": v.Key, "value": v.Value, "variable_type": v.VariableType})
+			}
+			writeJSON(w, vars)
+
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "Pipeline Not Found")
+}
+
+// serveJob serves a job of a project.
+func serveJob(w http.ResponseWriter, p *Project, segments []string) {
+	for _, job := range p.jobs {
+		if len(segments) == 1 && strconv.Itoa(job.ID) == segments[0] {
+			writeJSON(w, map[string]any{
+				"id": job.ID, "name": job.Name, "stage": job.Stage,
+				"pipeline": map[string]any{"id": job.PipelineID},
+			})
+
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "Job Not Found")
+}
+
+// deploymentsJSON returns the deployments of the jobs of a project, as the GitLab
+// API returns them, oldest first unless sort is "desc". Deployment and job IDs are the same.
+func deploymentsJSON(p *Project, order string) []any {
+	jobs := make([]Job, 0, len(p.jobs))
+	for _, job := range p.jobs {
+		if job.Environment != "" {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if order == "desc" {
+			return jobs[i].ID > jobs[j].ID
+		}
+
+		return jobs[i].ID < jobs[j].ID
+	})
+
+	items := make([]any, 0, len(jobs))
+	for _, job := range jobs {
+		items = append(items, map[string]any{
+			"id":          job.ID,
+			"deployable":  map[string]any{"id": job.ID, "name": job.Name},
+			"environment": map[string]any{"name": job.Environment},
+		})
+	}
+
+	return items
+}
+
+// variableRequest is the body of a request that creates or updates a variable.
+// Fields that are not sent are nil.
+//
+//nolint:tagliatelle // The GitLab API uses snake case.
+type variableRequest struct {
+	Key              *string `json:"key"`
+	Value            *string `json:"value"`
+	VariableType     *string `json:"variable_type"`
+	Protected        *bool   `json:"protected"`
+	Masked           *bool   `json:"masked"`
+	MaskedAndHidden  *bool   `json:"masked_and_hidden"`
+	Raw              *bool   `json:"raw"`
+	EnvironmentScope *string `json:"environment_scope"`
+	Description      *string `json:"description"`
+	Filter           struct {
+		EnvironmentScope *string `json:"environment_scope"`
+	} `json:"filter"`
+}
+
+// apply sets the fields of v that the request sends.
+func (req variableRequest) apply(v *Variable) {
+	set(&v.Key, req.Key)
+	set(&v.Value, req.Value)
+	set(&v.VariableType, req.VariableType)
+	set(&v.Protected, req.Protected)
+	set(&v.Masked, req.Masked)
+	set(&v.Raw, req.Raw)
+	set(&v.EnvironmentScope, req.EnvironmentScope)
+	set(&v.Description, req.Description)
+	if req.MaskedAndHidden != nil && *req.MaskedAndHidden {
+		v.Masked = true
+		v.Hidden = true
+	}
+}
+
+// set sets *dst to *src if src is not nil.
+func set[T any](dst *T, src *T) {
+	if src != nil {
+		*dst = *src
+	}
+}
+
+// writable reports whether requests with method may change the resource at
+// segments. Only variables can be created, with POST, and updated, with PUT.
+func writable(method string, segments []string) bool {
+	n := len(segments)
+	switch method {
+	case http.MethodPost:
+		return n > 0 && segments[n-1] == variablesPath
+	case http.MethodPut:
+		return n > 1 && segments[n-2] == variablesPath
+	default:
+		return false
+	}
+}
+
+// serveVariables serves a page of vars or, if segments names a key, a single variable.
+// A single variable is matched on filter[environment_scope] if it is set. POST
+// creates a variable and PUT updates one, like GitLab.
+func (s *Server) serveVariables(w http.ResponseWriter, r *http.Request, vars *[]Variable, segments []string) {
+	switch {
+	case r.Method == http.MethodPost:
+		createVariable(w, r, vars)
+	case len(segments) == 0:
+		items := make([]any, 0, len(*vars))
+		for _, v := range *vars {
+			items = append(items, v)
+		}
+		s.servePage(w, r, items)
+	case r.Method == http.MethodPut:
+		updateVariable(w, r, *vars, segments[0])
+	default:
+		scope, filtered := r.URL.Query()["filter[environment_scope]"]
+		i := findVariable(*vars, segments[0], scope, filtered)
+		if i < 0 {
+			writeError(w, http.StatusNotFound, "Variable Not Found")
+
+			return
+		}
+		writeJSON(w, (*vars)[i])
+	}
+}
+
+// createVariable adds the variable in the request body to vars. As in GitLab, the
+// environment scope defaults to '*' and a key can only be used once per scope.
+func createVariable(w http.ResponseWriter, r *http.Request, vars *[]Variable) {
+	var req variableRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Key == nil || *req.Key == "" {
+		writeError(w, http.StatusBadRequest, "Bad Request")
+
+		return
+	}
+
+	v := Variable{VariableType: "env_var", EnvironmentScope: "*"}
+	req.apply(&v)
+	if findVariable(*vars, v.Key, []string{v.EnvironmentScope}, true) >= 0 {
+		writeError(w, http.StatusBadRequest, v.Key+" has already been taken")
+
+		return
+	}
+	*vars = append(*vars, v)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(v) //nolint:errcheck,errchkjson,gosec
+}
+
+// updateVariable updates the variable key in vars with the request body. The
+// variable is matched on filter[environment_scope] if the body sets it.
+func updateVariable(w http.ResponseWriter, r *http.Request, vars []Variable, key string) {
+	var req variableRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request")
+
+		return
+	}
+
+	var scope []string
+	if req.Filter.EnvironmentScope != nil {
+		scope = []string{*req.Filter.EnvironmentScope}
+	}
+	i := findVariable(vars, key, scope, scope != nil)
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "Variable Not Found")
+
+		return
+	}
+
+	req.Key = nil
+	req.apply(&vars[i])
+	writeJSON(w, vars[i])
+}
+
+// findVariable returns the index of the first variable in vars with key, and with
+// the environment scope scope[0] if filtered, or -1 if there is none.
+func findVariable(vars []Variable, key string, scope []string, filtered bool) int {
+	for i, v := range vars {
+		if v.Key == key && (!filtered || v.EnvironmentScope == scope[0]) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// servePage serves the page of items selected by the page and per_page parameters,
+// with the same pagination headers as GitLab.
+func (s *Server) servePage(w http.ResponseWriter, r *http.Request, items []any) {
+	page := queryInt(r, "page", 1)
+	perPage := min(queryInt(r, "per_page", s.PerPage), maxPerPage)
+	totalPages := max((len(items)+perPage-1)/perPage, 1)
+
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+
+	h := http.Header{}
+	h.Set("X-Page", strconv.Itoa(page))
+	h.Set("X-Per-Page", strconv.Itoa(perPage))
+
+	var links []string
+	link := func(rel string, page int) {
+		q := r.URL.Query()
+		q.Set("page", strconv.Itoa(page))
+		q.Set("per_page", strconv.Itoa(perPage))
+		u := url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: q.Encode()}
+		links = append(links, fmt.Sprintf("<%s>; rel=%q", u.String(), rel))
+	}
+
+	if page > 1 {
+		h.Set("X-Prev-Page", strconv.Itoa(page-1))
+		link("prev", page-1)
+	}
+	if page < totalPages {
+		h.Set("X-Next-Page", strconv.Itoa(page+1))
+		link("next", page+1)
+	}
+	link("first", 1)
+	if !s.OmitTotals {
+		h.Set("X-Total", strconv.Itoa(len(items)))
+		h.Set("X-Total-Pages", strconv.Itoa(totalPages))
+		link("last", totalPages)
+	}
+	for key, values := range h {
+		if !s.OmitPageHeaders {
+			w.Header()[key] = values
+		}
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+
+	writeJSON(w, items[start:end])
+}
+
+// projectJSON returns the fields of a project that glen reads, as the GitLab API returns them.
+func projectJSON(p *Project) map[string]any {
+	name := p.Path[strings.LastIndex(p.Path, "/")+1:]
+
+	return map[string]any{
+		"id":                  p.ID,
+		"name":                name,
+		"path":                name,
+		"path_with_namespace": p.Path,
+		"description":         p.Description,
+		"visibility":          p.Visibility,
+		"default_branch":      p.DefaultBranch,
+		"namespace":           map[string]any{"id": p.NamespaceID},
+	}
+}
+
+// namedJSON returns protected refs as the GitLab API returns them.
+func namedJSON(names []string) []any {
+	items := make([]any, 0, len(names))
+	for i, name := range names {
+		items = append(items, map[string]any{"id": i + 1, "name": name})
+	}
+
+	return items
+}
+
+// splitPath splits an escaped URL path into its unescaped segments, so that
+// URL-encoded project and group paths stay a single segment.
+func splitPath(escaped string) []string {
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(escaped, "/"), "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			unescaped = segment
+		}
+		segments = append(segments, unescaped)
+	}
+
+	return segments
+}
+
+// queryInt returns a positive integer query parameter, or def if it is not set.
+func queryInt(r *http.Request, name string, def int) int {
+	n, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil || n < 1 {
+		return def
+	}
+
+	return n
+}
+
+// authorized reports whether r carries Server.Token.
+func (s *Server) authorized(r *http.Request) bool {
+	return s.Token == "" ||
+		r.Header.Get("PRIVATE-TOKEN") == s.Token ||
+		r.Header.Get("Authorization") == "Bearer "+s.Token
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v) //nolint:errcheck,errchkjson,gosec
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{ //nolint:errcheck,errchkjson,gosec
+		"message": fmt.Sprintf("%d %s", status, message),
+	})
+}
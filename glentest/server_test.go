@@ -0,0 +1,218 @@
+package glentest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// get requests path from s with a valid token and decodes the response into v.
+func get(t *testing.T, s *Server, path string, v any) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, s.URL+path, nil)
+	require.NoError(t, err)
+	req.Header.Set("PRIVATE-TOKEN", s.Token)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close() //nolint:errcheck
+
+	if v != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+
+	return resp
+}
+
+func TestServerPagination(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer(t)
+	for i := range 5 {
+		s.AddProjectVariables("group/project", Variable{Key: "KEY_" + strconv.Itoa(i)})
+	}
+
+	var page []Variable
+	resp := get(t, s, "/projects/group%2Fproject/variables?page=2&per_page=2", &page)
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []Variable{{Key: "KEY_2"}, {Key: "KEY_3"}}, page)
+	assert.Equal(t, "2", resp.Header.Get("X-Page"))
+	assert.Equal(t, "3", resp.Header.Get("X-Next-Page"))
+	assert.Equal(t, "1", resp.Header.Get("X-Prev-Page"))
+	assert.Equal(t, "5", resp.Header.Get("X-Total"))
+	assert.Equal(t, "3", resp.Header.Get("X-Total-Pages"))
+	assert.Contains(t, resp.Header.Get("Link"), `rel="next"`)
+	assert.Contains(t, resp.Header.Get("Link"), `rel="last"`)
+
+	s.OmitTotals = true
+	resp = get(t, s, "/projects/group%2Fproject/variables?page=3&per_page=2", &page)
+
+	assert.Equal(t, []Variable{{Key: "KEY_4"}}, page)
+	assert.Empty(t, resp.Header.Get("X-Next-Page"))
+	assert.Empty(t, resp.Header.Get("X-Total-Pages"))
+	assert.NotContains(t, resp.Header.Get("Link"), `rel="last"`)
+}
+
+func TestServerVariableScope(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer(t)
+	s.AddGroupVariables("group",
+		Variable{Key: "DEPLOY", Value: "staging", EnvironmentScope: "staging"},
+		Variable{Key: "DEPLOY", Value: "production", EnvironmentScope: "production"},
+	)
+
+	var v Variable
+	resp := get(t, s, "/groups/group/variables/DEPLOY?filter%5Benvironment_scope%5D=production", &v)
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "production", v.Value)
+
+	resp = get(t, s, "/groups/group/variables/DEPLOY?filter%5Benvironment_scope%5D=review", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServerErrors(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer(t)
+	s.AddInstanceVariables(Variable{Key: "INSTANCE"})
+	s.Fail("/projects/group/project/variables", http.StatusForbidden)
+	s.RateLimit(1)
+
+	resp := get(t, s, "/admin/ci/variables", nil)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	var vars []Variable
+	resp = get(t, s, "/admin/ci/variables", &vars)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []Variable{{Key: "INSTANCE"}}, vars)
+
+	resp = get(t, s, "/projects/group%2Fproject/variables", nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = get(t, s, "/projects/other/variables", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err := http.Get(s.URL + "/admin/ci/variables") //nolint:noctx
+	require.NoError(t, err)
+	resp.Body.Close() //nolint:errcheck,gosec
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	assert.Len(t, s.Requests(), 5)
+	assert.Equal(t, "/projects/group/project/variables", s.Requests()[2].Path)
+}
+
+// send sends body as JSON to path on s with method and a valid token.
+func send(t *testing.T, s *Server, method string, path string, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), method, s.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("PRIVATE-TOKEN", s.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close() //nolint:errcheck,gosec
+
+	return resp
+}
+
+func TestServerWriteVariables(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer(t)
+	s.AddGroupVariables("group", Variable{Key: "DEPLOY", Value: "old", EnvironmentScope: "production"})
+
+	resp := send(t, s, http.MethodPost, "/groups/group/variables", `{"key":"NEW","value":"new","masked_and_hidden":true}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp = send(t, s, http.MethodPost, "/groups/group/variables", `{"key":"NEW","value":"again"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = send(t, s, http.MethodPut, "/groups/group/variables/DEPLOY",
+		`{"value":"new","filter":{"environment_scope":"production"}}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = send(t, s, http.MethodPut, "/groups/group/variables/DEPLOY",
+		`{"value":"new","filter":{"environment_scope":"staging"}}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = send(t, s, http.MethodPost, "/projects/group%2Fproject/variables", `{"key":"NEW"}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = send(t, s, http.MethodDelete, "/groups/group/variables/DEPLOY", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	var vars []Variable
+	get(t, s, "/groups/group/variables", &vars)
+	assert.Equal(t, []Variable{
+		{Key: "DEPLOY", Value: "new", EnvironmentScope: "production"},
+		{Key: "NEW", Value: "new", VariableType: "env_var", Masked: true, Hidden: true, EnvironmentScope: "*"},
+	}, vars)
+}
+
+func TestServerETag(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer(t)
+	s.AddProjectVariables("group/project", Variable{Key: "KEY", Value: "value"})
+
+	resp := get(t, s, "/projects/group%2Fproject/variables", nil)
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+
+	request := func() *http.Response {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, s.URL+"/projects/group%2Fproject/variables", nil)
+		require.NoError(t, err)
+		req.Header.Set("PRIVATE-TOKEN", s.Token)
+		req.Header.Set("If-None-Match", etag)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close() //nolint:errcheck,gosec
+
+		return resp
+	}
+
+	assert.Equal(t, http.StatusNotModified, request().StatusCode)
+
+	s.AddProjectVariables("group/project", Variable{Key: "OTHER", Value: "value"})
+	resp = request()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+}
+
+func TestServerPipelines(t *testing.T) {
+	t.Parallel()
+
+	s := NewServer(t)
+	s.AddPipeline("group/project", Pipeline{ID: 1, Ref: "main", Variables: []Variable{{Key: "KEY", Value: "value"}}})
+	s.AddJob("group/project", Job{ID: 2, PipelineID: 1, Name: "build"})
+	s.AddJob("group/project", Job{ID: 3, PipelineID: 1, Name: "deploy", Environment: "production"})
+	s.AddJob("group/project", Job{ID: 4, PipelineID: 1, Name: "review", Environment: "review"})
+
+	var vars []Variable
+	resp := get(t, s, "/projects/group%2Fproject/pipelines/1/variables", &vars)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []Variable{{Key: "KEY", Value: "value"}}, vars)
+
+	var deployments []struct {
+		ID int `json:"id"`
+	}
+	get(t, s, "/projects/group%2Fproject/deployments?sort=desc", &deployments)
+	assert.Equal(t, []struct {
+		ID int `json:"id"`
+	}{{ID: 4}, {ID: 3}}, deployments)
+
+	resp = get(t, s, "/projects/group%2Fproject/jobs/5", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}